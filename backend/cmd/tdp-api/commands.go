@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"tdp-lite/backend/internal/store"
+)
+
+const commandUsage = `usage: tdp-api [command]
+
+Without a command tdp-api serves the HTTP API.
+
+Commands:
+  secrets migrate   seal plaintext API key and webhook subscription secrets,
+                    and secrets sealed with an older master key, under the
+                    active TDP_SECRET_KEYS version
+  audit verify      walk the audit log hash chain and report the first entry
+                    that was edited, removed or inserted outside the chain
+  audit rekey       re-hash a verified chain under TDP_AUDIT_HMAC_KEY, once
+                    after setting the key on a database with audit entries`
+
+// runCommand runs a one-off maintenance command instead of the server.
+func runCommand(ctx context.Context, st *store.Store, args []string) error {
+	switch strings.Join(args, " ") {
+	case "secrets migrate":
+		updated, err := st.ReencryptSecrets(ctx)
+		if err != nil {
+			return fmt.Errorf("secrets migrate: %w (%d secrets updated before the error)", err, updated)
+		}
+		log.Printf("secrets migrate: %d api key and webhook secrets re-encrypted", updated)
+		return nil
+	case "audit verify":
+		report, err := st.VerifyAuditChain(ctx)
+		if err != nil {
+			return fmt.Errorf("audit verify: %w", err)
+		}
+		if broken := report.Broken; broken != nil {
+			at := fmt.Sprintf("seq %d", broken.Seq)
+			if broken.ID != "" {
+				at += " (id " + broken.ID + ")"
+			}
+			return fmt.Errorf("audit verify: chain broken at %s: %s; %d entries verified before it", at, broken.Reason, report.Checked)
+		}
+		log.Printf("audit verify: %d entries verified, chain head at seq %d hash %s", report.Checked, report.HeadSeq, report.HeadHash)
+		if !report.Keyed {
+			log.Printf("audit verify: TDP_AUDIT_HMAC_KEY is not set; the plain SHA-256 chain does not detect a rewrite that recomputes hashes")
+		}
+		return nil
+	case "audit rekey":
+		rekeyed, err := st.RekeyAuditChain(ctx)
+		if err != nil {
+			return fmt.Errorf("audit rekey: %w", err)
+		}
+		log.Printf("audit rekey: %d entries re-hashed under TDP_AUDIT_HMAC_KEY", rekeyed)
+		return nil
+	case "help", "-h", "--help":
+		fmt.Println(commandUsage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n%s", strings.Join(args, " "), commandUsage)
+	}
+}
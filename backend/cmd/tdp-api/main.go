@@ -12,6 +12,7 @@ import (
 	"tdp-lite/backend/internal/api"
 	"tdp-lite/backend/internal/config"
 	"tdp-lite/backend/internal/db"
+	"tdp-lite/backend/internal/secrets"
 	"tdp-lite/backend/internal/store"
 )
 
@@ -26,6 +27,23 @@ func main() {
 	defer database.Close()
 
 	st := store.New(database)
+	keyring, err := secrets.ParseKeyring(cfg.SecretKeys, cfg.SecretKeyVersion)
+	if err != nil {
+		log.Fatalf("invalid TDP_SECRET_KEYS: %v", err)
+	}
+	if keyring == nil {
+		log.Println("TDP_SECRET_KEYS is not set; api key secrets are stored unencrypted")
+	}
+	st.SetSecretKeyring(keyring)
+	st.SetAuditKey(cfg.AuditKey)
+
+	if len(os.Args) > 1 {
+		if err := runCommand(ctx, st, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	server, err := api.New(cfg, database, st)
 	if err != nil {
 		log.Fatalf("api init failed: %v", err)
@@ -38,6 +56,7 @@ func main() {
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	httpServer.RegisterOnShutdown(server.CloseStreams)
 
 	go func() {
 		log.Printf("tdp-api listening on %s", cfg.ServerAddr)
@@ -9,6 +9,7 @@ import (
 
 	"tdp-lite/backend/internal/config"
 	"tdp-lite/backend/internal/db"
+	"tdp-lite/backend/internal/secrets"
 	"tdp-lite/backend/internal/store"
 	"tdp-lite/backend/internal/worker"
 )
@@ -23,12 +24,18 @@ func main() {
 	defer database.Close()
 
 	st := store.New(database)
+	keyring, err := secrets.ParseKeyring(cfg.SecretKeys, cfg.SecretKeyVersion)
+	if err != nil {
+		log.Fatalf("invalid TDP_SECRET_KEYS: %v", err)
+	}
+	st.SetSecretKeyring(keyring)
+	st.SetAuditKey(cfg.AuditKey)
 	wk := worker.New(cfg, st)
 
 	runCtx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	log.Printf("tdp-worker started with poll interval %s", cfg.JobPollInterval)
+	log.Printf("tdp-worker %s started with concurrency %d and poll interval %s", wk.ID(), cfg.WorkerConcurrency, cfg.JobPollInterval)
 	if err := wk.Run(runCtx); err != nil && !errors.Is(err, context.Canceled) {
 		log.Fatalf("worker stopped with error: %v", err)
 	}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tdp-lite/backend/internal/store"
+)
+
+// contentETag renders a content version as a strong ETag,
+// "<revision>-<updatedAt in unix microseconds>".
+func contentETag(version store.ContentVersion) string {
+	return fmt.Sprintf(`"%d-%d"`, version.Revision, version.UpdatedAt.UnixMicro())
+}
+
+func parseContentETag(tag string) (store.ContentVersion, bool) {
+	tag = strings.TrimSpace(tag)
+	if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+		return store.ContentVersion{}, false
+	}
+	revisionRaw, updatedAtRaw, ok := strings.Cut(tag[1:len(tag)-1], "-")
+	if !ok {
+		return store.ContentVersion{}, false
+	}
+	revision, err := strconv.Atoi(revisionRaw)
+	if err != nil {
+		return store.ContentVersion{}, false
+	}
+	updatedAt, err := strconv.ParseInt(updatedAtRaw, 10, 64)
+	if err != nil {
+		return store.ContentVersion{}, false
+	}
+	return store.ContentVersion{Revision: revision, UpdatedAt: time.UnixMicro(updatedAt).UTC()}, true
+}
+
+// ifMatchVersion reads the If-Match header. A missing header or "*" means the
+// write is unconditional (nil); a value that is not one of our ETags can never
+// match, so ok is false and the caller answers 412.
+func ifMatchVersion(r *http.Request) (*store.ContentVersion, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return nil, true
+	}
+	version, ok := parseContentETag(header)
+	if !ok {
+		return nil, false
+	}
+	return &version, true
+}
+
+func writeVersionConflict(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusPreconditionFailed, "version_conflict", "content was changed since it was read; reload and retry", false, requestIDFromContext(r.Context()))
+}
@@ -47,7 +47,7 @@ func (s *Server) handleCreateAIJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := s.runWithIdempotency(w, r, req, func() (any, error) {
+	if _, err := s.runWithIdempotency(w, r, req, func() (int, any, error) {
 		job, err := s.store.CreateAIJob(r.Context(), store.CreateAIJobInput{
 			Kind:      req.Kind,
 			ContentID: req.ContentID,
@@ -56,10 +56,10 @@ func (s *Server) handleCreateAIJob(w http.ResponseWriter, r *http.Request) {
 			Prompt:    req.Prompt,
 		})
 		if err != nil {
-			return nil, err
+			return 0, nil, err
 		}
 		_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "ai.job.create", "ai_job", job.ID, map[string]any{"provider": job.Provider, "model": job.Model})
-		return map[string]any{"job": job}, nil
+		return http.StatusOK, map[string]any{"job": job}, nil
 	}); err != nil {
 		writeStoreError(w, r, err)
 	}
@@ -75,36 +75,89 @@ func (s *Server) handleGetAIJob(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{"job": job})
 }
 
-func (s *Server) handleApplyAIJob(w http.ResponseWriter, r *http.Request) {
-	jobID := chi.URLParam(r, "jobId")
-	job, err := s.store.GetAIJobByID(r.Context(), jobID)
-	if err != nil {
-		writeStoreError(w, r, err)
-		return
+func normalizedJobListStatus(input string) (string, bool) {
+	switch strings.TrimSpace(input) {
+	case "", "all":
+		return "all", true
+	case "queued", "running", "succeeded", "failed", "dead":
+		return strings.TrimSpace(input), true
+	default:
+		return "", false
 	}
-	if job.Status != "succeeded" {
-		writeError(w, http.StatusConflict, "job_not_ready", "job must be succeeded before apply", false, requestIDFromContext(r.Context()))
+}
+
+func (s *Server) handleListAIJobs(w http.ResponseWriter, r *http.Request) {
+	limit, offset := parsePagination(r, 50, 200)
+	status, ok := normalizedJobListStatus(r.URL.Query().Get("status"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_filters", "status must be one of all|queued|running|succeeded|failed|dead", false, requestIDFromContext(r.Context()))
 		return
 	}
-	if err := s.store.ApplyAIResultToContent(r.Context(), job); err != nil {
-		writeStoreError(w, r, err)
-		return
+
+	storeStatus := ""
+	if status != "all" {
+		storeStatus = status
 	}
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "ai.job.apply", job.Kind, job.ContentID, map[string]any{"jobId": job.ID})
-	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "jobId": job.ID})
-}
 
-func (s *Server) handleGetGenericJob(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	job, err := s.store.GetAIJobByID(r.Context(), id)
+	items, err := s.store.ListAIJobs(r.Context(), storeStatus, limit, offset)
 	if err != nil {
 		writeStoreError(w, r, err)
 		return
 	}
+
 	writeJSON(w, http.StatusOK, map[string]any{
-		"id":     job.ID,
-		"status": job.Status,
-		"kind":   "ai",
-		"job":    job,
+		"items":  items,
+		"limit":  limit,
+		"offset": offset,
+		"status": status,
 	})
 }
+
+func (s *Server) handleRequeueAIJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobId")
+	if _, err := s.runWithIdempotency(w, r, nil, func() (int, any, error) {
+		job, err := s.store.GetAIJobByID(r.Context(), jobID)
+		if err != nil {
+			return 0, nil, err
+		}
+		if job.Status != "dead" {
+			return 0, nil, errJobNotDead
+		}
+		if _, err := s.store.RequeueDeadJob(r.Context(), jobID); err != nil {
+			return 0, nil, err
+		}
+		item, err := s.store.GetAIJobByID(r.Context(), jobID)
+		if err != nil {
+			return 0, nil, err
+		}
+		_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "ai.job.requeue", "ai_job", item.ID, map[string]any{
+			"previousAttempts": job.Attempts,
+			"lastError":        job.LastError,
+		})
+		return http.StatusOK, map[string]any{"job": item}, nil
+	}); err != nil {
+		writeStoreError(w, r, err)
+	}
+}
+
+func (s *Server) handleApplyAIJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobId")
+	if _, err := s.runWithIdempotency(w, r, nil, func() (int, any, error) {
+		job, err := s.store.GetAIJobByID(r.Context(), jobID)
+		if err != nil {
+			return 0, nil, err
+		}
+		if job.Status != "succeeded" {
+			return 0, nil, errJobNotReady
+		}
+		change := contentChange(r, "updated")
+		change.AuditAction = "ai.job.apply"
+		change.Metadata = map[string]any{"jobId": job.ID}
+		if err := s.store.ApplyAIResultToContent(r.Context(), job, ptr(actorKeyID(r)), change); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusOK, map[string]any{"ok": true, "jobId": job.ID}, nil
+	}); err != nil {
+		writeStoreError(w, r, err)
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"tdp-lite/backend/internal/store"
+)
+
+func parseAuditTime(value string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+// listAuditLogs pages through entries matching filter with the same keyset
+// cursor as search, answering with items, nextCursor and hasMore.
+func (s *Server) listAuditLogs(w http.ResponseWriter, r *http.Request, filter store.AuditLogFilter) {
+	cursor, err := decodeSearchCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_cursor", err.Error(), false, requestIDFromContext(r.Context()))
+		return
+	}
+	if cursor != nil {
+		filter.BeforeAt = &cursor.SortAt
+		filter.BeforeID = cursor.ID
+	}
+	limit, _ := parsePagination(r, 50, 200)
+	filter.Limit = limit + 1
+
+	items, err := s.store.ListAuditLogs(r.Context(), filter)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	response, err := buildSearchResponse(items, limit, func(item store.AuditLog) searchCursorPayload {
+		return searchCursorPayload{SortAt: item.CreatedAt.UTC().Format(time.RFC3339Nano), ID: item.ID}
+	})
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleListAuditLogs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	since, err := parseAuditTime(query.Get("since"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_filters", "since must be an RFC 3339 timestamp", false, requestIDFromContext(r.Context()))
+		return
+	}
+	until, err := parseAuditTime(query.Get("until"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_filters", "until must be an RFC 3339 timestamp", false, requestIDFromContext(r.Context()))
+		return
+	}
+
+	s.listAuditLogs(w, r, store.AuditLogFilter{
+		ActorKeyID:   strings.TrimSpace(query.Get("actor")),
+		Action:       strings.TrimSpace(query.Get("action")),
+		ResourceType: strings.TrimSpace(query.Get("resourceType")),
+		ResourceID:   strings.TrimSpace(query.Get("resourceId")),
+		Since:        since,
+		Until:        until,
+	})
+}
+
+// handleResourceHistory lists the audit trail of the resource named by the
+// {id} path parameter, newest first.
+func (s *Server) handleResourceHistory(resourceType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.listAuditLogs(w, r, store.AuditLogFilter{
+			ResourceType: resourceType,
+			ResourceID:   chi.URLParam(r, "id"),
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package api
 
 import (
-	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -48,7 +47,7 @@ func normalizedLocale(input string) string {
 
 func normalizedStatus(input string) string {
 	switch input {
-	case "draft", "published", "archived":
+	case "draft", "scheduled", "published", "archived":
 		return input
 	default:
 		return "draft"
@@ -84,7 +83,7 @@ func normalizedListStatus(input string) (string, bool) {
 	switch strings.TrimSpace(input) {
 	case "", "all":
 		return "all", true
-	case "draft", "published", "archived":
+	case "draft", "scheduled", "published", "archived":
 		return input, true
 	default:
 		return "", false
@@ -107,14 +106,10 @@ func trimOptionalStringPtr(input *string) *string {
 	return value
 }
 
-func (s *Server) requestSearchSnapshotRefresh(r *http.Request, reason string) {
-	if _, err := s.store.RequestSearchSnapshotRefresh(r.Context()); err != nil {
-		log.Printf("search snapshot refresh request failed reason=%s err=%v", reason, err)
-		return
-	}
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "search_snapshot.request", "search_snapshot", "singleton", map[string]any{
-		"reason": reason,
-	})
+// contentChange describes a content write by the calling key. The store
+// commits its audit entry and outbox event together with the write.
+func contentChange(r *http.Request, event string) store.ContentChange {
+	return store.ContentChange{ActorKeyID: actorKeyID(r), Event: event}
 }
 
 func (s *Server) handleCreatePost(w http.ResponseWriter, r *http.Request) {
@@ -142,7 +137,7 @@ func (s *Server) handleCreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := s.runWithIdempotency(w, r, req, func() (any, error) {
+	if _, err := s.runWithIdempotency(w, r, req, func() (int, any, error) {
 		item, err := s.store.CreatePost(r.Context(), store.CreatePostInput{
 			TranslationKey: trimOptionalStringPtr(req.TranslationKey),
 			Locale:         req.Locale,
@@ -156,13 +151,12 @@ func (s *Server) handleCreatePost(w http.ResponseWriter, r *http.Request) {
 			CardSpan:       cardSpan,
 			PublishedAt:    req.PublishedAt,
 			UpdatedBy:      ptr(actorKeyID(r)),
-		})
+		}, contentChange(r, "created"))
 		if err != nil {
-			return nil, err
+			return 0, nil, err
 		}
-		_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "post.create", "post", item.ID, map[string]any{"status": item.Status})
-		s.requestSearchSnapshotRefresh(r, "post.create")
-		return map[string]any{"item": item}, nil
+		w.Header().Set("ETag", contentETag(item.Version()))
+		return http.StatusOK, map[string]any{"item": item}, nil
 	}); err != nil {
 		writeStoreError(w, r, err)
 	}
@@ -173,7 +167,7 @@ func (s *Server) handleListPosts(w http.ResponseWriter, r *http.Request) {
 	locale := normalizedLocale(strings.TrimSpace(r.URL.Query().Get("locale")))
 	status, ok := normalizedListStatus(r.URL.Query().Get("status"))
 	if !ok {
-		writeError(w, http.StatusBadRequest, "invalid_filters", "status must be one of all|draft|published|archived", false, requestIDFromContext(r.Context()))
+		writeError(w, http.StatusBadRequest, "invalid_filters", "status must be one of all|draft|scheduled|published|archived", false, requestIDFromContext(r.Context()))
 		return
 	}
 
@@ -197,6 +191,18 @@ func (s *Server) handleListPosts(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleGetPost returns one post in any status with its ETag, so an editor can
+// read before a conditional PATCH.
+func (s *Server) handleGetPost(w http.ResponseWriter, r *http.Request) {
+	item, err := s.store.GetPostByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", contentETag(item.Version()))
+	writeJSON(w, http.StatusOK, map[string]any{"item": item})
+}
+
 func (s *Server) handleUpdatePost(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	var req updatePostRequest
@@ -231,28 +237,34 @@ func (s *Server) handleUpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := s.runWithIdempotency(w, r, map[string]any{"id": id, "payload": req}, func() (any, error) {
+	expectedVersion, ok := ifMatchVersion(r)
+	if !ok {
+		writeVersionConflict(w, r)
+		return
+	}
+
+	if _, err := s.runWithIdempotency(w, r, map[string]any{"id": id, "ifMatch": r.Header.Get("If-Match"), "payload": req}, func() (int, any, error) {
 		item, err := s.store.UpdatePost(r.Context(), id, store.UpdatePostInput{
-			Locale:         req.Locale,
-			Title:          req.Title,
-			Slug:           req.Slug,
-			Excerpt:        trimPtr(req.Excerpt),
-			Content:        req.Content,
-			CoverURL:       trimPtr(req.CoverURL),
-			Tags:           req.Tags,
-			Status:         req.Status,
-			CardSpan:       cardSpan,
-			CardSpanSet:    req.CardSpan != nil,
-			PublishedAt:    req.PublishedAt,
-			PublishedAtSet: req.PublishedAt != nil,
-			UpdatedBy:      ptr(actorKeyID(r)),
-		})
+			Locale:          req.Locale,
+			Title:           req.Title,
+			Slug:            req.Slug,
+			Excerpt:         trimPtr(req.Excerpt),
+			Content:         req.Content,
+			CoverURL:        trimPtr(req.CoverURL),
+			Tags:            req.Tags,
+			Status:          req.Status,
+			CardSpan:        cardSpan,
+			CardSpanSet:     req.CardSpan != nil,
+			PublishedAt:     req.PublishedAt,
+			PublishedAtSet:  req.PublishedAt != nil,
+			UpdatedBy:       ptr(actorKeyID(r)),
+			ExpectedVersion: expectedVersion,
+		}, contentChange(r, "updated"))
 		if err != nil {
-			return nil, err
+			return 0, nil, err
 		}
-		_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "post.update", "post", item.ID, nil)
-		s.requestSearchSnapshotRefresh(r, "post.update")
-		return map[string]any{"item": item}, nil
+		w.Header().Set("ETag", contentETag(item.Version()))
+		return http.StatusOK, map[string]any{"item": item}, nil
 	}); err != nil {
 		writeStoreError(w, r, err)
 	}
@@ -260,37 +272,42 @@ func (s *Server) handleUpdatePost(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handlePublishPost(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	item, err := s.store.SetPostStatus(r.Context(), id, "published", ptr(actorKeyID(r)))
-	if err != nil {
+	if _, err := s.runWithIdempotency(w, r, nil, func() (int, any, error) {
+		item, err := s.store.SetPostStatus(r.Context(), id, "published", ptr(actorKeyID(r)), contentChange(r, "published"))
+		if err != nil {
+			return 0, nil, err
+		}
+		w.Header().Set("ETag", contentETag(item.Version()))
+		return http.StatusOK, map[string]any{"item": item}, nil
+	}); err != nil {
 		writeStoreError(w, r, err)
-		return
 	}
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "post.publish", "post", item.ID, nil)
-	s.requestSearchSnapshotRefresh(r, "post.publish")
-	writeJSON(w, http.StatusOK, map[string]any{"item": item})
 }
 
 func (s *Server) handleUnpublishPost(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	item, err := s.store.SetPostStatus(r.Context(), id, "draft", ptr(actorKeyID(r)))
-	if err != nil {
+	if _, err := s.runWithIdempotency(w, r, nil, func() (int, any, error) {
+		item, err := s.store.SetPostStatus(r.Context(), id, "draft", ptr(actorKeyID(r)), contentChange(r, "unpublished"))
+		if err != nil {
+			return 0, nil, err
+		}
+		w.Header().Set("ETag", contentETag(item.Version()))
+		return http.StatusOK, map[string]any{"item": item}, nil
+	}); err != nil {
 		writeStoreError(w, r, err)
-		return
 	}
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "post.unpublish", "post", item.ID, nil)
-	s.requestSearchSnapshotRefresh(r, "post.unpublish")
-	writeJSON(w, http.StatusOK, map[string]any{"item": item})
 }
 
 func (s *Server) handleDeletePost(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	if err := s.store.SoftDeletePost(r.Context(), id); err != nil {
+	if _, err := s.runWithIdempotency(w, r, nil, func() (int, any, error) {
+		if err := s.store.SoftDeletePost(r.Context(), id, contentChange(r, "deleted")); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusOK, map[string]any{"ok": true}, nil
+	}); err != nil {
 		writeStoreError(w, r, err)
-		return
 	}
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "post.delete", "post", id, nil)
-	s.requestSearchSnapshotRefresh(r, "post.delete")
-	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
 }
 
 type createMomentRequest struct {
@@ -336,7 +353,7 @@ func (s *Server) handleCreateMoment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := s.runWithIdempotency(w, r, req, func() (any, error) {
+	if _, err := s.runWithIdempotency(w, r, req, func() (int, any, error) {
 		item, err := s.store.CreateMoment(r.Context(), store.CreateMomentInput{
 			TranslationKey: trimOptionalStringPtr(req.TranslationKey),
 			Content:        req.Content,
@@ -347,13 +364,13 @@ func (s *Server) handleCreateMoment(w http.ResponseWriter, r *http.Request) {
 			Status:         req.Status,
 			CardSpan:       cardSpan,
 			PublishedAt:    req.PublishedAt,
-		})
+			UpdatedBy:      ptr(actorKeyID(r)),
+		}, contentChange(r, "created"))
 		if err != nil {
-			return nil, err
+			return 0, nil, err
 		}
-		_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "moment.create", "moment", item.ID, map[string]any{"status": item.Status})
-		s.requestSearchSnapshotRefresh(r, "moment.create")
-		return map[string]any{"item": item}, nil
+		w.Header().Set("ETag", contentETag(item.Version()))
+		return http.StatusOK, map[string]any{"item": item}, nil
 	}); err != nil {
 		writeStoreError(w, r, err)
 	}
@@ -364,7 +381,7 @@ func (s *Server) handleListMoments(w http.ResponseWriter, r *http.Request) {
 	locale := normalizedLocale(strings.TrimSpace(r.URL.Query().Get("locale")))
 	status, ok := normalizedListStatus(r.URL.Query().Get("status"))
 	if !ok {
-		writeError(w, http.StatusBadRequest, "invalid_filters", "status must be one of all|draft|published|archived", false, requestIDFromContext(r.Context()))
+		writeError(w, http.StatusBadRequest, "invalid_filters", "status must be one of all|draft|scheduled|published|archived", false, requestIDFromContext(r.Context()))
 		return
 	}
 
@@ -388,6 +405,16 @@ func (s *Server) handleListMoments(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (s *Server) handleGetMoment(w http.ResponseWriter, r *http.Request) {
+	item, err := s.store.GetMomentByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", contentETag(item.Version()))
+	writeJSON(w, http.StatusOK, map[string]any{"item": item})
+}
+
 func (s *Server) handleUpdateMoment(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	var req updateMomentRequest
@@ -417,25 +444,32 @@ func (s *Server) handleUpdateMoment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := s.runWithIdempotency(w, r, map[string]any{"id": id, "payload": req}, func() (any, error) {
+	expectedVersion, ok := ifMatchVersion(r)
+	if !ok {
+		writeVersionConflict(w, r)
+		return
+	}
+
+	if _, err := s.runWithIdempotency(w, r, map[string]any{"id": id, "ifMatch": r.Header.Get("If-Match"), "payload": req}, func() (int, any, error) {
 		item, err := s.store.UpdateMoment(r.Context(), id, store.UpdateMomentInput{
-			Content:        req.Content,
-			Locale:         req.Locale,
-			Visibility:     req.Visibility,
-			Location:       req.Location,
-			Media:          req.Media,
-			Status:         req.Status,
-			CardSpan:       cardSpan,
-			CardSpanSet:    req.CardSpan != nil,
-			PublishedAt:    req.PublishedAt,
-			PublishedAtSet: req.PublishedAt != nil,
-		})
+			Content:         req.Content,
+			Locale:          req.Locale,
+			Visibility:      req.Visibility,
+			Location:        req.Location,
+			Media:           req.Media,
+			Status:          req.Status,
+			CardSpan:        cardSpan,
+			CardSpanSet:     req.CardSpan != nil,
+			PublishedAt:     req.PublishedAt,
+			PublishedAtSet:  req.PublishedAt != nil,
+			UpdatedBy:       ptr(actorKeyID(r)),
+			ExpectedVersion: expectedVersion,
+		}, contentChange(r, "updated"))
 		if err != nil {
-			return nil, err
+			return 0, nil, err
 		}
-		_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "moment.update", "moment", item.ID, nil)
-		s.requestSearchSnapshotRefresh(r, "moment.update")
-		return map[string]any{"item": item}, nil
+		w.Header().Set("ETag", contentETag(item.Version()))
+		return http.StatusOK, map[string]any{"item": item}, nil
 	}); err != nil {
 		writeStoreError(w, r, err)
 	}
@@ -443,37 +477,42 @@ func (s *Server) handleUpdateMoment(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handlePublishMoment(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	item, err := s.store.SetMomentStatus(r.Context(), id, "published")
-	if err != nil {
+	if _, err := s.runWithIdempotency(w, r, nil, func() (int, any, error) {
+		item, err := s.store.SetMomentStatus(r.Context(), id, "published", ptr(actorKeyID(r)), contentChange(r, "published"))
+		if err != nil {
+			return 0, nil, err
+		}
+		w.Header().Set("ETag", contentETag(item.Version()))
+		return http.StatusOK, map[string]any{"item": item}, nil
+	}); err != nil {
 		writeStoreError(w, r, err)
-		return
 	}
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "moment.publish", "moment", item.ID, nil)
-	s.requestSearchSnapshotRefresh(r, "moment.publish")
-	writeJSON(w, http.StatusOK, map[string]any{"item": item})
 }
 
 func (s *Server) handleUnpublishMoment(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	item, err := s.store.SetMomentStatus(r.Context(), id, "draft")
-	if err != nil {
+	if _, err := s.runWithIdempotency(w, r, nil, func() (int, any, error) {
+		item, err := s.store.SetMomentStatus(r.Context(), id, "draft", ptr(actorKeyID(r)), contentChange(r, "unpublished"))
+		if err != nil {
+			return 0, nil, err
+		}
+		w.Header().Set("ETag", contentETag(item.Version()))
+		return http.StatusOK, map[string]any{"item": item}, nil
+	}); err != nil {
 		writeStoreError(w, r, err)
-		return
 	}
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "moment.unpublish", "moment", item.ID, nil)
-	s.requestSearchSnapshotRefresh(r, "moment.unpublish")
-	writeJSON(w, http.StatusOK, map[string]any{"item": item})
 }
 
 func (s *Server) handleDeleteMoment(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	if err := s.store.SoftDeleteMoment(r.Context(), id); err != nil {
+	if _, err := s.runWithIdempotency(w, r, nil, func() (int, any, error) {
+		if err := s.store.SoftDeleteMoment(r.Context(), id, contentChange(r, "deleted")); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusOK, map[string]any{"ok": true}, nil
+	}); err != nil {
 		writeStoreError(w, r, err)
-		return
 	}
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "moment.delete", "moment", id, nil)
-	s.requestSearchSnapshotRefresh(r, "moment.delete")
-	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
 }
 
 type createGalleryRequest struct {
@@ -515,6 +554,7 @@ type updateGalleryRequest struct {
 	IsLivePhoto *bool      `json:"isLivePhoto"`
 	VideoURL    *string    `json:"videoUrl"`
 	Status      *string    `json:"status"`
+	PublishedAt *time.Time `json:"publishedAt"`
 }
 
 func (s *Server) handleCreateGalleryItem(w http.ResponseWriter, r *http.Request) {
@@ -530,7 +570,7 @@ func (s *Server) handleCreateGalleryItem(w http.ResponseWriter, r *http.Request)
 	req.Locale = normalizedLocale(req.Locale)
 	req.Status = normalizedStatus(req.Status)
 
-	if _, err := s.runWithIdempotency(w, r, req, func() (any, error) {
+	if _, err := s.runWithIdempotency(w, r, req, func() (int, any, error) {
 		item, err := s.store.CreateGallery(r.Context(), store.CreateGalleryInput{
 			Locale:      req.Locale,
 			FileURL:     req.FileURL,
@@ -550,18 +590,28 @@ func (s *Server) handleCreateGalleryItem(w http.ResponseWriter, r *http.Request)
 			VideoURL:    trimPtr(req.VideoURL),
 			Status:      req.Status,
 			PublishedAt: req.PublishedAt,
-		})
+			UpdatedBy:   ptr(actorKeyID(r)),
+		}, contentChange(r, "created"))
 		if err != nil {
-			return nil, err
+			return 0, nil, err
 		}
-		_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "gallery.create", "gallery", item.ID, map[string]any{"status": item.Status})
-		s.requestSearchSnapshotRefresh(r, "gallery.create")
-		return map[string]any{"item": item}, nil
+		w.Header().Set("ETag", contentETag(item.Version()))
+		return http.StatusOK, map[string]any{"item": item}, nil
 	}); err != nil {
 		writeStoreError(w, r, err)
 	}
 }
 
+func (s *Server) handleGetGalleryItem(w http.ResponseWriter, r *http.Request) {
+	item, err := s.store.GetGalleryByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", contentETag(item.Version()))
+	writeJSON(w, http.StatusOK, map[string]any{"item": item})
+}
+
 func (s *Server) handleUpdateGalleryItem(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	var req updateGalleryRequest
@@ -578,32 +628,41 @@ func (s *Server) handleUpdateGalleryItem(w http.ResponseWriter, r *http.Request)
 		req.Status = &value
 	}
 
-	if _, err := s.runWithIdempotency(w, r, map[string]any{"id": id, "payload": req}, func() (any, error) {
+	expectedVersion, ok := ifMatchVersion(r)
+	if !ok {
+		writeVersionConflict(w, r)
+		return
+	}
+
+	if _, err := s.runWithIdempotency(w, r, map[string]any{"id": id, "ifMatch": r.Header.Get("If-Match"), "payload": req}, func() (int, any, error) {
 		item, err := s.store.UpdateGallery(r.Context(), id, store.UpdateGalleryInput{
-			Locale:      req.Locale,
-			FileURL:     trimPtr(req.FileURL),
-			ThumbURL:    trimPtr(req.ThumbURL),
-			Title:       trimPtr(req.Title),
-			Width:       req.Width,
-			Height:      req.Height,
-			CapturedAt:  req.CapturedAt,
-			Camera:      trimPtr(req.Camera),
-			Lens:        trimPtr(req.Lens),
-			FocalLength: trimPtr(req.FocalLength),
-			Aperture:    trimPtr(req.Aperture),
-			ISO:         req.ISO,
-			Latitude:    req.Latitude,
-			Longitude:   req.Longitude,
-			IsLivePhoto: req.IsLivePhoto,
-			VideoURL:    trimPtr(req.VideoURL),
-			Status:      req.Status,
-		})
+			Locale:          req.Locale,
+			FileURL:         trimPtr(req.FileURL),
+			ThumbURL:        trimPtr(req.ThumbURL),
+			Title:           trimPtr(req.Title),
+			Width:           req.Width,
+			Height:          req.Height,
+			CapturedAt:      req.CapturedAt,
+			Camera:          trimPtr(req.Camera),
+			Lens:            trimPtr(req.Lens),
+			FocalLength:     trimPtr(req.FocalLength),
+			Aperture:        trimPtr(req.Aperture),
+			ISO:             req.ISO,
+			Latitude:        req.Latitude,
+			Longitude:       req.Longitude,
+			IsLivePhoto:     req.IsLivePhoto,
+			VideoURL:        trimPtr(req.VideoURL),
+			Status:          req.Status,
+			PublishedAt:     req.PublishedAt,
+			PublishedAtSet:  req.PublishedAt != nil,
+			UpdatedBy:       ptr(actorKeyID(r)),
+			ExpectedVersion: expectedVersion,
+		}, contentChange(r, "updated"))
 		if err != nil {
-			return nil, err
+			return 0, nil, err
 		}
-		_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "gallery.update", "gallery", item.ID, nil)
-		s.requestSearchSnapshotRefresh(r, "gallery.update")
-		return map[string]any{"item": item}, nil
+		w.Header().Set("ETag", contentETag(item.Version()))
+		return http.StatusOK, map[string]any{"item": item}, nil
 	}); err != nil {
 		writeStoreError(w, r, err)
 	}
@@ -611,37 +670,42 @@ func (s *Server) handleUpdateGalleryItem(w http.ResponseWriter, r *http.Request)
 
 func (s *Server) handlePublishGalleryItem(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	item, err := s.store.SetGalleryStatus(r.Context(), id, "published")
-	if err != nil {
+	if _, err := s.runWithIdempotency(w, r, nil, func() (int, any, error) {
+		item, err := s.store.SetGalleryStatus(r.Context(), id, "published", ptr(actorKeyID(r)), contentChange(r, "published"))
+		if err != nil {
+			return 0, nil, err
+		}
+		w.Header().Set("ETag", contentETag(item.Version()))
+		return http.StatusOK, map[string]any{"item": item}, nil
+	}); err != nil {
 		writeStoreError(w, r, err)
-		return
 	}
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "gallery.publish", "gallery", item.ID, nil)
-	s.requestSearchSnapshotRefresh(r, "gallery.publish")
-	writeJSON(w, http.StatusOK, map[string]any{"item": item})
 }
 
 func (s *Server) handleUnpublishGalleryItem(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	item, err := s.store.SetGalleryStatus(r.Context(), id, "draft")
-	if err != nil {
+	if _, err := s.runWithIdempotency(w, r, nil, func() (int, any, error) {
+		item, err := s.store.SetGalleryStatus(r.Context(), id, "draft", ptr(actorKeyID(r)), contentChange(r, "unpublished"))
+		if err != nil {
+			return 0, nil, err
+		}
+		w.Header().Set("ETag", contentETag(item.Version()))
+		return http.StatusOK, map[string]any{"item": item}, nil
+	}); err != nil {
 		writeStoreError(w, r, err)
-		return
 	}
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "gallery.unpublish", "gallery", item.ID, nil)
-	s.requestSearchSnapshotRefresh(r, "gallery.unpublish")
-	writeJSON(w, http.StatusOK, map[string]any{"item": item})
 }
 
 func (s *Server) handleDeleteGalleryItem(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	if err := s.store.SoftDeleteGallery(r.Context(), id); err != nil {
+	if _, err := s.runWithIdempotency(w, r, nil, func() (int, any, error) {
+		if err := s.store.SoftDeleteGallery(r.Context(), id, contentChange(r, "deleted")); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusOK, map[string]any{"ok": true}, nil
+	}); err != nil {
 		writeStoreError(w, r, err)
-		return
 	}
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "gallery.delete", "gallery", id, nil)
-	s.requestSearchSnapshotRefresh(r, "gallery.delete")
-	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
 }
 
 func ptr[T any](value T) *T {
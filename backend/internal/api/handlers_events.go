@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tdp-lite/backend/internal/store"
+)
+
+const eventStreamBatchSize = 100
+
+var errInvalidLastEventID = errors.New("Last-Event-ID must be a positive integer")
+
+func parseEventTypes(raw string) ([]string, error) {
+	types := make([]string, 0)
+	for _, eventType := range strings.Split(raw, ",") {
+		eventType = strings.TrimSpace(eventType)
+		if eventType == "" {
+			continue
+		}
+		if err := store.ValidateStreamEventType(eventType); err != nil {
+			return nil, err
+		}
+		types = append(types, eventType)
+	}
+	return types, nil
+}
+
+// eventStreamCursor resumes after Last-Event-ID (or ?lastEventId= for clients
+// that cannot set headers). Without one the stream starts with new events; an
+// id that is no longer in the outbox replays everything still retained.
+func (s *Server) eventStreamCursor(r *http.Request) (store.OutboxCursor, error) {
+	raw := strings.TrimSpace(r.Header.Get("Last-Event-ID"))
+	if raw == "" {
+		raw = strings.TrimSpace(r.URL.Query().Get("lastEventId"))
+	}
+	if raw == "" {
+		return s.store.OutboxHead(r.Context())
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id < 1 {
+		return store.OutboxCursor{}, errInvalidLastEventID
+	}
+	cursor, err := s.store.OutboxCursorAt(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		return store.OutboxCursor{}, nil
+	}
+	return cursor, err
+}
+
+// handleEvents streams outbox events as Server-Sent Events. Each event's id is
+// its outbox id, its name the event type and its data the event as JSON.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	types, err := parseEventTypes(r.URL.Query().Get("types"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_filters", err.Error(), false, requestIDFromContext(r.Context()))
+		return
+	}
+	cursor, err := s.eventStreamCursor(r)
+	if err != nil {
+		if errors.Is(err, errInvalidLastEventID) {
+			writeError(w, http.StatusBadRequest, "invalid_last_event_id", err.Error(), false, requestIDFromContext(r.Context()))
+			return
+		}
+		writeStoreError(w, r, err)
+		return
+	}
+
+	stream, err := startEventStream(w)
+	if err != nil {
+		return
+	}
+
+	poll := time.NewTicker(s.cfg.EventsPollInterval)
+	defer poll.Stop()
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+	maxAge := time.NewTimer(eventStreamMaxAge)
+	defer maxAge.Stop()
+
+	for {
+		events, err := s.store.ListOutboxEvents(r.Context(), cursor, types, eventStreamBatchSize)
+		if err != nil {
+			if r.Context().Err() == nil {
+				log.Printf("event stream read failed request_id=%s err=%v", requestIDFromContext(r.Context()), err)
+			}
+			return
+		}
+		for _, event := range events {
+			if err := stream.send(strconv.FormatInt(event.ID, 10), event.Type, event); err != nil {
+				return
+			}
+			cursor = store.OutboxCursor{TxID: event.TxID, ID: event.ID}
+		}
+		if len(events) > 0 {
+			if err := stream.flush(); err != nil {
+				return
+			}
+			if len(events) == eventStreamBatchSize {
+				continue
+			}
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.streamsDone:
+			return
+		case <-maxAge.C:
+			return
+		case <-heartbeat.C:
+			if err := stream.heartbeat(); err != nil {
+				return
+			}
+		case <-poll.C:
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"tdp-lite/backend/internal/store"
+)
+
+// Job state checks run inside the idempotent section so a retried requeue or
+// apply replays its first response instead of failing on the new state.
+var (
+	errJobNotDead  = errors.New("only dead jobs can be requeued")
+	errJobNotReady = errors.New("job must be succeeded before apply")
+)
+
+func normalizedJobType(input string) (string, bool) {
+	switch strings.TrimSpace(input) {
+	case "", "all":
+		return "all", true
+	case store.JobTypeAI, store.JobTypeThumbnail, store.JobTypeSearchSnapshot, store.JobTypeScheduledPublish, store.JobTypeWebhookDelivery, store.JobTypeOutboxDispatch:
+		return strings.TrimSpace(input), true
+	default:
+		return "", false
+	}
+}
+
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	limit, offset := parsePagination(r, 50, 200)
+	status, ok := normalizedJobListStatus(r.URL.Query().Get("status"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_filters", "status must be one of all|queued|running|succeeded|failed|dead", false, requestIDFromContext(r.Context()))
+		return
+	}
+	jobType, ok := normalizedJobType(r.URL.Query().Get("type"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_filters", "type must be one of all|ai|thumbnail|search_snapshot|scheduled_publish|webhook_delivery|outbox_dispatch", false, requestIDFromContext(r.Context()))
+		return
+	}
+
+	storeStatus := ""
+	if status != "all" {
+		storeStatus = status
+	}
+	storeType := ""
+	if jobType != "all" {
+		storeType = jobType
+	}
+
+	items, err := s.store.ListJobs(r.Context(), storeType, storeStatus, limit, offset)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items":  items,
+		"limit":  limit,
+		"offset": offset,
+		"status": status,
+		"type":   jobType,
+	})
+}
+
+func (s *Server) handleGetGenericJob(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	job, err := s.store.GetJobByID(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	response := map[string]any{
+		"id":     job.ID,
+		"status": job.Status,
+		"kind":   job.Type,
+		"job":    job,
+	}
+	if job.Type == store.JobTypeAI {
+		aiJob, err := s.store.GetAIJobByID(r.Context(), id)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		response["ai"] = aiJob
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleRequeueJob(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := s.runWithIdempotency(w, r, nil, func() (int, any, error) {
+		job, err := s.store.GetJobByID(r.Context(), id)
+		if err != nil {
+			return 0, nil, err
+		}
+		if job.Status != "dead" {
+			return 0, nil, errJobNotDead
+		}
+		item, err := s.store.RequeueDeadJob(r.Context(), id)
+		if err != nil {
+			return 0, nil, err
+		}
+		_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "job.requeue", "job", item.ID, map[string]any{
+			"type":             item.Type,
+			"previousAttempts": job.Attempts,
+			"lastError":        job.LastError,
+		})
+		return http.StatusOK, map[string]any{"job": item}, nil
+	}); err != nil {
+		writeStoreError(w, r, err)
+	}
+}
@@ -3,44 +3,104 @@ package api
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"tdp-lite/backend/internal/auth"
+	"tdp-lite/backend/internal/store"
 	"tdp-lite/backend/internal/utils"
 )
 
 type createKeyRequest struct {
-	Name   string   `json:"name"`
-	Scopes []string `json:"scopes"`
+	Name               string     `json:"name"`
+	Scopes             []string   `json:"scopes"`
+	Algorithm          string     `json:"algorithm"`
+	PublicKey          string     `json:"publicKey"`
+	ExpiresAt          *time.Time `json:"expiresAt"`
+	AllowedCIDRs       []string   `json:"allowedCidrs"`
+	RateLimitPerMinute int        `json:"rateLimitPerMinute"`
 }
 
 type rotateKeyRequest struct {
-	Reason string `json:"reason"`
+	Reason    string `json:"reason"`
+	PublicKey string `json:"publicKey"`
 }
 
-func normalizeScopes(input []string) []string {
-	if len(input) == 0 {
-		return []string{"content:read"}
+// keyLimitsFromRequest validates the optional restrictions on a new key and
+// returns them with the CIDRs in canonical form.
+func keyLimitsFromRequest(req createKeyRequest) (store.APIKeyLimits, string, bool) {
+	limits := store.APIKeyLimits{
+		ExpiresAt:          req.ExpiresAt,
+		AllowedCIDRs:       make([]string, 0, len(req.AllowedCIDRs)),
+		RateLimitPerMinute: req.RateLimitPerMinute,
+	}
+	if limits.ExpiresAt != nil && !limits.ExpiresAt.After(time.Now()) {
+		return store.APIKeyLimits{}, "expiresAt must be in the future", false
+	}
+	if limits.RateLimitPerMinute < 0 {
+		return store.APIKeyLimits{}, "rateLimitPerMinute must be zero (unlimited) or positive", false
 	}
-	result := make([]string, 0, len(input))
 	seen := make(map[string]struct{})
-	for _, scope := range input {
-		scope = strings.TrimSpace(scope)
-		if scope == "" {
-			continue
+	for _, raw := range req.AllowedCIDRs {
+		prefix, err := auth.ParseCIDR(raw)
+		if err != nil {
+			return store.APIKeyLimits{}, "invalid CIDR in allowedCidrs: " + raw, false
 		}
-		if _, exists := seen[scope]; exists {
+		cidr := prefix.String()
+		if _, exists := seen[cidr]; exists {
 			continue
 		}
-		seen[scope] = struct{}{}
-		result = append(result, scope)
+		seen[cidr] = struct{}{}
+		limits.AllowedCIDRs = append(limits.AllowedCIDRs, cidr)
+	}
+	return limits, "", true
+}
+
+// keyCredential prepares the credential for a new or rotated key: a random
+// secret for HMAC keys, the client's parsed public key for Ed25519 keys. The
+// message is set when the request itself is invalid.
+func keyCredential(algorithm, publicKey string) (store.APIKeyCredential, string, error) {
+	switch strings.TrimSpace(algorithm) {
+	case "", store.KeyAlgorithmHMAC:
+		if strings.TrimSpace(publicKey) != "" {
+			return store.APIKeyCredential{}, "publicKey is only accepted for ed25519 keys", nil
+		}
+		secret, err := utils.RandomHex(24)
+		if err != nil {
+			return store.APIKeyCredential{}, "", err
+		}
+		return store.APIKeyCredential{Algorithm: store.KeyAlgorithmHMAC, Secret: secret}, "", nil
+	case store.KeyAlgorithmEd25519:
+		if strings.TrimSpace(publicKey) == "" {
+			return store.APIKeyCredential{}, "publicKey is required for ed25519 keys", nil
+		}
+		parsed, err := auth.ParseEd25519PublicKey(publicKey)
+		if err != nil {
+			return store.APIKeyCredential{}, "invalid publicKey: " + err.Error(), nil
+		}
+		return store.APIKeyCredential{Algorithm: store.KeyAlgorithmEd25519, PublicKey: parsed}, "", nil
+	default:
+		return store.APIKeyCredential{}, "algorithm must be hmac-sha256 or ed25519", nil
+	}
+}
+
+func credentialHash(credential store.APIKeyCredential) string {
+	if credential.Algorithm == store.KeyAlgorithmEd25519 {
+		return sha256Text(credential.PublicKey)
 	}
-	if len(result) == 0 {
-		result = []string{"content:read"}
+	return sha256Text(credential.Secret)
+}
+
+func nilIfEmpty(value string) *string {
+	if value == "" {
+		return nil
 	}
-	return result
+	return &value
 }
 
 func sha256Text(raw string) string {
@@ -48,6 +108,8 @@ func sha256Text(raw string) string {
 	return hex.EncodeToString(sum[:])
 }
 
+// Key create and rotate do not take an Idempotency-Key: their responses carry
+// the new secret, which the idempotency store would keep in plaintext.
 func (s *Server) handleCreateKey(w http.ResponseWriter, r *http.Request) {
 	var req createKeyRequest
 	if err := decodeJSON(r, &req); err != nil {
@@ -58,42 +120,69 @@ func (s *Server) handleCreateKey(w http.ResponseWriter, r *http.Request) {
 	if req.Name == "" {
 		req.Name = "tdp-key"
 	}
-	keySuffix, err := utils.RandomHex(6)
+	scopes, err := auth.NormalizeScopes(req.Scopes)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_scope", err.Error(), false, requestIDFromContext(r.Context()))
+		return
+	}
+	limits, message, ok := keyLimitsFromRequest(req)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_payload", message, false, requestIDFromContext(r.Context()))
+		return
+	}
+	credential, message, err := keyCredential(req.Algorithm, req.PublicKey)
 	if err != nil {
 		writeStoreError(w, r, err)
 		return
 	}
-	secret, err := utils.RandomHex(24)
+	if message != "" {
+		writeError(w, http.StatusBadRequest, "invalid_credential", message, false, requestIDFromContext(r.Context()))
+		return
+	}
+	keySuffix, err := utils.RandomHex(6)
 	if err != nil {
 		writeStoreError(w, r, err)
 		return
 	}
-	keyID := "k_" + keySuffix
-	record, err := s.store.CreateAPIKey(
-		r.Context(),
-		req.Name,
-		keyID,
-		secret,
-		sha256Text(secret),
-		normalizeScopes(req.Scopes),
-	)
+	record, err := s.store.CreateAPIKey(r.Context(), store.CreateAPIKeyInput{
+		Name:       req.Name,
+		KeyID:      "k_" + keySuffix,
+		Credential: credential,
+		KeyHash:    credentialHash(credential),
+		Scopes:     scopes,
+		Limits:     limits,
+	})
 	if err != nil {
 		writeStoreError(w, r, err)
 		return
 	}
 
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "key.create", "api_key", record.KeyID, map[string]any{"name": record.Name})
+	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "key.create", "api_key", record.KeyID, map[string]any{
+		"name":               record.Name,
+		"algorithm":          record.Algorithm,
+		"expiresAt":          record.ExpiresAt,
+		"allowedCidrs":       record.AllowedCIDRs,
+		"rateLimitPerMinute": record.RateLimitPerMinute,
+	})
 
-	writeJSON(w, http.StatusOK, map[string]any{
+	response := map[string]any{
 		"item": map[string]any{
-			"id":        record.ID,
-			"keyId":     record.KeyID,
-			"name":      record.Name,
-			"scopes":    record.Scopes,
-			"createdAt": record.CreatedAt,
+			"id":                 record.ID,
+			"keyId":              record.KeyID,
+			"name":               record.Name,
+			"scopes":             record.Scopes,
+			"algorithm":          record.Algorithm,
+			"publicKey":          nilIfEmpty(record.PublicKey),
+			"createdAt":          record.CreatedAt,
+			"expiresAt":          record.ExpiresAt,
+			"allowedCidrs":       record.AllowedCIDRs,
+			"rateLimitPerMinute": record.RateLimitPerMinute,
 		},
-		"secret": secret,
-	})
+	}
+	if credential.Secret != "" {
+		response["secret"] = credential.Secret
+	}
+	writeJSON(w, http.StatusOK, response)
 }
 
 func (s *Server) handleListKeys(w http.ResponseWriter, r *http.Request) {
@@ -106,13 +195,20 @@ func (s *Server) handleListKeys(w http.ResponseWriter, r *http.Request) {
 	result := make([]map[string]any, 0, len(items))
 	for _, item := range items {
 		result = append(result, map[string]any{
-			"id":         item.ID,
-			"keyId":      item.KeyID,
-			"name":       item.Name,
-			"scopes":     item.Scopes,
-			"createdAt":  item.CreatedAt,
-			"revokedAt":  item.RevokedAt,
-			"lastUsedAt": item.LastUsedAt,
+			"id":                 item.ID,
+			"keyId":              item.KeyID,
+			"name":               item.Name,
+			"scopes":             item.Scopes,
+			"algorithm":          item.Algorithm,
+			"publicKey":          nilIfEmpty(item.PublicKey),
+			"createdAt":          item.CreatedAt,
+			"revokedAt":          item.RevokedAt,
+			"lastUsedAt":         item.LastUsedAt,
+			"expiresAt":          item.ExpiresAt,
+			"allowedCidrs":       item.AllowedCIDRs,
+			"rateLimitPerMinute": item.RateLimitPerMinute,
+			// Set while the secret replaced by the last rotation is still accepted.
+			"previousSecretExpiresAt": item.PreviousSecretExpiresAt,
 		})
 	}
 
@@ -122,27 +218,56 @@ func (s *Server) handleListKeys(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleRotateKey(w http.ResponseWriter, r *http.Request) {
 	keyID := chi.URLParam(r, "id")
 	var req rotateKeyRequest
-	_ = decodeJSON(r, &req)
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid_payload", "invalid rotate payload", false, requestIDFromContext(r.Context()))
+		return
+	}
 
-	secret, err := utils.RandomHex(24)
+	existing, err := s.store.GetAPIKeyByKeyID(r.Context(), keyID)
 	if err != nil {
 		writeStoreError(w, r, err)
 		return
 	}
-	if err := s.store.RotateAPIKey(r.Context(), keyID, secret, sha256Text(secret)); err != nil {
+	credential, message, err := keyCredential(existing.Algorithm, req.PublicKey)
+	if err != nil {
 		writeStoreError(w, r, err)
 		return
 	}
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "key.rotate", "api_key", keyID, map[string]any{"reason": req.Reason})
-	writeJSON(w, http.StatusOK, map[string]any{"keyId": keyID, "secret": secret})
+	if message != "" {
+		writeError(w, http.StatusBadRequest, "invalid_credential", message, false, requestIDFromContext(r.Context()))
+		return
+	}
+	previousExpiresAt, err := s.store.RotateAPIKey(r.Context(), keyID, credential, credentialHash(credential), s.cfg.KeyRotationGrace)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "key.rotate", "api_key", keyID, map[string]any{
+		"reason":                  req.Reason,
+		"previousSecretExpiresAt": previousExpiresAt,
+	})
+	response := map[string]any{
+		"keyId":                   keyID,
+		"algorithm":               credential.Algorithm,
+		"previousSecretExpiresAt": previousExpiresAt,
+	}
+	if credential.Secret != "" {
+		response["secret"] = credential.Secret
+	} else {
+		response["publicKey"] = credential.PublicKey
+	}
+	writeJSON(w, http.StatusOK, response)
 }
 
 func (s *Server) handleRevokeKey(w http.ResponseWriter, r *http.Request) {
 	keyID := chi.URLParam(r, "id")
-	if err := s.store.RevokeAPIKey(r.Context(), keyID); err != nil {
+	if _, err := s.runWithIdempotency(w, r, nil, func() (int, any, error) {
+		if err := s.store.RevokeAPIKey(r.Context(), keyID); err != nil {
+			return 0, nil, err
+		}
+		_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "key.revoke", "api_key", keyID, nil)
+		return http.StatusOK, map[string]any{"ok": true, "keyId": keyID}, nil
+	}); err != nil {
 		writeStoreError(w, r, err)
-		return
 	}
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "key.revoke", "api_key", keyID, nil)
-	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "keyId": keyID})
 }
@@ -111,37 +111,38 @@ func (s *Server) handleCreateMediaUpload(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	objectKey := generateObjectKey(req.Filename)
-	url := strings.TrimRight(s.cfg.S3PublicURL, "/") + "/" + objectKey
-	asset, err := s.store.CreateMediaAsset(r.Context(), store.CreateMediaAssetInput{
-		ObjectKey: objectKey,
-		URL:       url,
-		Mime:      req.MimeType,
-		Size:      req.Size,
-		SHA256:    req.SHA256,
-		Status:    "pending_upload",
-	})
-	if err != nil {
-		writeStoreError(w, r, err)
-		return
-	}
+	if _, err := s.runWithIdempotency(w, r, req, func() (int, any, error) {
+		objectKey := generateObjectKey(req.Filename)
+		url := strings.TrimRight(s.cfg.S3PublicURL, "/") + "/" + objectKey
+		asset, err := s.store.CreateMediaAsset(r.Context(), store.CreateMediaAssetInput{
+			ObjectKey: objectKey,
+			URL:       url,
+			Mime:      req.MimeType,
+			Size:      req.Size,
+			SHA256:    req.SHA256,
+			Status:    "pending_upload",
+		})
+		if err != nil {
+			return 0, nil, err
+		}
 
-	uploadURL, uploadHeaders, err := s.presignUpload(r.Context(), objectKey, req.MimeType)
-	if err != nil {
+		uploadURL, uploadHeaders, err := s.presignUpload(r.Context(), objectKey, req.MimeType)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "media.upload.create", "media_asset", asset.ID, map[string]any{"mimeType": req.MimeType})
+		return http.StatusOK, map[string]any{
+			"uploadId":      asset.ID,
+			"objectKey":     objectKey,
+			"uploadUrl":     uploadURL,
+			"uploadMethod":  "PUT",
+			"uploadHeaders": uploadHeaders,
+			"asset":         asset,
+		}, nil
+	}); err != nil {
 		writeStoreError(w, r, err)
-		return
 	}
-
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "media.upload.create", "media_asset", asset.ID, map[string]any{"mimeType": req.MimeType})
-
-	writeJSON(w, http.StatusOK, map[string]any{
-		"uploadId":      asset.ID,
-		"objectKey":     objectKey,
-		"uploadUrl":     uploadURL,
-		"uploadMethod":  "PUT",
-		"uploadHeaders": uploadHeaders,
-		"asset":         asset,
-	})
 }
 
 func (s *Server) handleCompleteMediaUpload(w http.ResponseWriter, r *http.Request) {
@@ -156,12 +157,23 @@ func (s *Server) handleCompleteMediaUpload(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	asset, err := s.store.CompleteMediaAsset(r.Context(), uploadID, req.Size, strings.TrimSpace(req.SHA256), "uploaded", req.Exif)
-	if err != nil {
+	if _, err := s.runWithIdempotency(w, r, map[string]any{"uploadId": uploadID, "payload": req}, func() (int, any, error) {
+		asset, err := s.store.CompleteMediaAsset(r.Context(), uploadID, req.Size, strings.TrimSpace(req.SHA256), "uploaded", req.Exif)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if mediaKind(asset.Mime) == "image" {
+			_, _ = s.store.EnqueueJob(r.Context(), store.EnqueueJobInput{
+				Type:      store.JobTypeThumbnail,
+				Payload:   map[string]any{"assetId": asset.ID},
+				DedupeKey: asset.ID,
+			})
+		}
+
+		_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "media.upload.complete", "media_asset", asset.ID, nil)
+		return http.StatusOK, map[string]any{"asset": asset}, nil
+	}); err != nil {
 		writeStoreError(w, r, err)
-		return
 	}
-
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "media.upload.complete", "media_asset", asset.ID, nil)
-	writeJSON(w, http.StatusOK, map[string]any{"asset": asset})
 }
@@ -1,8 +1,12 @@
 package api
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,6 +20,78 @@ type upsertPresenceRequest struct {
 	CountryCode *string `json:"countryCode"`
 	Timezone    *string `json:"timezone"`
 	Source      *string `json:"source"`
+	// Privacy settings are kept when omitted.
+	Privacy *presencePrivacyRequest `json:"privacy"`
+}
+
+type presencePrivacyRequest struct {
+	Visibility   *string   `json:"visibility"`
+	Granularity  *string   `json:"granularity"`
+	HiddenFields *[]string `json:"hiddenFields"`
+}
+
+// presencePrivacyInput validates req and fills the privacy fields of input.
+func presencePrivacyInput(req *presencePrivacyRequest, input *store.UpsertPresenceInput) error {
+	if req == nil {
+		return nil
+	}
+	if req.Visibility != nil {
+		switch *req.Visibility {
+		case store.PresenceVisibilityVisible, store.PresenceVisibilityHidden:
+			input.Visibility = req.Visibility
+		default:
+			return fmt.Errorf("privacy.visibility must be one of visible|hidden")
+		}
+	}
+	if req.Granularity != nil {
+		switch *req.Granularity {
+		case store.PresenceGranularityCity, store.PresenceGranularityCountry, store.PresenceGranularityOnline:
+			input.Granularity = req.Granularity
+		default:
+			return fmt.Errorf("privacy.granularity must be one of city|country|online")
+		}
+	}
+	if req.HiddenFields != nil {
+		fields := make([]string, 0, len(*req.HiddenFields))
+		for _, field := range *req.HiddenFields {
+			if !slices.Contains(store.PresenceHideableFields, field) {
+				return fmt.Errorf("privacy.hiddenFields may only contain %s", strings.Join(store.PresenceHideableFields, "|"))
+			}
+			if !slices.Contains(fields, field) {
+				fields = append(fields, field)
+			}
+		}
+		input.HiddenFields = &fields
+	}
+	return nil
+}
+
+// redactPresence clears what item's privacy settings keep off the public
+// endpoints.
+func redactPresence(item store.PresenceStatus) store.PresenceStatus {
+	privacy := item.Privacy
+	switch privacy.Granularity {
+	case store.PresenceGranularityOnline:
+		item.City = ""
+		item.Region = nil
+		item.Country = nil
+		item.CountryCode = nil
+		item.Timezone = nil
+		item.Source = nil
+	case store.PresenceGranularityCountry:
+		item.City = ""
+		item.Region = nil
+	}
+	if privacy.Hides("region") {
+		item.Region = nil
+	}
+	if privacy.Hides("timezone") {
+		item.Timezone = nil
+	}
+	if privacy.Hides("source") {
+		item.Source = nil
+	}
+	return item
 }
 
 func trimOrNil(value *string) *string {
@@ -56,52 +132,182 @@ func presenceLocationLabel(item store.PresenceStatus) string {
 	}
 }
 
-func (s *Server) handlePublicPresence(w http.ResponseWriter, r *http.Request) {
-	item, err := s.store.GetPresence(r.Context())
+func (s *Server) presenceOnlineWindow() time.Duration {
+	if s.cfg.PresenceOnlineWindow <= 0 {
+		return 3 * time.Minute
+	}
+	return s.cfg.PresenceOnlineWindow
+}
+
+// readPublicPresence returns the public presence payload, redacted to the
+// privacy settings. Before the first heartbeat its status is "unknown", and
+// while presence is hidden it is "hidden" with nothing else.
+func (s *Server) readPublicPresence(ctx context.Context) (map[string]any, error) {
+	item, err := s.store.GetPresence(ctx)
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
-			writeJSON(w, http.StatusOK, map[string]any{
-				"item": map[string]any{
-					"online":          false,
-					"status":          "unknown",
-					"locationLabel":   "",
-					"lastHeartbeatAt": nil,
-					"updatedAt":       nil,
-				},
-			})
-			return
+			return map[string]any{
+				"online":          false,
+				"status":          "unknown",
+				"locationLabel":   "",
+				"lastHeartbeatAt": nil,
+				"updatedAt":       nil,
+			}, nil
 		}
-		writeStoreError(w, r, err)
-		return
+		return nil, err
 	}
-
-	onlineWindow := s.cfg.PresenceOnlineWindow
-	if onlineWindow <= 0 {
-		onlineWindow = 3 * time.Minute
+	if item.Privacy.Visibility == store.PresenceVisibilityHidden {
+		return map[string]any{
+			"online":          false,
+			"status":          "hidden",
+			"locationLabel":   "",
+			"lastHeartbeatAt": nil,
+			"updatedAt":       nil,
+		}, nil
 	}
+	item = redactPresence(item)
 
+	onlineWindow := s.presenceOnlineWindow()
 	isOnline := time.Since(item.LastHeartbeatAt) <= onlineWindow
 	status := "offline"
 	if isOnline {
 		status = "online"
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{
-		"item": map[string]any{
-			"online":          isOnline,
-			"status":          status,
-			"city":            item.City,
-			"region":          item.Region,
-			"country":         item.Country,
-			"countryCode":     item.CountryCode,
-			"timezone":        item.Timezone,
-			"source":          item.Source,
-			"locationLabel":   presenceLocationLabel(item),
-			"lastHeartbeatAt": item.LastHeartbeatAt,
-			"updatedAt":       item.UpdatedAt,
-			"staleAfterSec":   int(onlineWindow.Seconds()),
-		},
-	})
+	return map[string]any{
+		"online":          isOnline,
+		"status":          status,
+		"city":            trimOrNil(&item.City),
+		"region":          item.Region,
+		"country":         item.Country,
+		"countryCode":     item.CountryCode,
+		"timezone":        item.Timezone,
+		"source":          item.Source,
+		"locationLabel":   presenceLocationLabel(item),
+		"lastHeartbeatAt": item.LastHeartbeatAt,
+		"updatedAt":       item.UpdatedAt,
+		"staleAfterSec":   int(onlineWindow.Seconds()),
+	}, nil
+}
+
+func (s *Server) handlePublicPresence(w http.ResponseWriter, r *http.Request) {
+	item, err := s.readPublicPresence(r.Context())
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"item": item})
+}
+
+// handlePublicPresenceStream pushes a "presence" event with the public
+// presence payload when the stream opens and again whenever any public field
+// changes, so clients see the switch to offline once
+// TDP_PRESENCE_ONLINE_WINDOW passes without a heartbeat. All streams share
+// one poller (see presenceHub).
+func (s *Server) handlePublicPresenceStream(w http.ResponseWriter, r *http.Request) {
+	item, updates, unsubscribe, err := s.presence.subscribe(r.Context())
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	defer unsubscribe()
+
+	stream, err := startEventStream(w)
+	if err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+	maxAge := time.NewTimer(eventStreamMaxAge)
+	defer maxAge.Stop()
+
+	if err := stream.send("", "presence", item); err != nil {
+		return
+	}
+	if err := stream.flush(); err != nil {
+		return
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.streamsDone:
+			return
+		case <-maxAge.C:
+			return
+		case <-heartbeat.C:
+			if err := stream.heartbeat(); err != nil {
+				return
+			}
+		case item := <-updates:
+			if err := stream.send("", "presence", item); err != nil {
+				return
+			}
+			if err := stream.flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handlePublicPresenceHistory lists the cities visited in the last ?days=
+// days (default 30), newest first, at the current privacy granularity. The
+// list is empty while presence is hidden or online-only.
+func (s *Server) handlePublicPresenceHistory(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if raw := strings.TrimSpace(r.URL.Query().Get("days")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > presenceHistoryMaxDays {
+			writeError(w, http.StatusBadRequest, "invalid_filters", "days must be between 1 and 365", false, requestIDFromContext(r.Context()))
+			return
+		}
+		days = parsed
+	}
+	limit, _ := parsePagination(r, 50, presenceHistoryMaxItems)
+
+	visits, err := s.presenceHistory.get(r.Context(), s.loadPublicPresenceVisits)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -days).Truncate(time.Hour)
+	items := make([]store.PresenceVisit, 0, min(limit, len(visits)))
+	for _, visit := range visits {
+		if len(items) == limit || visit.LastSeenAt.Before(since) {
+			break
+		}
+		items = append(items, visit)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// loadPublicPresenceVisits reads the longest public timeline, redacted to the
+// current privacy settings, for presenceHistoryCache.
+func (s *Server) loadPublicPresenceVisits(ctx context.Context) ([]store.PresenceVisit, error) {
+	presence, err := s.store.GetPresence(ctx)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return []store.PresenceVisit{}, nil
+		}
+		return nil, err
+	}
+	if !presence.Privacy.ShowsLocation() {
+		return []store.PresenceVisit{}, nil
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -presenceHistoryMaxDays)
+	items, err := s.store.ListPresenceVisits(ctx, since, presence.Privacy.Granularity, presenceHistoryMaxItems)
+	if err != nil {
+		return nil, err
+	}
+	if presence.Privacy.Hides("region") {
+		for i := range items {
+			items[i].Region = nil
+		}
+	}
+	return items, nil
 }
 
 func (s *Server) handleUpsertPresence(w http.ResponseWriter, r *http.Request) {
@@ -117,45 +323,50 @@ func (s *Server) handleUpsertPresence(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	region := trimOrNil(req.Region)
-	country := trimOrNil(req.Country)
-	countryCode := trimOrNil(req.CountryCode)
-	timezone := trimOrNil(req.Timezone)
-	source := trimOrNil(req.Source)
-
-	item, err := s.store.UpsertPresence(r.Context(), store.UpsertPresenceInput{
-		City:        city,
-		Region:      region,
-		Country:     country,
-		CountryCode: countryCode,
-		Timezone:    timezone,
-		Source:      source,
-		HeartbeatAt: time.Now().UTC(),
-	})
-	if err != nil {
-		writeStoreError(w, r, err)
+	input := store.UpsertPresenceInput{City: city}
+	if err := presencePrivacyInput(req.Privacy, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_payload", err.Error(), false, requestIDFromContext(r.Context()))
 		return
 	}
 
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "presence.heartbeat", "presence", "singleton", map[string]any{
-		"city":        item.City,
-		"countryCode": item.CountryCode,
-		"source":      item.Source,
-	})
-
-	writeJSON(w, http.StatusOK, map[string]any{
-		"item": map[string]any{
-			"online":          true,
-			"status":          "online",
-			"city":            item.City,
-			"region":          item.Region,
-			"country":         item.Country,
-			"countryCode":     item.CountryCode,
-			"timezone":        item.Timezone,
-			"source":          item.Source,
-			"locationLabel":   presenceLocationLabel(item),
-			"lastHeartbeatAt": item.LastHeartbeatAt,
-			"updatedAt":       item.UpdatedAt,
-		},
-	})
+	if _, err := s.runWithIdempotency(w, r, req, func() (int, any, error) {
+		input.Region = trimOrNil(req.Region)
+		input.Country = trimOrNil(req.Country)
+		input.CountryCode = trimOrNil(req.CountryCode)
+		input.Timezone = trimOrNil(req.Timezone)
+		input.Source = trimOrNil(req.Source)
+		input.HeartbeatAt = time.Now().UTC()
+
+		item, err := s.store.UpsertPresence(r.Context(), input)
+		if err != nil {
+			return 0, nil, err
+		}
+		s.presenceHistory.invalidate()
+
+		_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "presence.heartbeat", "presence", "singleton", map[string]any{
+			"city":        item.City,
+			"countryCode": item.CountryCode,
+			"source":      item.Source,
+			"visibility":  item.Privacy.Visibility,
+			"granularity": item.Privacy.Granularity,
+		})
+		return http.StatusOK, map[string]any{
+			"item": map[string]any{
+				"online":          true,
+				"status":          "online",
+				"city":            item.City,
+				"region":          item.Region,
+				"country":         item.Country,
+				"countryCode":     item.CountryCode,
+				"timezone":        item.Timezone,
+				"source":          item.Source,
+				"locationLabel":   presenceLocationLabel(item),
+				"lastHeartbeatAt": item.LastHeartbeatAt,
+				"updatedAt":       item.UpdatedAt,
+				"privacy":         item.Privacy,
+			},
+		}, nil
+	}); err != nil {
+		writeStoreError(w, r, err)
+	}
 }
@@ -124,33 +124,35 @@ func (s *Server) handleUpsertPreviewSession(w http.ResponseWriter, r *http.Reque
 		payload = built
 	}
 
-	sessionID := ""
-	if req.SessionID != nil {
-		sessionID = strings.TrimSpace(*req.SessionID)
-	}
-	expiresAt := time.Now().UTC().Add(s.cfg.PreviewTTL)
-	record, err := s.store.UpsertPreviewSession(r.Context(), sessionID, payload, expiresAt)
-	if err != nil {
-		writeStoreError(w, r, err)
-		return
-	}
-
-	signature := auth.SignPreview(s.cfg.PreviewSecret, record.ID, record.ExpiresAt)
-	query := url.Values{}
-	query.Set("sid", record.ID)
-	query.Set("exp", strconv.FormatInt(record.ExpiresAt.UnixMilli(), 10))
-	query.Set("sig", signature)
+	if _, err := s.runWithIdempotency(w, r, req, func() (int, any, error) {
+		sessionID := ""
+		if req.SessionID != nil {
+			sessionID = strings.TrimSpace(*req.SessionID)
+		}
+		expiresAt := time.Now().UTC().Add(s.cfg.PreviewTTL)
+		record, err := s.store.UpsertPreviewSession(r.Context(), sessionID, payload, expiresAt)
+		if err != nil {
+			return 0, nil, err
+		}
 
-	baseURL := strings.TrimRight(s.cfg.AppBaseURL, "/")
-	cardURL := baseURL + "/preview/card?" + query.Encode()
-	detailURL := baseURL + "/preview/detail?" + query.Encode()
+		signature := auth.SignPreview(s.cfg.PreviewSecret, record.ID, record.ExpiresAt)
+		query := url.Values{}
+		query.Set("sid", record.ID)
+		query.Set("exp", strconv.FormatInt(record.ExpiresAt.UnixMilli(), 10))
+		query.Set("sig", signature)
 
-	writeJSON(w, http.StatusOK, map[string]any{
-		"sessionId":        record.ID,
-		"expiresAt":        record.ExpiresAt,
-		"cardPreviewUrl":   cardURL,
-		"detailPreviewUrl": detailURL,
-	})
+		baseURL := strings.TrimRight(s.cfg.AppBaseURL, "/")
+		cardURL := baseURL + "/preview/card?" + query.Encode()
+		detailURL := baseURL + "/preview/detail?" + query.Encode()
+		return http.StatusOK, map[string]any{
+			"sessionId":        record.ID,
+			"expiresAt":        record.ExpiresAt,
+			"cardPreviewUrl":   cardURL,
+			"detailPreviewUrl": detailURL,
+		}, nil
+	}); err != nil {
+		writeStoreError(w, r, err)
+	}
 }
 
 func (s *Server) handleGetPreviewPayload(w http.ResponseWriter, r *http.Request) {
@@ -65,32 +65,34 @@ func (s *Server) handleUpsertProfileSnapshot(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	input := store.UpsertProfileSnapshotInput{SyncedAt: req.SyncedAt}
-	if req.Github != nil {
-		input.Github = &req.Github
-	}
-	if req.Music != nil {
-		input.Music = &req.Music
-	}
-	if req.Derived != nil {
-		input.Derived = &req.Derived
-	}
-	if req.SourceStatus != nil {
-		input.SourceStatus = &req.SourceStatus
-	}
+	if _, err := s.runWithIdempotency(w, r, req, func() (int, any, error) {
+		input := store.UpsertProfileSnapshotInput{SyncedAt: req.SyncedAt}
+		if req.Github != nil {
+			input.Github = &req.Github
+		}
+		if req.Music != nil {
+			input.Music = &req.Music
+		}
+		if req.Derived != nil {
+			input.Derived = &req.Derived
+		}
+		if req.SourceStatus != nil {
+			input.SourceStatus = &req.SourceStatus
+		}
 
-	item, err := s.store.UpsertProfileSnapshot(r.Context(), input)
-	if err != nil {
+		item, err := s.store.UpsertProfileSnapshot(r.Context(), input)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "profile_snapshot.sync", "profile_snapshot", "singleton", map[string]any{
+			"hasGithub":   req.Github != nil,
+			"hasMusic":    req.Music != nil,
+			"hasDerived":  req.Derived != nil,
+			"hasSyncedAt": req.SyncedAt != nil,
+		})
+		return http.StatusOK, map[string]any{"item": profileSnapshotPayload(item)}, nil
+	}); err != nil {
 		writeStoreError(w, r, err)
-		return
 	}
-
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "profile_snapshot.sync", "profile_snapshot", "singleton", map[string]any{
-		"hasGithub":   req.Github != nil,
-		"hasMusic":    req.Music != nil,
-		"hasDerived":  req.Derived != nil,
-		"hasSyncedAt": req.SyncedAt != nil,
-	})
-
-	writeJSON(w, http.StatusOK, map[string]any{"item": profileSnapshotPayload(item)})
 }
@@ -0,0 +1,330 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"tdp-lite/backend/internal/store"
+)
+
+// revisionSource adapts one content kind's store methods for the shared
+// revision handlers.
+type revisionSource struct {
+	kind     string
+	current  func(ctx context.Context, id string) (any, int, error)
+	revision func(ctx context.Context, id string, revision int) (store.ContentRevision, any, error)
+	restore  func(ctx context.Context, id string, revision int, updatedBy *string, change store.ContentChange) (any, error)
+}
+
+func (s *Server) revisionSource(kind string) revisionSource {
+	switch kind {
+	case "moment":
+		return revisionSource{
+			kind: kind,
+			current: func(ctx context.Context, id string) (any, int, error) {
+				item, err := s.store.GetMomentByID(ctx, id)
+				return item, item.Revision, err
+			},
+			revision: func(ctx context.Context, id string, revision int) (store.ContentRevision, any, error) {
+				meta, item, err := s.store.GetMomentRevision(ctx, id, revision)
+				return meta, item, err
+			},
+			restore: func(ctx context.Context, id string, revision int, updatedBy *string, change store.ContentChange) (any, error) {
+				return s.store.RestoreMomentRevision(ctx, id, revision, updatedBy, change)
+			},
+		}
+	case "gallery":
+		return revisionSource{
+			kind: kind,
+			current: func(ctx context.Context, id string) (any, int, error) {
+				item, err := s.store.GetGalleryByID(ctx, id)
+				return item, item.Revision, err
+			},
+			revision: func(ctx context.Context, id string, revision int) (store.ContentRevision, any, error) {
+				meta, item, err := s.store.GetGalleryRevision(ctx, id, revision)
+				return meta, item, err
+			},
+			restore: func(ctx context.Context, id string, revision int, updatedBy *string, change store.ContentChange) (any, error) {
+				return s.store.RestoreGalleryRevision(ctx, id, revision, updatedBy, change)
+			},
+		}
+	default:
+		return revisionSource{
+			kind: "post",
+			current: func(ctx context.Context, id string) (any, int, error) {
+				item, err := s.store.GetPostByID(ctx, id)
+				return item, item.Revision, err
+			},
+			revision: func(ctx context.Context, id string, revision int) (store.ContentRevision, any, error) {
+				meta, item, err := s.store.GetPostRevision(ctx, id, revision)
+				return meta, item, err
+			},
+			restore: func(ctx context.Context, id string, revision int, updatedBy *string, change store.ContentChange) (any, error) {
+				return s.store.RestorePostRevision(ctx, id, revision, updatedBy, change)
+			},
+		}
+	}
+}
+
+func revisionFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	revision, err := strconv.Atoi(chi.URLParam(r, "revision"))
+	if err != nil || revision < 1 {
+		writeError(w, http.StatusBadRequest, "invalid_revision", "revision must be a positive integer", false, requestIDFromContext(r.Context()))
+		return 0, false
+	}
+	return revision, true
+}
+
+func (s *Server) handleListRevisions(kind string) http.HandlerFunc {
+	source := s.revisionSource(kind)
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		limit, offset := parsePagination(r, 50, 200)
+		_, currentRevision, err := source.current(r.Context(), id)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		items, err := s.store.ListContentRevisions(r.Context(), source.kind, id, limit, offset)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"items":           items,
+			"currentRevision": currentRevision,
+			"limit":           limit,
+			"offset":          offset,
+		})
+	}
+}
+
+func (s *Server) handleGetRevision(kind string) http.HandlerFunc {
+	source := s.revisionSource(kind)
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		revision, ok := revisionFromPath(w, r)
+		if !ok {
+			return
+		}
+		current, currentRevision, err := source.current(r.Context(), id)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		meta, item, err := source.revision(r.Context(), id, revision)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		diff, err := diffContent(item, current)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"revision":        meta,
+			"item":            item,
+			"currentRevision": currentRevision,
+			"diff":            diff,
+		})
+	}
+}
+
+func (s *Server) handleRestoreRevision(kind string) http.HandlerFunc {
+	source := s.revisionSource(kind)
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		revision, ok := revisionFromPath(w, r)
+		if !ok {
+			return
+		}
+		if _, err := s.runWithIdempotency(w, r, nil, func() (int, any, error) {
+			item, err := source.restore(r.Context(), id, revision, ptr(actorKeyID(r)), contentChange(r, "restored"))
+			if err != nil {
+				return 0, nil, err
+			}
+			if versioned, ok := item.(interface{ Version() store.ContentVersion }); ok {
+				w.Header().Set("ETag", contentETag(versioned.Version()))
+			}
+			return http.StatusOK, map[string]any{"item": item}, nil
+		}); err != nil {
+			writeStoreError(w, r, err)
+		}
+	}
+}
+
+// Fields every save changes; they are reported on the revision, not diffed.
+var revisionDiffSkippedFields = map[string]bool{
+	"id":             true,
+	"translationKey": true,
+	"createdAt":      true,
+	"updatedAt":      true,
+	"revision":       true,
+}
+
+type fieldDiff struct {
+	Field string     `json:"field"`
+	Lines []diffLine `json:"lines"`
+}
+
+type diffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// diffContent compares two versions of the same item field by field, as they
+// serialize in the API, and returns a line diff (from -> to) for each field
+// that changed.
+func diffContent(from, to any) ([]fieldDiff, error) {
+	fromFields, err := diffableFields(from)
+	if err != nil {
+		return nil, err
+	}
+	toFields, err := diffableFields(to)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(fromFields)+len(toFields))
+	for name := range fromFields {
+		names = append(names, name)
+	}
+	for name := range toFields {
+		if _, ok := fromFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	diffs := make([]fieldDiff, 0)
+	for _, name := range names {
+		if fromFields[name] == toFields[name] {
+			continue
+		}
+		diffs = append(diffs, fieldDiff{
+			Field: name,
+			Lines: diffLines(splitLines(fromFields[name]), splitLines(toFields[name])),
+		})
+	}
+	return diffs, nil
+}
+
+func diffableFields(item any) (map[string]string, error) {
+	raw, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]any
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(values))
+	for name, value := range values {
+		if revisionDiffSkippedFields[name] {
+			continue
+		}
+		switch typed := value.(type) {
+		case nil:
+			fields[name] = ""
+		case string:
+			fields[name] = typed
+		default:
+			text, err := json.MarshalIndent(typed, "", "  ")
+			if err != nil {
+				return nil, err
+			}
+			fields[name] = string(text)
+		}
+	}
+	return fields, nil
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+}
+
+// diffMaxCells bounds the LCS table diffLines allocates, at 4 bytes a cell.
+// Past it, the changed lines are reported as deleted and re-inserted rather
+// than aligned line by line.
+const diffMaxCells = 1 << 21
+
+// diffLines is a longest-common-subsequence line diff. Lines shared at the
+// start and end are matched first, so only the changed middle is compared.
+func diffLines(from, to []string) []diffLine {
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix && from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]diffLine, 0, max(len(from), len(to)))
+	for _, text := range from[:prefix] {
+		lines = append(lines, diffLine{Op: "equal", Text: text})
+	}
+	lines = appendChangedLines(lines, from[prefix:len(from)-suffix], to[prefix:len(to)-suffix])
+	for _, text := range from[len(from)-suffix:] {
+		lines = append(lines, diffLine{Op: "equal", Text: text})
+	}
+	return lines
+}
+
+func appendChangedLines(lines []diffLine, from, to []string) []diffLine {
+	width := len(to) + 1
+	if (len(from)+1)*width > diffMaxCells {
+		for _, text := range from {
+			lines = append(lines, diffLine{Op: "delete", Text: text})
+		}
+		for _, text := range to {
+			lines = append(lines, diffLine{Op: "insert", Text: text})
+		}
+		return lines
+	}
+
+	// lcs[i*width+j] is the LCS length of from[i:] and to[j:].
+	lcs := make([]int32, (len(from)+1)*width)
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i*width+j] = lcs[(i+1)*width+j+1] + 1
+			} else {
+				lcs[i*width+j] = max(lcs[(i+1)*width+j], lcs[i*width+j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case from[i] == to[j]:
+			lines = append(lines, diffLine{Op: "equal", Text: from[i]})
+			i++
+			j++
+		case lcs[(i+1)*width+j] >= lcs[i*width+j+1]:
+			lines = append(lines, diffLine{Op: "delete", Text: from[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{Op: "insert", Text: to[j]})
+			j++
+		}
+	}
+	for ; i < len(from); i++ {
+		lines = append(lines, diffLine{Op: "delete", Text: from[i]})
+	}
+	for ; j < len(to); j++ {
+		lines = append(lines, diffLine{Op: "insert", Text: to[j]})
+	}
+	return lines
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		from []string
+		to   []string
+		want []diffLine
+	}{
+		{
+			name: "both empty",
+			from: []string{},
+			to:   []string{},
+			want: []diffLine{},
+		},
+		{
+			name: "from empty",
+			from: []string{},
+			to:   []string{"a", "b"},
+			want: []diffLine{{"insert", "a"}, {"insert", "b"}},
+		},
+		{
+			name: "to empty",
+			from: []string{"a", "b"},
+			to:   []string{},
+			want: []diffLine{{"delete", "a"}, {"delete", "b"}},
+		},
+		{
+			name: "identical",
+			from: []string{"a", "b", "c"},
+			to:   []string{"a", "b", "c"},
+			want: []diffLine{{"equal", "a"}, {"equal", "b"}, {"equal", "c"}},
+		},
+		{
+			name: "changed middle line",
+			from: []string{"a", "b", "c"},
+			to:   []string{"a", "x", "c"},
+			want: []diffLine{{"equal", "a"}, {"delete", "b"}, {"insert", "x"}, {"equal", "c"}},
+		},
+		{
+			name: "aligned inside the changed part",
+			from: []string{"a", "b", "c", "d"},
+			to:   []string{"x", "b", "y", "d"},
+			want: []diffLine{{"delete", "a"}, {"insert", "x"}, {"equal", "b"}, {"delete", "c"}, {"insert", "y"}, {"equal", "d"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffLines(tt.from, tt.to); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffLines(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesCapped(t *testing.T) {
+	// 1500 changed lines on each side need more than diffMaxCells LCS cells.
+	const changed = 1500
+	from := []string{"head"}
+	to := []string{"head"}
+	for i := 0; i < changed; i++ {
+		from = append(from, fmt.Sprintf("old %d", i))
+		to = append(to, fmt.Sprintf("new %d", i))
+	}
+	// One line in common that a full LCS would align; the fallback does not.
+	from = append(from, "shared", "tail")
+	to = append(to, "shared", "tail")
+	from[changed/2], to[changed/2+1] = "moved", "moved"
+
+	got := diffLines(from, to)
+	if len(got) != 2*changed+3 {
+		t.Fatalf("diffLines returned %d lines, want %d", len(got), 2*changed+3)
+	}
+	if got[0] != (diffLine{"equal", "head"}) {
+		t.Errorf("first line = %v, want the shared prefix", got[0])
+	}
+	for i, line := range got[1 : 1+changed] {
+		if line.Op != "delete" || line.Text != from[1+i] {
+			t.Fatalf("line %d = %v, want delete %q", 1+i, line, from[1+i])
+		}
+	}
+	for i, line := range got[1+changed : 1+2*changed] {
+		if line.Op != "insert" || line.Text != to[1+i] {
+			t.Fatalf("line %d = %v, want insert %q", 1+changed+i, line, to[1+i])
+		}
+	}
+	if tail := got[len(got)-2:]; !reflect.DeepEqual(tail, []diffLine{{"equal", "shared"}, {"equal", "tail"}}) {
+		t.Errorf("last lines = %v, want the shared suffix", tail)
+	}
+}
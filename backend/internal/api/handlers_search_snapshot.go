@@ -11,7 +11,7 @@ import (
 
 func emptySearchSnapshot(locale string) map[string]any {
 	return map[string]any{
-		"schemaVersion": 1,
+		"schemaVersion": store.SearchSnapshotSchemaVersion,
 		"generatedAt":   nil,
 		"locale":        locale,
 		"counts": map[string]any{
@@ -87,23 +87,25 @@ func (s *Server) handleUpsertSearchSnapshot(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	item, err := s.store.UpsertSearchSnapshot(r.Context(), store.UpsertSearchSnapshotInput{
-		Locale:      locale,
-		Snapshot:    snapshot,
-		GeneratedAt: generatedAt,
-	})
-	if err != nil {
+	if _, err := s.runWithIdempotency(w, r, snapshot, func() (int, any, error) {
+		item, err := s.store.UpsertSearchSnapshot(r.Context(), store.UpsertSearchSnapshotInput{
+			Locale:      locale,
+			Snapshot:    snapshot,
+			GeneratedAt: generatedAt,
+		})
+		if err != nil {
+			return 0, nil, err
+		}
+
+		_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "search_snapshot.sync", "search_snapshot", locale, map[string]any{
+			"locale":      locale,
+			"generatedAt": generatedAt,
+			"itemCount":   len(asSlice(snapshot["items"])),
+		})
+		return http.StatusOK, map[string]any{"item": searchSnapshotPayload(item)}, nil
+	}); err != nil {
 		writeStoreError(w, r, err)
-		return
 	}
-
-	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "search_snapshot.sync", "search_snapshot", locale, map[string]any{
-		"locale":      locale,
-		"generatedAt": generatedAt,
-		"itemCount":   len(asSlice(snapshot["items"])),
-	})
-
-	writeJSON(w, http.StatusOK, map[string]any{"item": searchSnapshotPayload(item)})
 }
 
 func asSlice(value any) []any {
@@ -115,13 +117,14 @@ func asSlice(value any) []any {
 }
 
 func searchSnapshotRefreshStatePayload(item store.SearchSnapshotRefreshState) map[string]any {
-	hasPending := item.RequestedAt != nil && (item.ProcessedAt == nil || item.RequestedAt.After(*item.ProcessedAt))
 	return map[string]any{
-		"requestedAt": item.RequestedAt,
-		"processedAt": item.ProcessedAt,
-		"updatedAt":   item.UpdatedAt,
-		"createdAt":   item.CreatedAt,
-		"hasPending":  hasPending,
+		"requestedAt":         item.RequestedAt,
+		"processedAt":         item.ProcessedAt,
+		"requestedGeneration": item.RequestedGeneration,
+		"processedGeneration": item.ProcessedGeneration,
+		"updatedAt":           item.UpdatedAt,
+		"createdAt":           item.CreatedAt,
+		"hasPending":          item.Pending(),
 	}
 }
 
@@ -131,11 +134,13 @@ func (s *Server) handleGetSearchSnapshotRefreshStatus(w http.ResponseWriter, r *
 		if errors.Is(err, store.ErrNotFound) {
 			writeJSON(w, http.StatusOK, map[string]any{
 				"item": map[string]any{
-					"requestedAt": nil,
-					"processedAt": nil,
-					"updatedAt":   nil,
-					"createdAt":   nil,
-					"hasPending":  false,
+					"requestedAt":         nil,
+					"processedAt":         nil,
+					"requestedGeneration": 0,
+					"processedGeneration": 0,
+					"updatedAt":           nil,
+					"createdAt":           nil,
+					"hasPending":          false,
 				},
 			})
 			return
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"tdp-lite/backend/internal/store"
+	"tdp-lite/backend/internal/utils"
+)
+
+type createWebhookRequest struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description *string  `json:"description"`
+}
+
+type updateWebhookRequest struct {
+	URL         *string   `json:"url"`
+	Events      *[]string `json:"events"`
+	Description *string   `json:"description"`
+	Active      *bool     `json:"active"`
+}
+
+// normalizeWebhookURL accepts absolute http(s) URLs whose host resolves only
+// to public addresses, so a subscription cannot point deliveries (and their
+// logged responses) at internal services. tdp-worker checks the address again
+// when it dials, in case DNS changes in between.
+func normalizeWebhookURL(ctx context.Context, raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return "", fmt.Errorf("url must be an absolute http or https URL")
+	}
+	host := parsed.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !utils.IsPublicIP(ip) {
+			return "", fmt.Errorf("url must not point at a private, loopback or link-local address")
+		}
+		return raw, nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return "", fmt.Errorf("url host %s does not resolve", host)
+	}
+	for _, addr := range addrs {
+		if !utils.IsPublicIP(addr.IP) {
+			return "", fmt.Errorf("url must not point at a private, loopback or link-local address")
+		}
+	}
+	return raw, nil
+}
+
+func normalizeWebhookEvents(events []string) ([]string, error) {
+	seen := make(map[string]bool, len(events))
+	normalized := make([]string, 0, len(events))
+	for _, event := range events {
+		event = strings.TrimSpace(event)
+		if event == "" || seen[event] {
+			continue
+		}
+		if err := store.ValidateWebhookEvent(event); err != nil {
+			return nil, err
+		}
+		seen[event] = true
+		normalized = append(normalized, event)
+	}
+	if len(normalized) == 0 {
+		return nil, fmt.Errorf("at least one event is required")
+	}
+	return normalized, nil
+}
+
+// Webhook create does not take an Idempotency-Key: like key create, its
+// response carries the signing secret.
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req createWebhookRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_payload", "invalid webhook payload", false, requestIDFromContext(r.Context()))
+		return
+	}
+	targetURL, err := normalizeWebhookURL(r.Context(), req.URL)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_payload", err.Error(), false, requestIDFromContext(r.Context()))
+		return
+	}
+	events, err := normalizeWebhookEvents(req.Events)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_payload", err.Error(), false, requestIDFromContext(r.Context()))
+		return
+	}
+	secret, err := utils.RandomHex(32)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	item, err := s.store.CreateWebhookSubscription(r.Context(), store.CreateWebhookSubscriptionInput{
+		URL:         targetURL,
+		Events:      events,
+		Description: trimPtr(req.Description),
+		Secret:      secret,
+		CreatedBy:   actorKeyID(r),
+	})
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "webhook.create", "webhook", item.ID, map[string]any{
+		"url":    item.URL,
+		"events": item.Events,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"item": item, "secret": secret})
+}
+
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	items, err := s.store.ListWebhookSubscriptions(r.Context())
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (s *Server) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	item, err := s.store.GetWebhookSubscription(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"item": item})
+}
+
+func (s *Server) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req updateWebhookRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_payload", "invalid webhook payload", false, requestIDFromContext(r.Context()))
+		return
+	}
+	input := store.UpdateWebhookSubscriptionInput{
+		Description: req.Description,
+		Active:      req.Active,
+	}
+	if req.URL != nil {
+		targetURL, err := normalizeWebhookURL(r.Context(), *req.URL)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_payload", err.Error(), false, requestIDFromContext(r.Context()))
+			return
+		}
+		input.URL = &targetURL
+	}
+	if req.Events != nil {
+		events, err := normalizeWebhookEvents(*req.Events)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_payload", err.Error(), false, requestIDFromContext(r.Context()))
+			return
+		}
+		input.Events = &events
+	}
+
+	if _, err := s.runWithIdempotency(w, r, map[string]any{"id": id, "payload": req}, func() (int, any, error) {
+		item, err := s.store.UpdateWebhookSubscription(r.Context(), id, input)
+		if err != nil {
+			return 0, nil, err
+		}
+		_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "webhook.update", "webhook", item.ID, map[string]any{
+			"url":    item.URL,
+			"events": item.Events,
+			"active": item.Active,
+		})
+		return http.StatusOK, map[string]any{"item": item}, nil
+	}); err != nil {
+		writeStoreError(w, r, err)
+	}
+}
+
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := s.runWithIdempotency(w, r, nil, func() (int, any, error) {
+		if err := s.store.DeleteWebhookSubscription(r.Context(), id); err != nil {
+			return 0, nil, err
+		}
+		_ = s.store.InsertAuditLog(r.Context(), actorKeyID(r), "webhook.delete", "webhook", id, nil)
+		return http.StatusOK, map[string]any{"ok": true}, nil
+	}); err != nil {
+		writeStoreError(w, r, err)
+	}
+}
+
+func (s *Server) handleListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit, offset := parsePagination(r, 50, 200)
+	items, err := s.store.ListWebhookDeliveries(r.Context(), chi.URLParam(r, "id"), limit, offset)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items":  items,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func (s *Server) handleGetWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	delivery, err := s.store.GetWebhookDelivery(r.Context(), chi.URLParam(r, "deliveryId"))
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	if delivery.SubscriptionID != chi.URLParam(r, "id") {
+		writeStoreError(w, r, store.ErrNotFound)
+		return
+	}
+	attempts, err := s.store.ListWebhookDeliveryAttempts(r.Context(), delivery.ID)
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"item": delivery, "attempts": attempts})
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 )
 
@@ -36,5 +37,11 @@ func writeError(w http.ResponseWriter, status int, code, message string, retryab
 func decodeJSON(r *http.Request, out any) error {
 	decoder := json.NewDecoder(r.Body)
 	decoder.DisallowUnknownFields()
-	return decoder.Decode(out)
+	if err := decoder.Decode(out); err != nil {
+		return err
+	}
+	// Read to EOF so a body sent with X-TDP-Content-SHA256 is verified (and
+	// any size limit enforced) before the handler acts on it.
+	_, err := io.Copy(io.Discard, r.Body)
+	return err
 }
@@ -1,14 +1,18 @@
 package api
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
-
-	"tdp-lite/backend/internal/store"
+	"strings"
 )
 
+var errInvalidIdempotencyKey = errors.New("idempotency key must be at most 128 characters")
+
 func payloadHash(payload any) (string, error) {
 	raw, err := json.Marshal(payload)
 	if err != nil {
@@ -18,42 +22,70 @@ func payloadHash(payload any) (string, error) {
 	return hex.EncodeToString(sum[:]), nil
 }
 
-func (s *Server) runWithIdempotency(w http.ResponseWriter, r *http.Request, payload any, execute func() (any, error)) (bool, error) {
-	idempotencyKey := r.Header.Get("Idempotency-Key")
+// idempotentHeaders are stored with an idempotent response and sent again
+// when it is replayed.
+var idempotentHeaders = []string{"ETag", "Location"}
+
+const maxIdempotencyKeyLength = 128
+
+// runWithIdempotency runs execute and writes its result. With an
+// Idempotency-Key header the result (status, replayable headers and body) is
+// stored under the calling API key, and a retry with the same key and request
+// replays it instead of running execute again. A failed execute releases the
+// key so the request can be retried.
+func (s *Server) runWithIdempotency(w http.ResponseWriter, r *http.Request, payload any, execute func() (int, any, error)) (bool, error) {
+	idempotencyKey := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
 	if idempotencyKey == "" {
-		result, err := execute()
+		status, result, err := execute()
 		if err != nil {
 			return false, err
 		}
-		writeJSON(w, http.StatusOK, result)
+		writeJSON(w, status, result)
 		return true, nil
 	}
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		return false, errInvalidIdempotencyKey
+	}
 
-	hash, err := payloadHash(payload)
+	hash, err := payloadHash(map[string]any{"method": r.Method, "path": r.URL.Path, "payload": payload})
 	if err != nil {
 		return false, err
 	}
+	scope := actorKeyID(r)
 
-	beginResult, err := s.store.BeginIdempotency(r.Context(), idempotencyKey, hash)
+	beginResult, err := s.store.BeginIdempotency(r.Context(), scope, idempotencyKey, hash, s.cfg.IdempotencyLockTTL)
 	if err != nil {
-		if err == store.ErrIdempotencyConflict || err == store.ErrIdempotencyInProgress {
-			return false, err
-		}
 		return false, err
 	}
-	if beginResult.Response != nil {
-		writeJSON(w, http.StatusOK, beginResult.Response)
+	if !beginResult.Owned {
+		for name, value := range beginResult.Headers {
+			w.Header().Set(name, value)
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		writeJSON(w, beginResult.StatusCode, beginResult.Response)
 		return true, nil
 	}
 
-	result, err := execute()
+	status, result, err := execute()
 	if err != nil {
+		if releaseErr := s.store.ReleaseIdempotency(context.WithoutCancel(r.Context()), scope, idempotencyKey, hash); releaseErr != nil {
+			log.Printf("idempotency release failed key=%s err=%v", idempotencyKey, releaseErr)
+		}
 		return false, err
 	}
-	if err := s.store.FinalizeIdempotency(r.Context(), idempotencyKey, hash, result); err != nil {
-		return false, err
+
+	headers := make(map[string]string, len(idempotentHeaders))
+	for _, name := range idempotentHeaders {
+		if value := w.Header().Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+	// The change is already made, so a failure to store the response is
+	// logged rather than reported; the key unlocks after IdempotencyLockTTL.
+	if err := s.store.FinalizeIdempotency(context.WithoutCancel(r.Context()), scope, idempotencyKey, hash, status, headers, result); err != nil {
+		log.Printf("idempotency finalize failed key=%s err=%v", idempotencyKey, err)
 	}
 
-	writeJSON(w, http.StatusOK, result)
+	writeJSON(w, status, result)
 	return true, nil
 }
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"tdp-lite/backend/internal/store"
+)
+
+// presenceHub shares one presence poller between all open public presence
+// streams. It polls only while a stream is subscribed and sends each change of
+// the public payload to every subscriber, so database load does not grow with
+// the number of anonymous connections.
+type presenceHub struct {
+	read     func(context.Context) (map[string]any, error)
+	interval time.Duration
+
+	mu          sync.Mutex
+	subscribers map[chan map[string]any]struct{}
+	current     map[string]any
+	stop        context.CancelFunc
+}
+
+func newPresenceHub(read func(context.Context) (map[string]any, error), interval time.Duration) *presenceHub {
+	return &presenceHub{
+		read:        read,
+		interval:    interval,
+		subscribers: make(map[chan map[string]any]struct{}),
+	}
+}
+
+// subscribe returns the current presence payload and a channel of later
+// changes. The channel holds only the latest change, so a slow stream skips
+// straight to it. Call unsubscribe when the stream ends.
+func (h *presenceHub) subscribe(ctx context.Context) (current map[string]any, updates <-chan map[string]any, unsubscribe func(), err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.current == nil {
+		item, err := h.read(ctx)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		h.current = item
+	}
+	ch := make(chan map[string]any, 1)
+	h.subscribers[ch] = struct{}{}
+	if h.stop == nil {
+		pollCtx, stop := context.WithCancel(context.Background())
+		h.stop = stop
+		go h.poll(pollCtx)
+	}
+	return h.current, ch, func() { h.unsubscribe(ch) }, nil
+}
+
+func (h *presenceHub) unsubscribe(ch chan map[string]any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subscribers, ch)
+	if len(h.subscribers) == 0 && h.stop != nil {
+		h.stop()
+		h.stop = nil
+		h.current = nil
+	}
+}
+
+func (h *presenceHub) poll(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		item, err := h.read(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("presence poll failed: %v", err)
+			}
+			continue
+		}
+		h.publish(ctx, item)
+	}
+}
+
+func (h *presenceHub) publish(ctx context.Context, item map[string]any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// A poller stopped while reading must not overwrite a newer one's state.
+	if ctx.Err() != nil {
+		return
+	}
+	changed := h.current == nil || presencePayloadChanged(h.current, item)
+	h.current = item
+	if !changed {
+		return
+	}
+	for ch := range h.subscribers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- item
+	}
+}
+
+// presencePayloadChanged reports whether any public presence field differs,
+// ignoring the heartbeat timestamps that move on every heartbeat. Comparing
+// every field matters when privacy settings change: hiding the region must
+// reach open streams even though the status and location label stay the same.
+func presencePayloadChanged(prev, next map[string]any) bool {
+	if len(prev) != len(next) {
+		return true
+	}
+	for key, value := range next {
+		if key == "lastHeartbeatAt" || key == "updatedAt" {
+			continue
+		}
+		prevValue, ok := prev[key]
+		if !ok || !reflect.DeepEqual(prevValue, value) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// presenceHistoryCacheTTL is how long the public presence timeline is
+	// served from memory before presence_history is scanned again.
+	presenceHistoryCacheTTL = time.Minute
+	presenceHistoryMaxDays  = 365
+	presenceHistoryMaxItems = 200
+)
+
+// presenceHistoryCache holds the longest public presence timeline
+// (presenceHistoryMaxDays, presenceHistoryMaxItems); shorter requests are cut
+// from it. Concurrent misses wait for a single load.
+type presenceHistoryCache struct {
+	mu       sync.Mutex
+	items    []store.PresenceVisit
+	loadedAt time.Time
+}
+
+func (c *presenceHistoryCache) get(ctx context.Context, load func(context.Context) ([]store.PresenceVisit, error)) ([]store.PresenceVisit, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.items != nil && time.Since(c.loadedAt) < presenceHistoryCacheTTL {
+		return c.items, nil
+	}
+	items, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.items = items
+	c.loadedAt = time.Now()
+	return items, nil
+}
+
+// invalidate drops the cached timeline, e.g. after a heartbeat that may have
+// changed the privacy settings.
+func (c *presenceHistoryCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = nil
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -21,16 +22,34 @@ import (
 	"tdp-lite/backend/internal/store"
 )
 
+// Per-route request body limits. The authenticator buffers bodies up to these
+// to hash them; bodies sent with X-TDP-Content-SHA256 are streamed instead.
+const (
+	controlBodyLimit  = 64 << 10
+	contentBodyLimit  = 8 << 20
+	snapshotBodyLimit = 32 << 20
+)
+
 type Server struct {
 	cfg           config.Config
 	store         *store.Store
 	authenticator *auth.Authenticator
 	db            *sql.DB
 	s3Presigner   *s3.PresignClient
+
+	presence        *presenceHub
+	presenceHistory *presenceHistoryCache
+
+	streamsDone      chan struct{}
+	closeStreamsOnce sync.Once
 }
 
 func New(cfg config.Config, db *sql.DB, st *store.Store) (*Server, error) {
 	authenticator := auth.NewAuthenticator(st, cfg.TimestampSkew, cfg.NonceTTL)
+	authenticator.TrustProxyHeaders = cfg.TrustProxyHeaders
+	if cfg.NonceStore == "memory" {
+		authenticator.Nonces = auth.NewMemoryNonceStore()
+	}
 
 	var presigner *s3.PresignClient
 	if cfg.S3Endpoint != "" && cfg.S3AccessKeyID != "" && cfg.S3SecretAccessKey != "" {
@@ -43,13 +62,23 @@ func New(cfg config.Config, db *sql.DB, st *store.Store) (*Server, error) {
 		presigner = s3.NewPresignClient(client)
 	}
 
-	return &Server{
-		cfg:           cfg,
-		store:         st,
-		authenticator: authenticator,
-		db:            db,
-		s3Presigner:   presigner,
-	}, nil
+	server := &Server{
+		cfg:             cfg,
+		store:           st,
+		authenticator:   authenticator,
+		db:              db,
+		s3Presigner:     presigner,
+		presenceHistory: &presenceHistoryCache{},
+		streamsDone:     make(chan struct{}),
+	}
+	server.presence = newPresenceHub(server.readPublicPresence, cfg.EventsPollInterval)
+	return server, nil
+}
+
+// CloseStreams ends open event streams. http.Server.Shutdown does not wait
+// for them on its own, so tdp-api registers this with RegisterOnShutdown.
+func (s *Server) CloseStreams() {
+	s.closeStreamsOnce.Do(func() { close(s.streamsDone) })
 }
 
 func (s *Server) Router() http.Handler {
@@ -71,6 +100,8 @@ func (s *Server) Router() http.Handler {
 		r.Get("/gallery", s.handlePublicGallery)
 		r.Get("/gallery/{id}", s.handlePublicGalleryByID)
 		r.Get("/presence", s.handlePublicPresence)
+		r.Get("/presence/stream", s.handlePublicPresenceStream)
+		r.Get("/presence/history", s.handlePublicPresenceHistory)
 		r.Get("/profile-snapshot", s.handlePublicProfileSnapshot)
 		r.Get("/search-snapshot", s.handlePublicSearchSnapshot)
 		r.Post("/search", s.handlePublicSearch)
@@ -79,45 +110,66 @@ func (s *Server) Router() http.Handler {
 	// Token-signed preview payload read endpoint (no API key required).
 	r.Get("/v1/previews/sessions/{id}/payload", s.handleGetPreviewPayload)
 
+	// Each group sets its body limit before authenticating, so the
+	// authenticator buffers bodies up to the route's limit.
 	r.Route("/v1", func(r chi.Router) {
-		r.Use(s.authenticator.Authenticate)
-
 		r.Group(func(r chi.Router) {
+			r.Use(auth.LimitBody(controlBodyLimit), s.authenticator.Authenticate)
 			r.Post("/media/uploads", auth.RequireScope("media:write", s.handleCreateMediaUpload))
 			r.Post("/media/uploads/{uploadId}/complete", auth.RequireScope("media:write", s.handleCompleteMediaUpload))
 		})
 
 		r.Group(func(r chi.Router) {
+			r.Use(auth.LimitBody(contentBodyLimit), s.authenticator.Authenticate)
 			r.Post("/previews/sessions", auth.RequireScope("preview:write", s.handleUpsertPreviewSession))
 		})
 
 		r.Group(func(r chi.Router) {
-			r.Get("/posts", auth.RequireScope("content:write", s.handleListPosts))
+			r.Use(auth.LimitBody(contentBodyLimit), s.authenticator.Authenticate)
+			r.Get("/posts", auth.RequireScope("content:read", s.handleListPosts))
 			r.Post("/posts", auth.RequireScope("content:write", s.handleCreatePost))
+			r.Get("/posts/{id}", auth.RequireScope("content:read", s.handleGetPost))
 			r.Patch("/posts/{id}", auth.RequireScope("content:write", s.handleUpdatePost))
 			r.Post("/posts/{id}/publish", auth.RequireScope("content:write", s.handlePublishPost))
 			r.Post("/posts/{id}/unpublish", auth.RequireScope("content:write", s.handleUnpublishPost))
 			r.Delete("/posts/{id}", auth.RequireScope("content:write", s.handleDeletePost))
+			r.Get("/posts/{id}/revisions", auth.RequireScope("content:read", s.handleListRevisions("post")))
+			r.Get("/posts/{id}/revisions/{revision}", auth.RequireScope("content:read", s.handleGetRevision("post")))
+			r.Post("/posts/{id}/revisions/{revision}/restore", auth.RequireScope("content:write", s.handleRestoreRevision("post")))
+			r.Get("/posts/{id}/history", auth.RequireScope("audit:read", s.handleResourceHistory("post")))
 		})
 
 		r.Group(func(r chi.Router) {
-			r.Get("/moments", auth.RequireScope("content:write", s.handleListMoments))
+			r.Use(auth.LimitBody(contentBodyLimit), s.authenticator.Authenticate)
+			r.Get("/moments", auth.RequireScope("content:read", s.handleListMoments))
 			r.Post("/moments", auth.RequireScope("content:write", s.handleCreateMoment))
+			r.Get("/moments/{id}", auth.RequireScope("content:read", s.handleGetMoment))
 			r.Patch("/moments/{id}", auth.RequireScope("content:write", s.handleUpdateMoment))
 			r.Post("/moments/{id}/publish", auth.RequireScope("content:write", s.handlePublishMoment))
 			r.Post("/moments/{id}/unpublish", auth.RequireScope("content:write", s.handleUnpublishMoment))
 			r.Delete("/moments/{id}", auth.RequireScope("content:write", s.handleDeleteMoment))
+			r.Get("/moments/{id}/revisions", auth.RequireScope("content:read", s.handleListRevisions("moment")))
+			r.Get("/moments/{id}/revisions/{revision}", auth.RequireScope("content:read", s.handleGetRevision("moment")))
+			r.Post("/moments/{id}/revisions/{revision}/restore", auth.RequireScope("content:write", s.handleRestoreRevision("moment")))
+			r.Get("/moments/{id}/history", auth.RequireScope("audit:read", s.handleResourceHistory("moment")))
 		})
 
 		r.Group(func(r chi.Router) {
+			r.Use(auth.LimitBody(contentBodyLimit), s.authenticator.Authenticate)
 			r.Post("/gallery-items", auth.RequireScope("content:write", s.handleCreateGalleryItem))
+			r.Get("/gallery-items/{id}", auth.RequireScope("content:read", s.handleGetGalleryItem))
 			r.Patch("/gallery-items/{id}", auth.RequireScope("content:write", s.handleUpdateGalleryItem))
 			r.Post("/gallery-items/{id}/publish", auth.RequireScope("content:write", s.handlePublishGalleryItem))
 			r.Post("/gallery-items/{id}/unpublish", auth.RequireScope("content:write", s.handleUnpublishGalleryItem))
 			r.Delete("/gallery-items/{id}", auth.RequireScope("content:write", s.handleDeleteGalleryItem))
+			r.Get("/gallery-items/{id}/revisions", auth.RequireScope("content:read", s.handleListRevisions("gallery")))
+			r.Get("/gallery-items/{id}/revisions/{revision}", auth.RequireScope("content:read", s.handleGetRevision("gallery")))
+			r.Post("/gallery-items/{id}/revisions/{revision}/restore", auth.RequireScope("content:write", s.handleRestoreRevision("gallery")))
+			r.Get("/gallery-items/{id}/history", auth.RequireScope("audit:read", s.handleResourceHistory("gallery")))
 		})
 
 		r.Group(func(r chi.Router) {
+			r.Use(auth.LimitBody(snapshotBodyLimit), s.authenticator.Authenticate)
 			r.Post("/internal/presence", auth.RequireScope("content:write", s.handleUpsertPresence))
 			r.Post("/internal/profile-snapshot", auth.RequireScope("content:write", s.handleUpsertProfileSnapshot))
 			r.Post("/internal/search-snapshot", auth.RequireScope("content:write", s.handleUpsertSearchSnapshot))
@@ -125,20 +177,53 @@ func (s *Server) Router() http.Handler {
 		})
 
 		r.Group(func(r chi.Router) {
+			r.Use(auth.LimitBody(controlBodyLimit), s.authenticator.Authenticate)
+			r.Get("/ai/jobs", auth.RequireScope("jobs:read", s.handleListAIJobs))
 			r.Post("/ai/jobs", auth.RequireScope("ai:run", s.handleCreateAIJob))
 			r.Get("/ai/jobs/{jobId}", auth.RequireScope("jobs:read", s.handleGetAIJob))
 			r.Post("/ai/jobs/{jobId}/apply", auth.RequireScope("ai:run", s.handleApplyAIJob))
+			r.Post("/ai/jobs/{jobId}/requeue", auth.RequireScope("jobs:admin", s.handleRequeueAIJob))
 			r.Get("/ai/models", auth.RequireScope("ai:run", s.handleGetAIModels))
 		})
 
 		r.Group(func(r chi.Router) {
+			r.Use(auth.LimitBody(controlBodyLimit), s.authenticator.Authenticate)
 			r.Post("/keys", auth.RequireScope("keys:admin", s.handleCreateKey))
 			r.Get("/keys", auth.RequireScope("keys:admin", s.handleListKeys))
 			r.Post("/keys/{id}/rotate", auth.RequireScope("keys:admin", s.handleRotateKey))
 			r.Post("/keys/{id}/revoke", auth.RequireScope("keys:admin", s.handleRevokeKey))
+			r.Get("/keys/{id}/history", auth.RequireScope("audit:read", s.handleResourceHistory("api_key")))
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.LimitBody(controlBodyLimit), s.authenticator.Authenticate)
+			r.Get("/webhooks", auth.RequireScope("webhooks:admin", s.handleListWebhooks))
+			r.Post("/webhooks", auth.RequireScope("webhooks:admin", s.handleCreateWebhook))
+			r.Get("/webhooks/{id}", auth.RequireScope("webhooks:admin", s.handleGetWebhook))
+			r.Patch("/webhooks/{id}", auth.RequireScope("webhooks:admin", s.handleUpdateWebhook))
+			r.Delete("/webhooks/{id}", auth.RequireScope("webhooks:admin", s.handleDeleteWebhook))
+			r.Get("/webhooks/{id}/deliveries", auth.RequireScope("webhooks:admin", s.handleListWebhookDeliveries))
+			r.Get("/webhooks/{id}/deliveries/{deliveryId}", auth.RequireScope("webhooks:admin", s.handleGetWebhookDelivery))
+			r.Get("/webhooks/{id}/history", auth.RequireScope("audit:read", s.handleResourceHistory("webhook")))
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.LimitBody(controlBodyLimit), s.authenticator.Authenticate)
+			r.Get("/audit-logs", auth.RequireScope("audit:read", s.handleListAuditLogs))
 		})
 
-		r.Get("/jobs/{id}", auth.RequireScope("jobs:read", s.handleGetGenericJob))
+		r.Group(func(r chi.Router) {
+			r.Use(auth.LimitBody(controlBodyLimit), s.authenticator.Authenticate)
+			r.Get("/events", auth.RequireScope("events:read", s.handleEvents))
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.LimitBody(controlBodyLimit), s.authenticator.Authenticate)
+			r.Get("/jobs", auth.RequireScope("jobs:read", s.handleListJobs))
+			r.Get("/jobs/{id}", auth.RequireScope("jobs:read", s.handleGetGenericJob))
+			r.Post("/jobs/{id}/requeue", auth.RequireScope("jobs:admin", s.handleRequeueJob))
+			r.Get("/jobs/{id}/history", auth.RequireScope("audit:read", s.handleResourceHistory("job")))
+		})
 	})
 
 	return r
@@ -216,10 +301,22 @@ func writeStoreError(w http.ResponseWriter, r *http.Request, err error) {
 		writeError(w, http.StatusNotFound, "not_found", "resource not found", false, reqID)
 	case errors.Is(err, store.ErrMomentContentOrMediaRequired):
 		writeError(w, http.StatusBadRequest, "invalid_payload", "moment content or media is required", false, reqID)
+	case errors.Is(err, store.ErrScheduleTimeRequired):
+		writeError(w, http.StatusBadRequest, "invalid_payload", "publishedAt is required for scheduled content", false, reqID)
+	case errors.Is(err, store.ErrVersionConflict):
+		writeVersionConflict(w, r)
+	case errors.Is(err, store.ErrRestoreConflict):
+		writeError(w, http.StatusConflict, "restore_conflict", "the revision's slug or locale is now used by another item", false, reqID)
 	case errors.Is(err, store.ErrIdempotencyConflict):
 		writeError(w, http.StatusConflict, "idempotency_conflict", "idempotency key already used with another payload", false, reqID)
 	case errors.Is(err, store.ErrIdempotencyInProgress):
 		writeError(w, http.StatusConflict, "idempotency_in_progress", "request is already in progress", true, reqID)
+	case errors.Is(err, errJobNotDead):
+		writeError(w, http.StatusConflict, "job_not_dead", err.Error(), false, reqID)
+	case errors.Is(err, errJobNotReady):
+		writeError(w, http.StatusConflict, "job_not_ready", err.Error(), false, reqID)
+	case errors.Is(err, errInvalidIdempotencyKey):
+		writeError(w, http.StatusBadRequest, "invalid_idempotency_key", err.Error(), false, reqID)
 	default:
 		writeError(w, http.StatusInternalServerError, "internal_error", fmt.Sprintf("internal error: %v", err), true, reqID)
 	}
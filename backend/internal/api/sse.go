@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	eventStreamHeartbeat = 15 * time.Second
+	// eventStreamMaxAge ends streams periodically so clients reconnect, and a
+	// revoked key stops receiving events.
+	eventStreamMaxAge = 30 * time.Minute
+	// eventStreamRetry is the reconnect delay sent to EventSource clients.
+	eventStreamRetry = 3 * time.Second
+)
+
+// eventStream writes Server-Sent Events to one client.
+type eventStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// startEventStream sends the SSE response headers. The server's write timeout
+// is lifted for this response, since the stream stays open.
+func startEventStream(w http.ResponseWriter) (*eventStream, error) {
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("content-type", "text/event-stream")
+	w.Header().Set("cache-control", "no-cache")
+	w.Header().Set("x-accel-buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	stream := &eventStream{w: w, rc: rc}
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", eventStreamRetry.Milliseconds()); err != nil {
+		return nil, err
+	}
+	if err := stream.flush(); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// send writes one event. data is JSON-encoded onto a single data line.
+func (e *eventStream) send(id, event string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	if id != "" {
+		fmt.Fprintf(&b, "id: %s\n", id)
+	}
+	if event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+	fmt.Fprintf(&b, "data: %s\n\n", raw)
+	_, err = e.w.Write([]byte(b.String()))
+	return err
+}
+
+// heartbeat writes a comment line so proxies keep the connection open.
+func (e *eventStream) heartbeat() error {
+	if _, err := e.w.Write([]byte(": ping\n\n")); err != nil {
+		return err
+	}
+	return e.flush()
+}
+
+func (e *eventStream) flush() error {
+	return e.rc.Flush()
+}
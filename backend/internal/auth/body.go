@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ContentHashHeader lets a client declare the body's SHA-256 up front. The
+// signature then covers the declared hash and the body is verified while the
+// handler streams it instead of being buffered by the authenticator.
+const ContentHashHeader = "X-TDP-Content-SHA256"
+
+var ErrContentHashMismatch = errors.New("request body does not match " + ContentHashHeader)
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// readLimitedBody buffers at most limit bytes of body. Passing a LimitBody
+// cap also reports errBodyTooLarge.
+func readLimitedBody(body io.Reader, limit int64) ([]byte, error) {
+	raw, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, errBodyTooLarge
+		}
+		return nil, err
+	}
+	if int64(len(raw)) > limit {
+		return nil, errBodyTooLarge
+	}
+	return raw, nil
+}
+
+func parseContentHash(raw string) (string, bool) {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	if len(raw) != sha256.Size*2 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(raw); err != nil {
+		return "", false
+	}
+	return raw, true
+}
+
+// hashingBody hashes the body as it is read and fails the final read with
+// ErrContentHashMismatch if it does not match the declared hash.
+type hashingBody struct {
+	body     io.ReadCloser
+	hash     hash.Hash
+	expected []byte
+	err      error
+}
+
+func newHashingBody(body io.ReadCloser, expectedHex string) *hashingBody {
+	expected, _ := hex.DecodeString(expectedHex)
+	return &hashingBody{body: body, hash: sha256.New(), expected: expected}
+}
+
+func (b *hashingBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	n, err := b.body.Read(p)
+	b.hash.Write(p[:n])
+	if errors.Is(err, io.EOF) {
+		if subtle.ConstantTimeCompare(b.hash.Sum(nil), b.expected) != 1 {
+			err = ErrContentHashMismatch
+		}
+	}
+	if err != nil {
+		b.err = err
+	}
+	return n, err
+}
+
+func (b *hashingBody) Close() error {
+	return b.body.Close()
+}
+
+// LimitBody caps request bodies on the routes it wraps. Requests whose
+// Content-Length already exceeds maxBytes are rejected with 413; streamed
+// bodies fail on read once they pass it. Use it before Authenticate, which
+// then buffers bodies up to the same limit.
+func LimitBody(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				rejectBodyTooLarge(w, maxBytes)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			ctx := context.WithValue(r.Context(), contextKeyBodyLimit, maxBytes)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func rejectBodyTooLarge(w http.ResponseWriter, maxBytes int64) {
+	reject(w, http.StatusRequestEntityTooLarge, "body_too_large", "request body exceeds "+strconv.FormatInt(maxBytes, 10)+" bytes", false)
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClientIP returns the address a request came from. With trustProxy set the
+// last X-Forwarded-For entry (the one appended by our own reverse proxy) or
+// X-Real-IP wins over the socket address.
+func ClientIP(r *http.Request, trustProxy bool) (netip.Addr, bool) {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			if addr, err := netip.ParseAddr(strings.TrimSpace(parts[len(parts)-1])); err == nil {
+				return addr.Unmap(), true
+			}
+		}
+		if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			return addr.Unmap(), true
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// ParseCIDR accepts a prefix ("10.0.0.0/8") or a single address, which is
+// treated as a full-length prefix, and returns it in canonical form.
+func ParseCIDR(raw string) (netip.Prefix, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "/") {
+		addr, err := netip.ParseAddr(raw)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(raw)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return prefix.Masked(), nil
+}
+
+// IPAllowed reports whether addr falls inside one of cidrs. An empty list
+// allows every address.
+func IPAllowed(addr netip.Addr, cidrs []string) bool {
+	if len(cidrs) == 0 {
+		return true
+	}
+	for _, raw := range cidrs {
+		prefix, err := ParseCIDR(raw)
+		if err != nil {
+			continue
+		}
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeRateLimited(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	reject(w, http.StatusTooManyRequests, "rate_limited", "api key request quota exceeded", true)
+}
@@ -3,8 +3,10 @@ package auth
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,32 +16,55 @@ import (
 type contextKey string
 
 const (
-	contextKeyAuth contextKey = "tdp-auth"
+	contextKeyAuth      contextKey = "tdp-auth"
+	contextKeyBodyLimit contextKey = "tdp-body-limit"
+)
+
+// Which of a key's credentials (secret or Ed25519 public key) verified the
+// request. SecretPrevious is only accepted during the grace period after a
+// rotation.
+const (
+	SecretCurrent  = "current"
+	SecretPrevious = "previous"
 )
 
 type AuthContext struct {
 	KeyID  string
 	Scopes []string
+	Secret string
 }
 
+// defaultMaxBodyBytes caps bodies buffered for signature hashing on routes
+// that do not set their own limit with LimitBody.
+const defaultMaxBodyBytes = 1 << 20
+
 type Authenticator struct {
 	Store    *store.Store
+	Nonces   NonceStore
 	MaxSkew  time.Duration
 	NonceTTL time.Duration
+	// TrustProxyHeaders takes the client address for key IP allowlists from
+	// X-Forwarded-For / X-Real-IP instead of the connection.
+	TrustProxyHeaders bool
 }
 
 func NewAuthenticator(s *store.Store, maxSkew, nonceTTL time.Duration) *Authenticator {
 	return &Authenticator{
 		Store:    s,
+		Nonces:   PostgresNonceStore{Store: s},
 		MaxSkew:  maxSkew,
 		NonceTTL: nonceTTL,
 	}
 }
 
-func unauthorized(w http.ResponseWriter, code, message string) {
+func reject(w http.ResponseWriter, status int, code, message string, retryable bool) {
 	w.Header().Set("content-type", "application/json")
-	w.WriteHeader(http.StatusUnauthorized)
-	_, _ = w.Write([]byte(`{"error":{"code":"` + code + `","message":"` + message + `","retryable":false}}`))
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(`{"error":{"code":"` + code + `","message":"` + message + `","retryable":` + strconv.FormatBool(retryable) + `}}`))
+}
+
+func unauthorized(w http.ResponseWriter, code, message string) {
+	reject(w, http.StatusUnauthorized, code, message, false)
 }
 
 func (a *Authenticator) Authenticate(next http.Handler) http.Handler {
@@ -58,14 +83,6 @@ func (a *Authenticator) Authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			unauthorized(w, "invalid_request", "failed to read request body")
-			return
-		}
-		r.Body = io.NopCloser(bytes.NewReader(body))
-		bodyHash := SHA256Hex(body)
-
 		record, err := a.Store.GetAPIKeyByKeyID(r.Context(), keyID)
 		if err != nil {
 			unauthorized(w, "invalid_key", "api key not found")
@@ -75,34 +92,118 @@ func (a *Authenticator) Authenticate(next http.Handler) http.Handler {
 			unauthorized(w, "revoked_key", "api key has been revoked")
 			return
 		}
+		if record.ExpiresAt != nil && !time.Now().Before(*record.ExpiresAt) {
+			unauthorized(w, "key_expired", "api key has expired")
+			return
+		}
+		if len(record.AllowedCIDRs) > 0 {
+			addr, ok := ClientIP(r, a.TrustProxyHeaders)
+			if !ok || !IPAllowed(addr, record.AllowedCIDRs) {
+				reject(w, http.StatusForbidden, "ip_not_allowed", "client address is not allowed for this api key", false)
+				return
+			}
+		}
 
-		if !Verify(record.Secret, SignatureInput{
+		// The key is known before any of the body is read. A declared content
+		// hash is signed in place of the body and checked as the handler reads
+		// it; otherwise the body is buffered, up to the route's body limit, and
+		// hashed.
+		maxBodyBytes := int64(defaultMaxBodyBytes)
+		if limit, ok := r.Context().Value(contextKeyBodyLimit).(int64); ok {
+			maxBodyBytes = limit
+		}
+		var bodyHash string
+		if declared := r.Header.Get(ContentHashHeader); declared != "" {
+			hash, ok := parseContentHash(declared)
+			if !ok {
+				unauthorized(w, "invalid_content_hash", ContentHashHeader+" must be a hex SHA-256 digest")
+				return
+			}
+			bodyHash = hash
+			r.Body = newHashingBody(r.Body, hash)
+		} else {
+			if r.ContentLength > maxBodyBytes {
+				rejectBodyTooLarge(w, maxBodyBytes)
+				return
+			}
+			body, err := readLimitedBody(r.Body, maxBodyBytes)
+			if errors.Is(err, errBodyTooLarge) {
+				rejectBodyTooLarge(w, maxBodyBytes)
+				return
+			}
+			if err != nil {
+				unauthorized(w, "invalid_request", "failed to read request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			bodyHash = SHA256Hex(body)
+		}
+
+		input := SignatureInput{
 			Method:    r.Method,
 			Path:      r.URL.Path,
 			RawQuery:  r.URL.RawQuery,
 			Timestamp: timestamp,
 			Nonce:     nonce,
 			BodyHash:  bodyHash,
-		}, signature) {
+		}
+		current, previous := record.Secret, record.PreviousSecret
+		if record.Algorithm == store.KeyAlgorithmEd25519 {
+			current, previous = record.PublicKey, record.PreviousPublicKey
+		}
+		matched := ""
+		switch {
+		case verifyCredential(record.Algorithm, current, input, signature):
+			matched = SecretCurrent
+		case verifyCredential(record.Algorithm, previous, input, signature):
+			matched = SecretPrevious
+		default:
 			unauthorized(w, "invalid_signature", "signature verification failed")
 			return
 		}
 
-		if err := a.Store.RegisterNonce(r.Context(), keyID, nonce, a.NonceTTL); err != nil {
+		if err := a.Nonces.Register(r.Context(), keyID, nonce, a.NonceTTL); err != nil {
 			unauthorized(w, "nonce_reused", "nonce has already been used")
 			return
 		}
 
+		if record.RateLimitPerMinute > 0 {
+			// A failed count lets the request through rather than locking the key out.
+			count, resetIn, err := a.Store.CountAPIKeyRequest(r.Context(), keyID)
+			if err == nil && count > record.RateLimitPerMinute {
+				writeRateLimited(w, resetIn)
+				return
+			}
+		}
+
 		_ = a.Store.TouchAPIKeyUsage(r.Context(), keyID)
 
+		if matched == SecretPrevious && record.PreviousSecretExpiresAt != nil {
+			w.Header().Set("X-TDP-Key-Secret", SecretPrevious)
+			w.Header().Set("X-TDP-Key-Secret-Expires-At", record.PreviousSecretExpiresAt.UTC().Format(time.RFC3339))
+		}
+
 		ctx := context.WithValue(r.Context(), contextKeyAuth, AuthContext{
 			KeyID:  keyID,
 			Scopes: record.Scopes,
+			Secret: matched,
 		})
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// verifyCredential checks a signature with a key's secret (HMAC) or public
+// key (Ed25519). An empty credential never matches.
+func verifyCredential(algorithm, credential string, input SignatureInput, signature string) bool {
+	if credential == "" {
+		return false
+	}
+	if algorithm == store.KeyAlgorithmEd25519 {
+		return VerifyEd25519(credential, input, signature)
+	}
+	return Verify(credential, input, signature)
+}
+
 func GetAuthContext(ctx context.Context) (AuthContext, bool) {
 	value := ctx.Value(contextKeyAuth)
 	if value == nil {
@@ -118,14 +219,19 @@ func HasScope(ctx context.Context, scope string) bool {
 		return false
 	}
 	for _, candidate := range authCtx.Scopes {
-		if candidate == scope || candidate == "*" {
+		if ScopeGrants(candidate, scope) {
 			return true
 		}
 	}
 	return false
 }
 
+// RequireScope panics when scope is not in the registry, so a typo in a route
+// fails at startup instead of locking every key out.
 func RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	if _, ok := scopesByName[scope]; !ok {
+		panic("auth: route requires unregistered scope " + scope)
+	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !HasScope(r.Context(), scope) {
 			w.Header().Set("content-type", "application/json")
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"tdp-lite/backend/internal/store"
+)
+
+// NonceStore remembers the nonces each key has used until they expire, so a
+// signed request cannot be replayed. Register returns store.ErrNonceUsed for
+// a nonce that is still remembered.
+type NonceStore interface {
+	Register(ctx context.Context, keyID, nonce string, ttl time.Duration) error
+}
+
+// PostgresNonceStore keeps nonces in request_nonces, shared by every tdp-api
+// instance. tdp-worker's sweeper deletes expired rows.
+type PostgresNonceStore struct {
+	Store *store.Store
+}
+
+func (p PostgresNonceStore) Register(ctx context.Context, keyID, nonce string, ttl time.Duration) error {
+	return p.Store.RegisterNonce(ctx, keyID, nonce, ttl)
+}
+
+// MemoryNonceStore keeps nonces in process memory. It only protects a single
+// tdp-api instance and forgets everything on restart, so it suits single-node
+// and test setups.
+type MemoryNonceStore struct {
+	mu        sync.Mutex
+	expiries  map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{
+		expiries: make(map[string]time.Time),
+	}
+}
+
+// memorySweepInterval is how often Register drops expired entries.
+const memorySweepInterval = time.Minute
+
+func (m *MemoryNonceStore) Register(_ context.Context, keyID, nonce string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) >= memorySweepInterval {
+		for entry, expiresAt := range m.expiries {
+			if !now.Before(expiresAt) {
+				delete(m.expiries, entry)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	entry := keyID + "\x00" + nonce
+	if expiresAt, ok := m.expiries[entry]; ok && now.Before(expiresAt) {
+		return store.ErrNonceUsed
+	}
+	m.expiries[entry] = now.Add(ttl)
+	return nil
+}
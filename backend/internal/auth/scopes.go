@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Scope describes a permission an API key can hold. Implies lists narrower
+// scopes granted along with it, so content:write keys can also read.
+type Scope struct {
+	Name        string
+	Description string
+	Implies     []string
+}
+
+// Scopes is the registry of every scope routes may require and keys may be
+// granted. Besides these names a key may hold "*" (everything) or a
+// "<namespace>:*" wildcard such as "content:*".
+var Scopes = []Scope{
+	{Name: "content:read", Description: "List posts and moments and read revision history"},
+	{Name: "content:write", Description: "Create, edit, publish and delete content", Implies: []string{"content:read"}},
+	{Name: "media:write", Description: "Create and complete media uploads"},
+	{Name: "preview:write", Description: "Create preview sessions"},
+	{Name: "ai:run", Description: "Queue and apply AI jobs"},
+	{Name: "jobs:read", Description: "Read job status"},
+	{Name: "jobs:admin", Description: "Requeue dead jobs", Implies: []string{"jobs:read"}},
+	{Name: "keys:admin", Description: "Create, list, rotate and revoke API keys"},
+	{Name: "audit:read", Description: "Query the audit log and resource history"},
+	{Name: "webhooks:admin", Description: "Manage webhook subscriptions and read their delivery log"},
+	{Name: "events:read", Description: "Stream job, content and search snapshot events"},
+}
+
+var scopesByName = func() map[string]Scope {
+	byName := make(map[string]Scope, len(Scopes))
+	for _, scope := range Scopes {
+		byName[scope.Name] = scope
+	}
+	return byName
+}()
+
+func scopeNamespace(name string) string {
+	namespace, _, _ := strings.Cut(name, ":")
+	return namespace
+}
+
+// ValidateScope reports whether scope is registered, "*", or a wildcard over
+// a registered namespace.
+func ValidateScope(scope string) error {
+	if scope == "*" {
+		return nil
+	}
+	if _, ok := scopesByName[scope]; ok {
+		return nil
+	}
+	if namespace, found := strings.CutSuffix(scope, ":*"); found {
+		for _, known := range Scopes {
+			if scopeNamespace(known.Name) == namespace {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("unknown scope: %s", scope)
+}
+
+// NormalizeScopes trims and de-duplicates scopes, rejecting any that
+// are not registered. An empty list defaults to content:read.
+func NormalizeScopes(input []string) ([]string, error) {
+	result := make([]string, 0, len(input))
+	seen := make(map[string]struct{})
+	for _, scope := range input {
+		scope = strings.TrimSpace(scope)
+		if scope == "" {
+			continue
+		}
+		if err := ValidateScope(scope); err != nil {
+			return nil, err
+		}
+		if _, exists := seen[scope]; exists {
+			continue
+		}
+		seen[scope] = struct{}{}
+		result = append(result, scope)
+	}
+	if len(result) == 0 {
+		return []string{"content:read"}, nil
+	}
+	return result, nil
+}
+
+// ScopeGrants reports whether a key holding granted may use a route that
+// requires required, following wildcards and implied scopes.
+func ScopeGrants(granted, required string) bool {
+	if granted == "*" || granted == required {
+		return true
+	}
+	if namespace, found := strings.CutSuffix(granted, ":*"); found && scopeNamespace(required) == namespace {
+		return true
+	}
+	for _, implied := range scopesByName[granted].Implies {
+		if ScopeGrants(implied, required) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,10 +1,15 @@
 package auth
 
 import (
+	"crypto/ed25519"
 	"crypto/hmac"
 	"crypto/sha256"
 	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"net/url"
 	"sort"
@@ -75,6 +80,58 @@ func Verify(secret string, input SignatureInput, signature string) bool {
 	return subtle.ConstantTimeCompare(left, right) == 1
 }
 
+// SignEd25519 signs the same canonical string as Sign with an Ed25519
+// private key; the hex signature goes in X-TDP-Signature.
+func SignEd25519(privateKey ed25519.PrivateKey, input SignatureInput) string {
+	return hex.EncodeToString(ed25519.Sign(privateKey, []byte(CanonicalString(input))))
+}
+
+// VerifyEd25519 checks a hex signature against a base64 public key as stored
+// by ParseEd25519PublicKey.
+func VerifyEd25519(publicKey string, input SignatureInput, signature string) bool {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return false
+	}
+	raw, err := hex.DecodeString(strings.ToLower(strings.TrimSpace(signature)))
+	if err != nil || len(raw) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(ed25519.PublicKey(key), []byte(CanonicalString(input)), raw)
+}
+
+// ParseEd25519PublicKey accepts a PEM "PUBLIC KEY" block (as written by
+// `openssl pkey -pubout`) or the raw 32-byte key in base64, and returns the
+// raw key in standard base64.
+func ParseEd25519PublicKey(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	var key []byte
+	if block, _ := pem.Decode([]byte(raw)); block != nil {
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return "", err
+		}
+		edKey, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return "", errors.New("public key is not an Ed25519 key")
+		}
+		key = edKey
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil {
+			decoded, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(raw, "="))
+		}
+		if err != nil {
+			return "", errors.New("public key must be PEM or base64")
+		}
+		key = decoded
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return "", fmt.Errorf("Ed25519 public key must be %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
 func ValidateTimestamp(raw string, maxSkew time.Duration, now time.Time) bool {
 	millis, err := time.ParseDuration(raw + "ms")
 	if err != nil {
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
 	"strconv"
@@ -13,6 +14,12 @@ type Config struct {
 	AppBaseURL    string
 	PreviewSecret string
 
+	SecretKeys        string
+	SecretKeyVersion  string
+	AuditKey          []byte
+	KeyRotationGrace  time.Duration
+	TrustProxyHeaders bool
+
 	S3Endpoint        string
 	S3Region          string
 	S3AccessKeyID     string
@@ -20,15 +27,37 @@ type Config struct {
 	S3Bucket          string
 	S3PublicURL       string
 
-	TimestampSkew        time.Duration
-	NonceTTL             time.Duration
-	PreviewTTL           time.Duration
-	JobPollInterval      time.Duration
-	PresenceOnlineWindow time.Duration
+	TimestampSkew         time.Duration
+	NonceTTL              time.Duration
+	NonceStore            string
+	PreviewTTL            time.Duration
+	JobPollInterval       time.Duration
+	JobMaxAttempts        int
+	JobRetryBaseDelay     time.Duration
+	JobRetryMaxDelay      time.Duration
+	JobLeaseTTL           time.Duration
+	WorkerID              string
+	WorkerConcurrency     int
+	WorkerDrainTimeout    time.Duration
+	JobListenEnabled      bool
+	ScheduleCheckInterval time.Duration
+	SweepInterval         time.Duration
+	IdempotencyRetention  time.Duration
+	IdempotencyLockTTL    time.Duration
+	OutboxRetention       time.Duration
+	PresenceOnlineWindow  time.Duration
+	PresenceRetention     time.Duration
+	WebhookTimeout        time.Duration
+	EventsPollInterval    time.Duration
 
 	OpenAIAPIKey    string
 	AnthropicAPIKey string
 	GeminiAPIKey    string
+
+	OpenAIBaseURL    string
+	AnthropicBaseURL string
+	GeminiBaseURL    string
+	AIRequestTimeout time.Duration
 }
 
 func mustEnv(key string) string {
@@ -59,6 +88,18 @@ func durationOrDefault(key string, fallback time.Duration) time.Duration {
 	return parsed
 }
 
+func boolOrDefault(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		panic(fmt.Sprintf("invalid bool env %s=%s: %v", key, value, err))
+	}
+	return parsed
+}
+
 func Load() Config {
 	previewTTL := durationOrDefault("TDP_PREVIEW_TTL", 2*time.Hour)
 	if previewTTL < time.Minute {
@@ -70,12 +111,72 @@ func Load() Config {
 		jobPoll = 3 * time.Second
 	}
 
+	jobMaxAttempts := ParseIntOrDefault(os.Getenv("TDP_JOB_MAX_ATTEMPTS"), 5)
+	if jobMaxAttempts < 1 {
+		jobMaxAttempts = 1
+	}
+
+	jobLease := durationOrDefault("TDP_JOB_LEASE_TTL", 2*time.Minute)
+	if jobLease < 10*time.Second {
+		jobLease = 2 * time.Minute
+	}
+
+	workerConcurrency := ParseIntOrDefault(os.Getenv("TDP_WORKER_CONCURRENCY"), 4)
+	if workerConcurrency < 1 {
+		workerConcurrency = 1
+	}
+
+	scheduleCheck := durationOrDefault("TDP_SCHEDULE_CHECK_INTERVAL", 30*time.Second)
+	if scheduleCheck < time.Second {
+		scheduleCheck = 30 * time.Second
+	}
+
+	sweepInterval := durationOrDefault("TDP_SWEEP_INTERVAL", 5*time.Minute)
+	if sweepInterval < 10*time.Second {
+		sweepInterval = 5 * time.Minute
+	}
+
+	idempotencyLock := durationOrDefault("TDP_IDEMPOTENCY_LOCK_TTL", time.Minute)
+	if idempotencyLock < time.Second {
+		idempotencyLock = time.Minute
+	}
+
+	eventsPoll := durationOrDefault("TDP_EVENTS_POLL_INTERVAL", time.Second)
+	if eventsPoll < 100*time.Millisecond {
+		eventsPoll = time.Second
+	}
+
+	var auditKey []byte
+	if raw := os.Getenv("TDP_AUDIT_HMAC_KEY"); raw != "" {
+		decoded, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil || len(decoded) < 32 {
+			panic("invalid TDP_AUDIT_HMAC_KEY: must be base64 of at least 32 bytes")
+		}
+		auditKey = decoded
+	}
+
+	nonceStore := envOrDefault("TDP_NONCE_STORE", "postgres")
+	if nonceStore != "postgres" && nonceStore != "memory" {
+		panic(fmt.Sprintf("invalid TDP_NONCE_STORE=%s: must be postgres or memory", nonceStore))
+	}
+
+	keyRotationGrace := durationOrDefault("TDP_KEY_ROTATION_GRACE", 24*time.Hour)
+	if keyRotationGrace < 0 {
+		keyRotationGrace = 0
+	}
+
 	return Config{
 		ServerAddr:    envOrDefault("TDP_API_ADDR", ":8080"),
 		DatabaseURL:   mustEnv("DATABASE_URL"),
 		AppBaseURL:    envOrDefault("TDP_APP_BASE_URL", "http://localhost:3000"),
 		PreviewSecret: mustEnv("TDP_PREVIEW_SECRET"),
 
+		SecretKeys:        os.Getenv("TDP_SECRET_KEYS"),
+		SecretKeyVersion:  os.Getenv("TDP_SECRET_KEY_VERSION"),
+		AuditKey:          auditKey,
+		KeyRotationGrace:  keyRotationGrace,
+		TrustProxyHeaders: boolOrDefault("TDP_TRUST_PROXY_HEADERS", false),
+
 		S3Endpoint:        envOrDefault("S3_ENDPOINT", os.Getenv("CLOUDFLARE_R2_ENDPOINT")),
 		S3Region:          envOrDefault("S3_REGION", "auto"),
 		S3AccessKeyID:     envOrDefault("S3_ACCESS_KEY_ID", os.Getenv("CLOUDFLARE_R2_ACCESS_KEY_ID")),
@@ -83,15 +184,37 @@ func Load() Config {
 		S3Bucket:          envOrDefault("S3_BUCKET", os.Getenv("CLOUDFLARE_R2_BUCKET")),
 		S3PublicURL:       envOrDefault("S3_CDN_URL", os.Getenv("R2_PUBLIC_URL")),
 
-		TimestampSkew:        durationOrDefault("TDP_TIMESTAMP_SKEW", 5*time.Minute),
-		NonceTTL:             durationOrDefault("TDP_NONCE_TTL", 10*time.Minute),
-		PreviewTTL:           previewTTL,
-		JobPollInterval:      jobPoll,
-		PresenceOnlineWindow: durationOrDefault("TDP_PRESENCE_ONLINE_WINDOW", 3*time.Minute),
+		TimestampSkew:         durationOrDefault("TDP_TIMESTAMP_SKEW", 5*time.Minute),
+		NonceTTL:              durationOrDefault("TDP_NONCE_TTL", 10*time.Minute),
+		NonceStore:            nonceStore,
+		PreviewTTL:            previewTTL,
+		JobPollInterval:       jobPoll,
+		JobMaxAttempts:        jobMaxAttempts,
+		JobRetryBaseDelay:     durationOrDefault("TDP_JOB_RETRY_BASE_DELAY", 10*time.Second),
+		JobRetryMaxDelay:      durationOrDefault("TDP_JOB_RETRY_MAX_DELAY", 15*time.Minute),
+		JobLeaseTTL:           jobLease,
+		WorkerID:              os.Getenv("TDP_WORKER_ID"),
+		WorkerConcurrency:     workerConcurrency,
+		WorkerDrainTimeout:    durationOrDefault("TDP_WORKER_DRAIN_TIMEOUT", 30*time.Second),
+		JobListenEnabled:      boolOrDefault("TDP_JOB_LISTEN", true),
+		ScheduleCheckInterval: scheduleCheck,
+		SweepInterval:         sweepInterval,
+		IdempotencyRetention:  durationOrDefault("TDP_IDEMPOTENCY_RETENTION", 24*time.Hour),
+		IdempotencyLockTTL:    idempotencyLock,
+		OutboxRetention:       durationOrDefault("TDP_OUTBOX_RETENTION", 7*24*time.Hour),
+		PresenceOnlineWindow:  durationOrDefault("TDP_PRESENCE_ONLINE_WINDOW", 3*time.Minute),
+		PresenceRetention:     durationOrDefault("TDP_PRESENCE_HISTORY_RETENTION", 90*24*time.Hour),
+		WebhookTimeout:        durationOrDefault("TDP_WEBHOOK_TIMEOUT", 10*time.Second),
+		EventsPollInterval:    eventsPoll,
 
 		OpenAIAPIKey:    os.Getenv("OPENAI_API_KEY"),
 		AnthropicAPIKey: os.Getenv("ANTHROPIC_API_KEY"),
 		GeminiAPIKey:    os.Getenv("GEMINI_API_KEY"),
+
+		OpenAIBaseURL:    envOrDefault("OPENAI_BASE_URL", "https://api.openai.com/v1"),
+		AnthropicBaseURL: envOrDefault("ANTHROPIC_BASE_URL", "https://api.anthropic.com"),
+		GeminiBaseURL:    envOrDefault("GEMINI_BASE_URL", "https://generativelanguage.googleapis.com"),
+		AIRequestTimeout: durationOrDefault("TDP_AI_REQUEST_TIMEOUT", 60*time.Second),
 	}
 }
 
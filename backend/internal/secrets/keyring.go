@@ -0,0 +1,185 @@
+// Package secrets seals API key secrets at rest with envelope encryption:
+// each value gets a fresh AES-256-GCM data key, and the data key is itself
+// sealed with a versioned master key from config.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sealed values look like "tdpenc1:<master key version>:<wrapped data key>:<ciphertext>",
+// both binary parts raw-URL base64 with the GCM nonce prepended.
+const (
+	sealedPrefix  = "tdpenc1:"
+	dataKeyLength = 32
+)
+
+var (
+	ErrNoKeyring      = errors.New("no secret master key configured")
+	ErrUnknownVersion = errors.New("secret sealed with unknown master key version")
+	ErrMalformed      = errors.New("malformed sealed secret")
+)
+
+type Keyring struct {
+	active string
+	keys   map[string][]byte
+}
+
+// ParseKeyring reads a comma-separated list of "<version>:<base64 32-byte key>".
+// New values are sealed with activeVersion, or the first listed key when it is
+// empty; the others stay available for opening older values.
+func ParseKeyring(spec, activeVersion string) (*Keyring, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	keyring := &Keyring{keys: make(map[string][]byte)}
+	for _, entry := range strings.Split(spec, ",") {
+		version, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		version = strings.TrimSpace(version)
+		if !ok || version == "" {
+			return nil, fmt.Errorf("master key entry must be <version>:<base64 key>")
+		}
+		if strings.Contains(version, ":") {
+			return nil, fmt.Errorf("master key version %q must not contain ':'", version)
+		}
+		if _, exists := keyring.keys[version]; exists {
+			return nil, fmt.Errorf("duplicate master key version %q", version)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("master key %q is not valid base64: %w", version, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("master key %q must be 32 bytes, got %d", version, len(key))
+		}
+		keyring.keys[version] = key
+		if keyring.active == "" {
+			keyring.active = version
+		}
+	}
+	if activeVersion = strings.TrimSpace(activeVersion); activeVersion != "" {
+		if _, ok := keyring.keys[activeVersion]; !ok {
+			return nil, fmt.Errorf("active master key version %q is not in the keyring", activeVersion)
+		}
+		keyring.active = activeVersion
+	}
+	return keyring, nil
+}
+
+// ActiveVersion is the master key version new values are sealed with. A nil
+// keyring has none.
+func (k *Keyring) ActiveVersion() string {
+	if k == nil {
+		return ""
+	}
+	return k.active
+}
+
+// IsSealed reports whether value was produced by Seal; anything else is a
+// legacy plaintext value.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+// Seal encrypts plaintext under a new data key. associatedData (the API key
+// id) is authenticated but not stored, so a value only opens for its own row.
+func (k *Keyring) Seal(plaintext string, associatedData []byte) (string, error) {
+	if k == nil {
+		return "", ErrNoKeyring
+	}
+	dataKey := make([]byte, dataKeyLength)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrappedKey, err := gcmSeal(k.keys[k.active], dataKey, []byte(sealedPrefix+k.active))
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := gcmSeal(dataKey, []byte(plaintext), associatedData)
+	if err != nil {
+		return "", err
+	}
+	return sealedPrefix + k.active + ":" +
+		base64.RawURLEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawURLEncoding.EncodeToString(ciphertext), nil
+}
+
+// Open decrypts a value produced by Seal. Legacy plaintext values are
+// returned unchanged so keys created before encryption keep working until
+// they are migrated.
+func (k *Keyring) Open(value string, associatedData []byte) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	if k == nil {
+		return "", ErrNoKeyring
+	}
+	parts := strings.Split(strings.TrimPrefix(value, sealedPrefix), ":")
+	if len(parts) != 3 {
+		return "", ErrMalformed
+	}
+	masterKey, ok := k.keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownVersion, parts[0])
+	}
+	wrappedKey, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	dataKey, err := gcmOpen(masterKey, wrappedKey, []byte(sealedPrefix+parts[0]))
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := gcmOpen(dataKey, ciphertext, associatedData)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func gcmSeal(key, plaintext, associatedData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+func gcmOpen(key, sealed, associatedData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, associatedData)
+	if err != nil {
+		return nil, fmt.Errorf("open sealed secret: %w", err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,413 @@
+package store
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const auditLogColumns = `id::text, seq, actor_key_id, action, resource_type, resource_id, metadata::text, entry_hash, created_at`
+
+// auditEntryPayload is the SQL expression for the text an entry's hash
+// covers, over the audit_logs columns (or a row shaped like them): an
+// unambiguous JSON encoding of the entry, with created_at as epoch
+// microseconds so the session time zone does not change the text.
+const auditEntryPayload = `jsonb_build_array(
+	seq, actor_key_id, action, resource_type, resource_id, metadata,
+	floor(extract(epoch FROM created_at) * 1000000)::bigint
+)::text`
+
+// auditEntryHash is the SQL expression for an unkeyed entry hash: SHA-256 of
+// the previous entry's hash followed by the payload.
+const auditEntryHash = `encode(sha256(convert_to(COALESCE(prev_hash, '') || ` + auditEntryPayload + `, 'UTF8')), 'hex')`
+
+// keyedAuditHash is the keyed entry hash, HMAC-SHA256 under the audit key of
+// the previous entry's hash followed by the payload. It is computed here
+// rather than in SQL so the key is never sent to Postgres.
+func keyedAuditHash(key []byte, prevHash, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(prevHash))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// AuditChainBreak is the first entry where the audit hash chain does not hold.
+type AuditChainBreak struct {
+	Seq    int64
+	ID     string
+	Reason string
+}
+
+// AuditChainReport is the result of VerifyAuditChain. Broken is nil when every
+// chained entry checks out.
+type AuditChainReport struct {
+	Checked  int64
+	HeadSeq  int64
+	HeadHash string
+	// Keyed is false when no audit key is configured; the plain SHA-256 chain
+	// then shows accidental edits but not a rewrite that recomputes it.
+	Keyed  bool
+	Broken *AuditChainBreak
+}
+
+// AuditLogFilter narrows ListAuditLogs; empty fields match everything. An
+// Action ending in "*" matches every action starting with the rest, so
+// "post.*" finds post.create, post.publish and so on. BeforeAt/BeforeID is
+// the keyset cursor: only entries older than that one are returned.
+type AuditLogFilter struct {
+	ActorKeyID   string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Since        *time.Time
+	Until        *time.Time
+	BeforeAt     *time.Time
+	BeforeID     string
+	Limit        int
+}
+
+func scanAuditLog(scanner interface{ Scan(dest ...any) error }) (AuditLog, error) {
+	var item AuditLog
+	var seq sql.NullInt64
+	var entryHash sql.NullString
+	var actorKeyID sql.NullString
+	var resourceType sql.NullString
+	var resourceID sql.NullString
+	var metadataRaw sql.NullString
+	if err := scanner.Scan(
+		&item.ID,
+		&seq,
+		&actorKeyID,
+		&item.Action,
+		&resourceType,
+		&resourceID,
+		&metadataRaw,
+		&entryHash,
+		&item.CreatedAt,
+	); err != nil {
+		return AuditLog{}, err
+	}
+	if seq.Valid {
+		item.Seq = &seq.Int64
+	}
+	item.EntryHash = nullableString(entryHash)
+	item.ActorKeyID = nullableString(actorKeyID)
+	item.ResourceType = nullableString(resourceType)
+	item.ResourceID = nullableString(resourceID)
+
+	item.Metadata = map[string]any{}
+	if metadataRaw.Valid && metadataRaw.String != "" && metadataRaw.String != "null" {
+		if err := json.Unmarshal([]byte(metadataRaw.String), &item.Metadata); err != nil {
+			return AuditLog{}, err
+		}
+	}
+	return item, nil
+}
+
+// InsertAuditLog appends an entry to the audit hash chain.
+func (s *Store) InsertAuditLog(ctx context.Context, actorKeyID, action, resourceType, resourceID string, metadata any) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := insertAuditLog(ctx, tx, s.auditKey, actorKeyID, action, resourceType, resourceID, metadata); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertAuditLog locks the chain head, writes the entry after it and moves the
+// head on. Holding the head row lock until commit keeps concurrent writers in
+// sequence, so every audited write, including each content write, queues
+// behind the one before it until that transaction commits.
+func insertAuditLog(ctx context.Context, tx *sql.Tx, auditKey []byte, actorKeyID, action, resourceType, resourceID string, metadata any) error {
+	metaRaw, err := toJSONRaw(metadata)
+	if err != nil {
+		return err
+	}
+
+	var headSeq int64
+	var headHash string
+	if err := tx.QueryRowContext(
+		ctx,
+		`SELECT seq, last_hash FROM audit_log_chain WHERE id = 1 FOR UPDATE`,
+	).Scan(&headSeq, &headHash); err != nil {
+		return err
+	}
+
+	// entry is the new row; NOW() is the transaction start, so the payload
+	// and the inserted created_at agree.
+	const entry = `(
+		SELECT $1::bigint AS seq, $2::text AS actor_key_id, $3::text AS action, $4::text AS resource_type,
+		       $5::text AS resource_id, $6::jsonb AS metadata, NOW() AS created_at, $7::text AS prev_hash
+	) entry`
+	args := []any{headSeq + 1, actorKeyID, action, resourceType, resourceID, string(metaRaw), headHash}
+
+	hashExpr := auditEntryHash
+	if auditKey != nil {
+		var payload string
+		if err := tx.QueryRowContext(ctx, `SELECT `+auditEntryPayload+` FROM `+entry, args...).Scan(&payload); err != nil {
+			return err
+		}
+		args = append(args, keyedAuditHash(auditKey, headHash, payload))
+		hashExpr = "$8::text"
+	}
+
+	var entryHash string
+	err = tx.QueryRowContext(
+		ctx,
+		`INSERT INTO audit_logs (seq, actor_key_id, action, resource_type, resource_id, metadata, created_at, prev_hash, entry_hash)
+		 SELECT seq, actor_key_id, action, resource_type, resource_id, metadata, created_at, prev_hash, `+hashExpr+`
+		 FROM `+entry+`
+		 RETURNING entry_hash`,
+		args...,
+	).Scan(&entryHash)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`UPDATE audit_log_chain SET seq = $1, last_hash = $2, updated_at = NOW() WHERE id = 1`,
+		headSeq+1,
+		entryHash,
+	)
+	return err
+}
+
+// auditChainEntry is one chained row as read back for verification.
+type auditChainEntry struct {
+	id          string
+	seq         int64
+	prevHash    string
+	entryHash   string
+	payload     string
+	unkeyedHash string
+}
+
+// matches reports whether the entry's stored hash is its hash under key, or
+// its plain SHA-256 hash when key is nil.
+func (e auditChainEntry) matches(key []byte) bool {
+	if key == nil {
+		return e.entryHash == e.unkeyedHash
+	}
+	return hmac.Equal([]byte(e.entryHash), []byte(keyedAuditHash(key, e.prevHash, e.payload)))
+}
+
+func queryAuditChain(ctx context.Context, q queryer) ([]auditChainEntry, error) {
+	rows, err := q.QueryContext(
+		ctx,
+		`SELECT id::text, seq, COALESCE(prev_hash, ''), COALESCE(entry_hash, ''), `+auditEntryPayload+`, `+auditEntryHash+`
+		 FROM audit_logs
+		 WHERE seq IS NOT NULL
+		 ORDER BY seq ASC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []auditChainEntry
+	for rows.Next() {
+		var entry auditChainEntry
+		if err := rows.Scan(&entry.id, &entry.seq, &entry.prevHash, &entry.entryHash, &entry.payload, &entry.unkeyedHash); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// VerifyAuditChain walks the chained audit entries in order and recomputes
+// each hash, keyed with the audit key when one is set. It stops at the first
+// entry that was edited, is missing (a gap in seq, or entries cut off after
+// the last one), or does not point at the hash of the entry before it. Only
+// the keyed chain catches someone who rewrites rows and recomputes hashes;
+// comparing HeadSeq and HeadHash with an earlier exported head also catches
+// cutting off the newest entries.
+func (s *Store) VerifyAuditChain(ctx context.Context) (AuditChainReport, error) {
+	report := AuditChainReport{Keyed: s.auditKey != nil}
+	if err := s.db.QueryRowContext(
+		ctx,
+		`SELECT seq, last_hash FROM audit_log_chain WHERE id = 1`,
+	).Scan(&report.HeadSeq, &report.HeadHash); err != nil {
+		return AuditChainReport{}, err
+	}
+
+	entries, err := queryAuditChain(ctx, s.db)
+	if err != nil {
+		return AuditChainReport{}, err
+	}
+	var expectedSeq int64 = 1
+	previousHash := ""
+	for _, entry := range entries {
+		switch {
+		case entry.seq != expectedSeq:
+			report.Broken = &AuditChainBreak{Seq: expectedSeq, Reason: fmt.Sprintf("entries %d to %d are missing", expectedSeq, entry.seq-1)}
+		case entry.prevHash != previousHash:
+			report.Broken = &AuditChainBreak{Seq: entry.seq, ID: entry.id, Reason: "previous hash does not match the entry before it"}
+		case !entry.matches(s.auditKey):
+			reason := "entry hash does not match its contents"
+			if s.auditKey != nil && entry.matches(nil) {
+				reason += " (written without TDP_AUDIT_HMAC_KEY; run audit rekey)"
+			}
+			report.Broken = &AuditChainBreak{Seq: entry.seq, ID: entry.id, Reason: reason}
+		}
+		if report.Broken != nil {
+			return report, nil
+		}
+		report.Checked++
+		expectedSeq++
+		previousHash = entry.entryHash
+	}
+
+	switch {
+	case report.HeadSeq >= expectedSeq:
+		report.Broken = &AuditChainBreak{Seq: expectedSeq, Reason: fmt.Sprintf("entries %d to %d are missing", expectedSeq, report.HeadSeq)}
+	case report.HeadSeq < expectedSeq-1:
+		report.Broken = &AuditChainBreak{Seq: report.HeadSeq + 1, Reason: "entries past the chain head were not written through it"}
+	case report.HeadHash != previousHash:
+		report.Broken = &AuditChainBreak{Seq: report.HeadSeq, Reason: "chain head hash does not match the last entry"}
+	}
+	return report, nil
+}
+
+// RekeyAuditChain recomputes every chained entry's hash under the audit key,
+// after checking each against its current hash (keyed or plain SHA-256). Run
+// it once after setting TDP_AUDIT_HMAC_KEY on a database that already has
+// chained entries. It refuses to rekey a chain that is already broken.
+func (s *Store) RekeyAuditChain(ctx context.Context) (int64, error) {
+	if s.auditKey == nil {
+		return 0, fmt.Errorf("no audit key configured")
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var headSeq int64
+	var headHash string
+	if err := tx.QueryRowContext(
+		ctx,
+		`SELECT seq, last_hash FROM audit_log_chain WHERE id = 1 FOR UPDATE`,
+	).Scan(&headSeq, &headHash); err != nil {
+		return 0, err
+	}
+	entries, err := queryAuditChain(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	var expectedSeq int64 = 1
+	previousHash, rekeyedHash := "", ""
+	for _, entry := range entries {
+		if entry.seq != expectedSeq || entry.prevHash != previousHash {
+			return 0, fmt.Errorf("chain broken at seq %d; run audit verify", entry.seq)
+		}
+		if !entry.matches(nil) && !entry.matches(s.auditKey) {
+			return 0, fmt.Errorf("chain broken at seq %d; run audit verify", entry.seq)
+		}
+		newHash := keyedAuditHash(s.auditKey, rekeyedHash, entry.payload)
+		if _, err := tx.ExecContext(
+			ctx,
+			`UPDATE audit_logs SET prev_hash = $2, entry_hash = $3 WHERE id = $1`,
+			entry.id,
+			rekeyedHash,
+			newHash,
+		); err != nil {
+			return 0, err
+		}
+		expectedSeq++
+		previousHash = entry.entryHash
+		rekeyedHash = newHash
+	}
+	if headSeq != expectedSeq-1 || headHash != previousHash {
+		return 0, fmt.Errorf("chain head does not match the last entry; run audit verify")
+	}
+	if _, err := tx.ExecContext(
+		ctx,
+		`UPDATE audit_log_chain SET last_hash = $1, updated_at = NOW() WHERE id = 1`,
+		rekeyedHash,
+	); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return expectedSeq - 1, nil
+}
+
+// ListAuditLogs returns matching entries newest first.
+func (s *Store) ListAuditLogs(ctx context.Context, filter AuditLogFilter) ([]AuditLog, error) {
+	args := make([]any, 0, 9)
+	addArg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where := []string{"TRUE"}
+	if filter.ActorKeyID != "" {
+		where = append(where, "actor_key_id = "+addArg(filter.ActorKeyID))
+	}
+	if prefix, found := strings.CutSuffix(filter.Action, "*"); found {
+		where = append(where, "action LIKE "+addArg(escapeLikePattern(prefix)+"%"))
+	} else if filter.Action != "" {
+		where = append(where, "action = "+addArg(filter.Action))
+	}
+	if filter.ResourceType != "" {
+		where = append(where, "resource_type = "+addArg(filter.ResourceType))
+	}
+	if filter.ResourceID != "" {
+		where = append(where, "resource_id = "+addArg(filter.ResourceID))
+	}
+	if filter.Since != nil {
+		where = append(where, "created_at >= "+addArg(filter.Since.UTC()))
+	}
+	if filter.Until != nil {
+		where = append(where, "created_at < "+addArg(filter.Until.UTC()))
+	}
+	if filter.BeforeAt != nil {
+		at := addArg(filter.BeforeAt.UTC())
+		where = append(where, fmt.Sprintf("(created_at < %s OR (created_at = %s AND id::text < %s))", at, at, addArg(filter.BeforeID)))
+	}
+
+	query := fmt.Sprintf(
+		`SELECT %s
+		 FROM audit_logs
+		 WHERE %s
+		 ORDER BY created_at DESC, id::text DESC
+		 LIMIT %s`,
+		auditLogColumns,
+		strings.Join(where, " AND "),
+		addArg(filter.Limit),
+	)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]AuditLog, 0)
+	for rows.Next() {
+		item, err := scanAuditLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func escapeLikePattern(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,567 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	JobTypeAI               = "ai"
+	JobTypeThumbnail        = "thumbnail"
+	JobTypeSearchSnapshot   = "search_snapshot"
+	JobTypeScheduledPublish = "scheduled_publish"
+)
+
+const jobColumns = `id::text, type, payload::text, dedupe_key, status, attempts, next_run_at, last_error,
+	result::text, locked_by, lease_expires_at, created_at, updated_at, completed_at`
+
+type EnqueueJobInput struct {
+	Type    string
+	Payload map[string]any
+	// DedupeKey coalesces enqueues: while a queued job with the same type and
+	// key has not run yet, it is returned instead of inserting a new one.
+	DedupeKey string
+	RunAt     *time.Time
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func scanJob(scanner interface{ Scan(dest ...any) error }) (Job, error) {
+	var item Job
+	var payloadRaw string
+	var dedupeKey sql.NullString
+	var lastError sql.NullString
+	var resultRaw sql.NullString
+	var lockedBy sql.NullString
+	var leaseExpiresAt sql.NullTime
+	var completedAt sql.NullTime
+	if err := scanner.Scan(
+		&item.ID,
+		&item.Type,
+		&payloadRaw,
+		&dedupeKey,
+		&item.Status,
+		&item.Attempts,
+		&item.NextRunAt,
+		&lastError,
+		&resultRaw,
+		&lockedBy,
+		&leaseExpiresAt,
+		&item.CreatedAt,
+		&item.UpdatedAt,
+		&completedAt,
+	); err != nil {
+		return Job{}, err
+	}
+	item.DedupeKey = nullableString(dedupeKey)
+	item.LastError = nullableString(lastError)
+	item.LockedBy = nullableString(lockedBy)
+	item.LeaseExpiresAt = nullableTime(leaseExpiresAt)
+	item.CompletedAt = nullableTime(completedAt)
+
+	item.Payload = map[string]any{}
+	if payloadRaw != "" && payloadRaw != "null" {
+		if err := json.Unmarshal([]byte(payloadRaw), &item.Payload); err != nil {
+			return Job{}, err
+		}
+	}
+	if resultRaw.Valid && resultRaw.String != "" && resultRaw.String != "null" {
+		var result map[string]any
+		if err := json.Unmarshal([]byte(resultRaw.String), &result); err != nil {
+			return Job{}, err
+		}
+		item.Result = &result
+	}
+	return item, nil
+}
+
+func enqueueJob(ctx context.Context, q queryRower, id string, input EnqueueJobInput) (Job, error) {
+	payload := input.Payload
+	if payload == nil {
+		payload = map[string]any{}
+	}
+	payloadRaw, err := json.Marshal(payload)
+	if err != nil {
+		return Job{}, err
+	}
+	var runAt any
+	if input.RunAt != nil {
+		runAt = input.RunAt.UTC()
+	}
+	var dedupeKey any
+	if strings.TrimSpace(input.DedupeKey) != "" {
+		dedupeKey = strings.TrimSpace(input.DedupeKey)
+	}
+	var jobID any
+	if id != "" {
+		jobID = id
+	}
+
+	row := q.QueryRowContext(
+		ctx,
+		`INSERT INTO jobs (id, type, payload, dedupe_key, status, next_run_at)
+		 VALUES (COALESCE($1::uuid, gen_random_uuid()), $2, $3::jsonb, $4, 'queued', COALESCE($5::timestamptz, NOW()))
+		 ON CONFLICT (type, dedupe_key) WHERE status = 'queued' AND attempts = 0 AND dedupe_key IS NOT NULL DO NOTHING
+		 RETURNING `+jobColumns,
+		jobID,
+		input.Type,
+		string(payloadRaw),
+		dedupeKey,
+		runAt,
+	)
+	item, err := scanJob(row)
+	if err == nil || !errors.Is(err, sql.ErrNoRows) || dedupeKey == nil {
+		return item, err
+	}
+
+	row = q.QueryRowContext(
+		ctx,
+		`SELECT `+jobColumns+`
+		 FROM jobs
+		 WHERE type = $1 AND dedupe_key = $2
+		 ORDER BY (status = 'queued' AND attempts = 0) DESC, created_at DESC
+		 LIMIT 1`,
+		input.Type,
+		dedupeKey,
+	)
+	return scanJob(row)
+}
+
+func (s *Store) EnqueueJob(ctx context.Context, input EnqueueJobInput) (Job, error) {
+	item, err := enqueueJob(ctx, s.db, "", input)
+	if err != nil {
+		return Job{}, err
+	}
+	if item.Status == "queued" {
+		_ = s.NotifyJobs(ctx, NotifyTopicJob, item.ID)
+	}
+	return item, nil
+}
+
+func (s *Store) GetJobByID(ctx context.Context, id string) (Job, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT `+jobColumns+`
+		 FROM jobs
+		 WHERE id = $1
+		 LIMIT 1`,
+		id,
+	)
+	item, err := scanJob(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Job{}, ErrNotFound
+		}
+		return Job{}, err
+	}
+	return item, nil
+}
+
+func (s *Store) ListJobs(ctx context.Context, jobType, status string, limit, offset int) ([]Job, error) {
+	args := make([]any, 0, 4)
+	addArg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where := []string{"TRUE"}
+	if strings.TrimSpace(jobType) != "" {
+		where = append(where, "type = "+addArg(jobType))
+	}
+	if strings.TrimSpace(status) != "" {
+		where = append(where, "status = "+addArg(status))
+	}
+
+	query := fmt.Sprintf(
+		`SELECT %s
+		 FROM jobs
+		 WHERE %s
+		 ORDER BY created_at DESC
+		 LIMIT %s OFFSET %s`,
+		jobColumns,
+		strings.Join(where, " AND "),
+		addArg(limit),
+		addArg(offset),
+	)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]Job, 0)
+	for rows.Next() {
+		item, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// ClaimNextJob marks the oldest due job of one of types as running and leases
+// it to workerID until the lease expires or is renewed.
+func (s *Store) ClaimNextJob(ctx context.Context, workerID string, lease time.Duration, types []string) (Job, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`WITH picked AS (
+			SELECT id
+			FROM jobs
+			WHERE status = 'queued' AND next_run_at <= NOW() AND type = ANY($3)
+			ORDER BY next_run_at ASC, created_at ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE jobs AS j
+		SET status = 'running',
+		    attempts = j.attempts + 1,
+		    locked_by = $1,
+		    lease_expires_at = NOW() + make_interval(secs => $2),
+		    updated_at = NOW()
+		FROM picked
+		WHERE j.id = picked.id
+		RETURNING j.id::text, j.type, j.payload::text, j.dedupe_key, j.status, j.attempts, j.next_run_at,
+		          j.last_error, j.result::text, j.locked_by, j.lease_expires_at, j.created_at, j.updated_at, j.completed_at`,
+		workerID,
+		lease.Seconds(),
+		types,
+	)
+	job, err := scanJob(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Job{}, ErrNotFound
+		}
+		return Job{}, err
+	}
+	return job, nil
+}
+
+func (s *Store) RenewJobLease(ctx context.Context, id, workerID string, lease time.Duration) error {
+	result, err := s.db.ExecContext(
+		ctx,
+		`UPDATE jobs
+		 SET lease_expires_at = NOW() + make_interval(secs => $3),
+		     updated_at = NOW()
+		 WHERE id = $1 AND status = 'running' AND locked_by = $2`,
+		id,
+		workerID,
+		lease.Seconds(),
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// ReclaimExpiredJobLeases returns running jobs whose lease has lapsed to the
+// queue, or dead-letters them when they have no attempts left.
+func (s *Store) ReclaimExpiredJobLeases(ctx context.Context, maxAttempts int) (int64, error) {
+	result, err := s.db.ExecContext(
+		ctx,
+		`UPDATE jobs
+		 SET status = CASE WHEN attempts >= $1 THEN 'dead' ELSE 'queued' END,
+		     last_error = 'lease expired (held by ' || COALESCE(locked_by, 'unknown') || ')',
+		     completed_at = CASE WHEN attempts >= $1 THEN NOW() ELSE NULL END,
+		     next_run_at = NOW(),
+		     locked_by = NULL,
+		     lease_expires_at = NULL,
+		     updated_at = NOW()
+		 WHERE status = 'running' AND (lease_expires_at IS NULL OR lease_expires_at < NOW())`,
+		maxAttempts,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CompleteJob records a successful run. AI results are also appended to
+// ai_job_results in the same transaction so apply sees them atomically.
+func (s *Store) CompleteJob(ctx context.Context, id, workerID string, result map[string]any) error {
+	resultRaw, err := toJSONRaw(result)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var jobType string
+	err = tx.QueryRowContext(
+		ctx,
+		`UPDATE jobs
+		 SET status = 'succeeded',
+		     result = $3::jsonb,
+		     completed_at = NOW(),
+		     updated_at = NOW(),
+		     locked_by = NULL,
+		     lease_expires_at = NULL
+		 WHERE id = $1 AND status = 'running' AND locked_by = $2
+		 RETURNING type`,
+		id,
+		workerID,
+		string(resultRaw),
+	).Scan(&jobType)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrLeaseLost
+		}
+		return err
+	}
+
+	if jobType == JobTypeAI {
+		if _, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO ai_job_results (job_id, provider, model, result)
+			 SELECT id, provider, model, $2::jsonb FROM ai_jobs WHERE id = $1`,
+			id,
+			string(resultRaw),
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RetryJob puts a failed attempt back in the queue; the job is not claimable
+// again until nextRunAt.
+func (s *Store) RetryJob(ctx context.Context, id, workerID string, reason string, nextRunAt time.Time) error {
+	result, err := s.db.ExecContext(
+		ctx,
+		`UPDATE jobs
+		 SET status = 'queued',
+		     last_error = $3,
+		     next_run_at = $4,
+		     locked_by = NULL,
+		     lease_expires_at = NULL,
+		     updated_at = NOW()
+		 WHERE id = $1 AND status = 'running' AND locked_by = $2`,
+		id,
+		workerID,
+		reason,
+		nextRunAt,
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// ReleaseJob returns a job whose run was aborted by the worker itself (for
+// example on shutdown) to the queue without counting the attempt.
+func (s *Store) ReleaseJob(ctx context.Context, id, workerID string, reason string) error {
+	result, err := s.db.ExecContext(
+		ctx,
+		`UPDATE jobs
+		 SET status = 'queued',
+		     attempts = GREATEST(attempts - 1, 0),
+		     last_error = $3,
+		     next_run_at = NOW(),
+		     locked_by = NULL,
+		     lease_expires_at = NULL,
+		     updated_at = NOW()
+		 WHERE id = $1 AND status = 'running' AND locked_by = $2`,
+		id,
+		workerID,
+		reason,
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// DeadLetterJob parks a job that has exhausted its attempts (or failed
+// permanently) in the dead status until an admin requeues it.
+func (s *Store) DeadLetterJob(ctx context.Context, id, workerID string, reason string) error {
+	result, err := s.db.ExecContext(
+		ctx,
+		`UPDATE jobs
+		 SET status = 'dead',
+		     last_error = $3,
+		     completed_at = NOW(),
+		     locked_by = NULL,
+		     lease_expires_at = NULL,
+		     updated_at = NOW()
+		 WHERE id = $1 AND status = 'running' AND locked_by = $2`,
+		id,
+		workerID,
+		reason,
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (s *Store) RequeueDeadJob(ctx context.Context, id string) (Job, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`UPDATE jobs
+		 SET status = 'queued',
+		     attempts = 0,
+		     dedupe_key = NULL,
+		     next_run_at = NOW(),
+		     completed_at = NULL,
+		     updated_at = NOW()
+		 WHERE id = $1 AND status = 'dead'
+		 RETURNING `+jobColumns,
+		id,
+	)
+	item, err := scanJob(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Job{}, ErrNotFound
+		}
+		return Job{}, err
+	}
+	_ = s.NotifyJobs(ctx, NotifyTopicJob, item.ID)
+	return item, nil
+}
+
+// scheduledContentTables maps content kinds to the tables that can hold
+// scheduled rows, in the order due items are published.
+var scheduledContentTables = []struct {
+	kind  string
+	table string
+}{
+	{"post", "posts"},
+	{"moment", "moments"},
+	{"gallery", "gallery"},
+}
+
+func (s *Store) HasDueScheduledContent(ctx context.Context) (bool, error) {
+	var due bool
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM posts WHERE status = 'scheduled' AND deleted_at IS NULL AND published_at <= NOW())
+		     OR EXISTS (SELECT 1 FROM moments WHERE status = 'scheduled' AND deleted_at IS NULL AND published_at <= NOW())
+		     OR EXISTS (SELECT 1 FROM gallery WHERE status = 'scheduled' AND deleted_at IS NULL AND published_at <= NOW())`,
+	).Scan(&due)
+	return due, err
+}
+
+// PublishDueScheduledContent flips every scheduled post, moment and gallery
+// item whose published_at has passed to published and returns what changed.
+// Each flip is a new revision; the scheduled version is archived first, and
+// change is recorded for every item with its publishedAt added.
+func (s *Store) PublishDueScheduledContent(ctx context.Context, updatedBy string, change ContentChange) ([]ScheduledPublication, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	items := make([]ScheduledPublication, 0)
+	for _, entry := range scheduledContentTables {
+		ids, err := lockDueScheduledContent(ctx, tx, entry.table)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		if err := archiveRevisions(ctx, tx, entry.kind, ids); err != nil {
+			return nil, err
+		}
+		rows, err := tx.QueryContext(
+			ctx,
+			fmt.Sprintf(
+				`UPDATE %s
+				 SET status = 'published',
+				     revision = COALESCE(revision, 1) + 1,
+				     updated_by = $2,
+				     updated_at = NOW()
+				 WHERE id = ANY($1::uuid[])
+				 RETURNING id::text, published_at`,
+				entry.table,
+			),
+			ids,
+			updatedBy,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			item := ScheduledPublication{Kind: entry.kind}
+			if err := rows.Scan(&item.ID, &item.PublishedAt); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rows.Close()
+	}
+	for _, item := range items {
+		if err := s.recordContentChange(ctx, tx, item.Kind, item.ID, nil, change.withMetadata("publishedAt", item.PublishedAt)); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func lockDueScheduledContent(ctx context.Context, tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			`SELECT id::text
+			 FROM %s
+			 WHERE status = 'scheduled' AND deleted_at IS NULL AND published_at <= NOW()
+			 FOR UPDATE SKIP LOCKED`,
+			table,
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
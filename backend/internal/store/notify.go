@@ -0,0 +1,42 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// JobNotifyChannel is the Postgres NOTIFY channel tdp-worker listens on to
+// wake up as soon as work is queued.
+const JobNotifyChannel = "tdp_jobs"
+
+const NotifyTopicJob = "job"
+
+type JobNotification struct {
+	Topic string `json:"topic"`
+	ID    string `json:"id,omitempty"`
+}
+
+func ParseJobNotification(payload string) (JobNotification, error) {
+	var item JobNotification
+	if err := json.Unmarshal([]byte(payload), &item); err != nil {
+		return JobNotification{}, err
+	}
+	return item, nil
+}
+
+// NotifyJobs publishes a wakeup on JobNotifyChannel. Delivery is best effort;
+// workers still poll, so callers may ignore the error.
+func (s *Store) NotifyJobs(ctx context.Context, topic, id string) error {
+	return notifyJobs(ctx, s.db, topic, id)
+}
+
+// notifyJobs publishes the wakeup through q. Inside a transaction Postgres
+// holds the notification until commit and drops it on rollback.
+func notifyJobs(ctx context.Context, q execer, topic, id string) error {
+	payload, err := json.Marshal(JobNotification{Topic: topic, ID: id})
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, `SELECT pg_notify($1, $2)`, JobNotifyChannel, string(payload))
+	return err
+}
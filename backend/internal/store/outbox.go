@@ -0,0 +1,363 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const JobTypeOutboxDispatch = "outbox_dispatch"
+
+const outboxEventColumns = `id, tx_id, event_id::text, event_type, resource_type, resource_id, actor_key_id, payload::text,
+	created_at, dispatched_at`
+
+// ContentChange describes the side effects of a content write. The store
+// records them in the write's own transaction: an audit entry and an outbox
+// event <kind>.<Event>, which tdp-worker later relays to webhook deliveries
+// and a search snapshot refresh. Either all of it commits or none of it does.
+type ContentChange struct {
+	ActorKeyID string
+	// Event is the past-tense change: created, updated, published,
+	// unpublished, deleted or restored.
+	Event string
+	// AuditAction overrides the default <kind>.<verb> audit action.
+	AuditAction string
+	Metadata    map[string]any
+}
+
+var contentAuditVerbs = map[string]string{
+	"created":     "create",
+	"updated":     "update",
+	"published":   "publish",
+	"unpublished": "unpublish",
+	"deleted":     "delete",
+	"restored":    "restore",
+}
+
+// withMetadata returns a copy of the change with key set in its audit
+// metadata.
+func (c ContentChange) withMetadata(key string, value any) ContentChange {
+	metadata := make(map[string]any, len(c.Metadata)+1)
+	for k, v := range c.Metadata {
+		metadata[k] = v
+	}
+	metadata[key] = value
+	c.Metadata = metadata
+	return c
+}
+
+func (c ContentChange) auditAction(kind string) string {
+	if c.AuditAction != "" {
+		return c.AuditAction
+	}
+	return kind + "." + contentAuditVerbs[c.Event]
+}
+
+// recordContentChange writes the audit entry and outbox event for a change
+// made in tx, and queues the dispatch job. item is the version the write
+// produced, or nil when the caller does not have it; the relay then attaches
+// the current version.
+func (s *Store) recordContentChange(ctx context.Context, tx *sql.Tx, kind, id string, item any, change ContentChange) error {
+	if err := insertAuditLog(ctx, tx, s.auditKey, change.ActorKeyID, change.auditAction(kind), kind, id, change.Metadata); err != nil {
+		return err
+	}
+	payload := map[string]any{"kind": kind, "id": id}
+	if item != nil {
+		payload["item"] = item
+	}
+	if err := insertOutboxEvent(ctx, tx, kind+"."+change.Event, kind, id, change.ActorKeyID, payload, true); err != nil {
+		return err
+	}
+	if _, err := enqueueJob(ctx, tx, "", EnqueueJobInput{
+		Type:      JobTypeOutboxDispatch,
+		DedupeKey: "pending",
+	}); err != nil {
+		return err
+	}
+	// Sent on commit, so the worker never wakes up before the event is visible.
+	return notifyJobs(ctx, tx, NotifyTopicJob, "")
+}
+
+// insertOutboxEvent adds an event to the outbox. Events with nothing to relay
+// (relay false) are only there for the event stream and are written already
+// dispatched.
+func insertOutboxEvent(ctx context.Context, q execer, eventType, resourceType, resourceID, actorKeyID string, payload map[string]any, relay bool) error {
+	payloadRaw, err := toJSONRaw(payload)
+	if err != nil {
+		return err
+	}
+	var actor any
+	if actorKeyID != "" {
+		actor = actorKeyID
+	}
+	_, err = q.ExecContext(
+		ctx,
+		`INSERT INTO outbox_events (event_type, resource_type, resource_id, actor_key_id, payload, dispatched_at)
+		 VALUES ($1, $2, $3, $4, $5::jsonb, CASE WHEN $6 THEN NULL ELSE NOW() END)`,
+		eventType,
+		resourceType,
+		resourceID,
+		actor,
+		string(payloadRaw),
+		relay,
+	)
+	return err
+}
+
+func scanOutboxEvent(scanner interface{ Scan(dest ...any) error }) (OutboxEvent, error) {
+	var item OutboxEvent
+	var actorKeyID sql.NullString
+	var payloadRaw string
+	var dispatchedAt sql.NullTime
+	if err := scanner.Scan(
+		&item.ID,
+		&item.TxID,
+		&item.EventID,
+		&item.Type,
+		&item.ResourceType,
+		&item.ResourceID,
+		&actorKeyID,
+		&payloadRaw,
+		&item.CreatedAt,
+		&dispatchedAt,
+	); err != nil {
+		return OutboxEvent{}, err
+	}
+	item.ActorKeyID = nullableString(actorKeyID)
+	item.DispatchedAt = nullableTime(dispatchedAt)
+
+	item.Payload = map[string]any{}
+	if payloadRaw != "" && payloadRaw != "null" {
+		if err := json.Unmarshal([]byte(payloadRaw), &item.Payload); err != nil {
+			return OutboxEvent{}, err
+		}
+	}
+	return item, nil
+}
+
+type OutboxDispatchResult struct {
+	Events     int `json:"events"`
+	Deliveries int `json:"deliveries"`
+}
+
+// DispatchOutbox relays up to limit undispatched events, oldest first: each
+// becomes a webhook delivery per matching subscription, and one search
+// snapshot refresh is requested for the batch. Events are marked dispatched
+// in the same transaction. Concurrent dispatchers skip each other's rows.
+func (s *Store) DispatchOutbox(ctx context.Context, actorKeyID string, limit int) (OutboxDispatchResult, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return OutboxDispatchResult{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT `+outboxEventColumns+`
+		 FROM outbox_events
+		 WHERE dispatched_at IS NULL
+		 ORDER BY id ASC
+		 LIMIT $1
+		 FOR UPDATE SKIP LOCKED`,
+		limit,
+	)
+	if err != nil {
+		return OutboxDispatchResult{}, err
+	}
+	events := make([]OutboxEvent, 0)
+	for rows.Next() {
+		item, err := scanOutboxEvent(rows)
+		if err != nil {
+			rows.Close()
+			return OutboxDispatchResult{}, err
+		}
+		events = append(events, item)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return OutboxDispatchResult{}, err
+	}
+	rows.Close()
+
+	var result OutboxDispatchResult
+	if len(events) == 0 {
+		return result, nil
+	}
+
+	ids := make([]int64, 0, len(events))
+	for _, event := range events {
+		payload := event.Payload
+		if _, ok := payload["item"]; !ok && event.Type != event.ResourceType+".deleted" {
+			item, err := s.getContentItem(ctx, event.ResourceType, event.ResourceID)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return OutboxDispatchResult{}, err
+			}
+			if err == nil {
+				payload["item"] = item
+			}
+		}
+		queued, err := enqueueWebhookEvent(ctx, tx, event.EventID, event.Type, payload)
+		if err != nil {
+			return OutboxDispatchResult{}, err
+		}
+		result.Deliveries += queued
+		ids = append(ids, event.ID)
+	}
+
+	if err := requestSearchSnapshotRefresh(ctx, tx); err != nil {
+		return OutboxDispatchResult{}, err
+	}
+	if err := insertAuditLog(ctx, tx, s.auditKey, actorKeyID, "search_snapshot.request", "search_snapshot", "singleton", map[string]any{
+		"reason": "outbox",
+		"events": len(events),
+	}); err != nil {
+		return OutboxDispatchResult{}, err
+	}
+	if _, err := tx.ExecContext(
+		ctx,
+		`UPDATE outbox_events SET dispatched_at = NOW() WHERE id = ANY($1::bigint[])`,
+		ids,
+	); err != nil {
+		return OutboxDispatchResult{}, err
+	}
+	if err := notifyJobs(ctx, tx, NotifyTopicJob, ""); err != nil {
+		return OutboxDispatchResult{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return OutboxDispatchResult{}, err
+	}
+	result.Events = len(events)
+	return result, nil
+}
+
+// getContentItem loads the current version of a content item for an outbox
+// event recorded without one.
+func (s *Store) getContentItem(ctx context.Context, kind, id string) (any, error) {
+	switch kind {
+	case "post":
+		return s.GetPostByID(ctx, id)
+	case "moment":
+		return s.GetMomentByID(ctx, id)
+	case "gallery":
+		return s.GetGalleryByID(ctx, id)
+	default:
+		return nil, ErrNotFound
+	}
+}
+
+// StreamEventTypes lists the event types GET /v1/events can deliver: every
+// content event, job status changes (written by a trigger on jobs) and search
+// snapshot rebuilds.
+var StreamEventTypes = append(append([]string{}, WebhookEventTypes...),
+	"job.queued",
+	"job.running",
+	"job.succeeded",
+	"job.dead",
+	"search_snapshot.refreshed",
+)
+
+// ValidateStreamEventType reports whether eventType is a stream event type or
+// a wildcard over a known prefix.
+func ValidateStreamEventType(eventType string) error {
+	if matchesKnownEvent(StreamEventTypes, eventType) {
+		return nil
+	}
+	return fmt.Errorf("unknown event type: %s", eventType)
+}
+
+// OutboxCursor is a reader's position in the outbox event stream. Events are
+// read in (TxID, ID) order, and only once no transaction that could still
+// commit an earlier event is running, so advancing a cursor never skips one.
+type OutboxCursor struct {
+	TxID int64
+	ID   int64
+}
+
+// OutboxHead returns a cursor after every event that is already readable,
+// for a reader that only wants new events.
+func (s *Store) OutboxHead(ctx context.Context) (OutboxCursor, error) {
+	var cursor OutboxCursor
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT pg_snapshot_xmin(pg_current_snapshot())::text::bigint`,
+	).Scan(&cursor.TxID)
+	return cursor, err
+}
+
+// OutboxCursorAt returns the cursor just past event id, or ErrNotFound when
+// the event does not exist or has been swept.
+func (s *Store) OutboxCursorAt(ctx context.Context, id int64) (OutboxCursor, error) {
+	cursor := OutboxCursor{ID: id}
+	err := s.db.QueryRowContext(ctx, `SELECT tx_id FROM outbox_events WHERE id = $1`, id).Scan(&cursor.TxID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return OutboxCursor{}, ErrNotFound
+		}
+		return OutboxCursor{}, err
+	}
+	return cursor, nil
+}
+
+// ListOutboxEvents returns up to limit readable events after cursor. types
+// filters by event type; an entry may also be a "<prefix>.*" wildcard such as
+// "job.*". An empty list matches every event.
+func (s *Store) ListOutboxEvents(ctx context.Context, after OutboxCursor, types []string, limit int) ([]OutboxEvent, error) {
+	args := []any{after.TxID, after.ID}
+	addArg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where := []string{
+		"(tx_id, id) > ($1, $2)",
+		"tx_id < pg_snapshot_xmin(pg_current_snapshot())::text::bigint",
+	}
+	if len(types) > 0 {
+		exact := make([]string, 0, len(types))
+		prefixes := make([]string, 0)
+		for _, eventType := range types {
+			if prefix, ok := strings.CutSuffix(eventType, ".*"); ok {
+				prefixes = append(prefixes, escapeLikePattern(prefix)+".%")
+				continue
+			}
+			exact = append(exact, eventType)
+		}
+		where = append(where, fmt.Sprintf(
+			"(event_type = ANY(%s::text[]) OR event_type LIKE ANY(%s::text[]))",
+			addArg(exact),
+			addArg(prefixes),
+		))
+	}
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			`SELECT %s
+			 FROM outbox_events
+			 WHERE %s
+			 ORDER BY tx_id ASC, id ASC
+			 LIMIT %s`,
+			outboxEventColumns,
+			strings.Join(where, " AND "),
+			addArg(limit),
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]OutboxEvent, 0)
+	for rows.Next() {
+		item, err := scanOutboxEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	PresenceVisibilityVisible = "visible"
+	PresenceVisibilityHidden  = "hidden"
+
+	PresenceGranularityCity    = "city"
+	PresenceGranularityCountry = "country"
+	PresenceGranularityOnline  = "online"
+)
+
+// PresenceHideableFields are the fields PresencePrivacy.HiddenFields may
+// name. City and country are governed by the granularity instead.
+var PresenceHideableFields = []string{"region", "timezone", "source"}
+
+// Hides reports whether field is listed in HiddenFields.
+func (p PresencePrivacy) Hides(field string) bool {
+	for _, hidden := range p.HiddenFields {
+		if hidden == field {
+			return true
+		}
+	}
+	return false
+}
+
+// ShowsLocation reports whether presence is public with any location.
+func (p PresencePrivacy) ShowsLocation() bool {
+	return p.Visibility != PresenceVisibilityHidden && p.Granularity != PresenceGranularityOnline
+}
+
+// insertPresenceHistory appends item's heartbeat, keeping no more than its
+// privacy settings make public: nothing while hidden or online-only, no city
+// or region at country granularity, and no hidden fields.
+func insertPresenceHistory(ctx context.Context, q execer, item PresenceStatus) error {
+	privacy := item.Privacy
+	if !privacy.ShowsLocation() {
+		return nil
+	}
+	var city any = item.City
+	region := item.Region
+	if privacy.Granularity == PresenceGranularityCountry {
+		city, region = nil, nil
+	}
+	if privacy.Hides("region") {
+		region = nil
+	}
+	timezone := item.Timezone
+	if privacy.Hides("timezone") {
+		timezone = nil
+	}
+	source := item.Source
+	if privacy.Hides("source") {
+		source = nil
+	}
+
+	_, err := q.ExecContext(
+		ctx,
+		`INSERT INTO presence_history (city, region, country, country_code, timezone, source, heartbeat_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		city,
+		region,
+		item.Country,
+		item.CountryCode,
+		timezone,
+		source,
+		item.LastHeartbeatAt,
+	)
+	return err
+}
+
+// ListPresenceVisits returns up to limit visits since the given time, newest
+// first. Consecutive heartbeats from the same city and country code collapse
+// into one visit, and its times are truncated to the hour, so the timeline
+// shows where but not exactly when. At country granularity visits are per
+// country and carry no city or region.
+func (s *Store) ListPresenceVisits(ctx context.Context, since time.Time, granularity string, limit int) ([]PresenceVisit, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT CASE WHEN $3::text = 'country' THEN NULL ELSE MAX(city) END,
+		        CASE WHEN $3::text = 'country' THEN NULL ELSE MAX(region) END,
+		        MAX(country), MAX(country_code),
+		        date_trunc('hour', MIN(heartbeat_at), 'UTC'),
+		        date_trunc('hour', MAX(heartbeat_at), 'UTC')
+		 FROM (
+		   SELECT city, region, country, country_code, heartbeat_at,
+		          SUM(moved) OVER (ORDER BY heartbeat_at, id) AS visit
+		   FROM (
+		     SELECT id, city, region, country, country_code, heartbeat_at,
+		            CASE WHEN ($3::text = 'country' OR lower(city) IS NOT DISTINCT FROM lower(LAG(city) OVER w))
+		                  AND upper(country_code) IS NOT DISTINCT FROM upper(LAG(country_code) OVER w)
+		                 THEN 0 ELSE 1 END AS moved
+		     FROM presence_history
+		     WHERE heartbeat_at >= $1
+		     WINDOW w AS (ORDER BY heartbeat_at, id)
+		   ) changes
+		 ) visits
+		 GROUP BY visit
+		 ORDER BY visit DESC
+		 LIMIT $2`,
+		since,
+		limit,
+		granularity,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]PresenceVisit, 0)
+	for rows.Next() {
+		var item PresenceVisit
+		var city sql.NullString
+		var region sql.NullString
+		var country sql.NullString
+		var countryCode sql.NullString
+		if err := rows.Scan(
+			&city,
+			&region,
+			&country,
+			&countryCode,
+			&item.ArrivedAt,
+			&item.LastSeenAt,
+		); err != nil {
+			return nil, err
+		}
+		item.City = nullableString(city)
+		item.Region = nullableString(region)
+		item.Country = nullableString(country)
+		item.CountryCode = nullableString(countryCode)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,358 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// pgUniqueViolation is the Postgres SQLSTATE for a unique constraint violation.
+const pgUniqueViolation = "23505"
+
+// revisionTable describes where a content kind keeps its rows and the prior
+// versions archived before each change. restoreColumns are copied back from
+// a snapshot on restore; status and published_at are left as they are.
+type revisionTable struct {
+	table          string
+	revisions      string
+	foreignKey     string
+	restoreColumns []string
+}
+
+var revisionTables = map[string]revisionTable{
+	"post": {
+		table:          "posts",
+		revisions:      "post_revisions",
+		foreignKey:     "post_id",
+		restoreColumns: []string{"slug", "locale", "title", "excerpt", "content", "cover_url", "tags", "card_span"},
+	},
+	"moment": {
+		table:          "moments",
+		revisions:      "moment_revisions",
+		foreignKey:     "moment_id",
+		restoreColumns: []string{"content", "media", "locale", "visibility", "location", "card_span"},
+	},
+	"gallery": {
+		table:      "gallery",
+		revisions:  "gallery_revisions",
+		foreignKey: "gallery_id",
+		restoreColumns: []string{
+			"locale", "file_url", "thumb_url", "title", "width", "height", "captured_at", "camera", "lens",
+			"focal_length", "aperture", "iso", "latitude", "longitude", "is_live_photo", "video_url",
+		},
+	},
+}
+
+func lookupRevisionTable(kind string) (revisionTable, error) {
+	table, ok := revisionTables[kind]
+	if !ok {
+		return revisionTable{}, fmt.Errorf("unsupported content kind: %s", kind)
+	}
+	return table, nil
+}
+
+// archiveRevisions locks the given rows and copies their current version into
+// the kind's revision table. Callers update the rows in the same transaction.
+func archiveRevisions(ctx context.Context, tx *sql.Tx, kind string, ids []string) error {
+	table, err := lookupRevisionTable(kind)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(
+		ctx,
+		fmt.Sprintf(`SELECT 1 FROM %s WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL FOR UPDATE`, table.table),
+		ids,
+	); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		fmt.Sprintf(
+			`INSERT INTO %s (%s, revision, snapshot, updated_by, updated_at)
+			 SELECT id, COALESCE(revision, 1), to_jsonb(c), updated_by, updated_at
+			 FROM %s c
+			 WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL
+			 ON CONFLICT (%s, revision) DO NOTHING`,
+			table.revisions,
+			table.foreignKey,
+			table.table,
+			table.foreignKey,
+		),
+		ids,
+	)
+	return err
+}
+
+// updateWithRevision archives the current version of a row and runs update in
+// the same transaction, so every revision bump keeps the version it replaced.
+// With expected set, the update only goes ahead if the locked row is still at
+// that version; otherwise it fails with ErrVersionConflict.
+func (s *Store) updateWithRevision(ctx context.Context, kind, id string, expected *ContentVersion, update func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := archiveRevisions(ctx, tx, kind, []string{id}); err != nil {
+		return err
+	}
+	if expected != nil {
+		if err := checkContentVersion(ctx, tx, kind, id, *expected); err != nil {
+			return err
+		}
+	}
+	if err := update(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func checkContentVersion(ctx context.Context, tx *sql.Tx, kind, id string, expected ContentVersion) error {
+	table, err := lookupRevisionTable(kind)
+	if err != nil {
+		return err
+	}
+	var current ContentVersion
+	err = tx.QueryRowContext(
+		ctx,
+		fmt.Sprintf(`SELECT COALESCE(revision, 1), updated_at FROM %s WHERE id = $1 AND deleted_at IS NULL`, table.table),
+		id,
+	).Scan(&current.Revision, &current.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	if !current.Matches(expected) {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+func scanContentRevision(scanner interface{ Scan(dest ...any) error }) (ContentRevision, error) {
+	var item ContentRevision
+	var updatedBy sql.NullString
+	if err := scanner.Scan(&item.Revision, &updatedBy, &item.UpdatedAt, &item.ReplacedAt); err != nil {
+		return ContentRevision{}, err
+	}
+	item.UpdatedBy = nullableString(updatedBy)
+	return item, nil
+}
+
+// ListContentRevisions returns the archived versions of a content item, newest
+// first. The current version is not included.
+func (s *Store) ListContentRevisions(ctx context.Context, kind, contentID string, limit, offset int) ([]ContentRevision, error) {
+	table, err := lookupRevisionTable(kind)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			`SELECT revision, updated_by, updated_at, replaced_at
+			 FROM %s
+			 WHERE %s = $1
+			 ORDER BY revision DESC
+			 LIMIT $2 OFFSET $3`,
+			table.revisions,
+			table.foreignKey,
+		),
+		contentID,
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]ContentRevision, 0)
+	for rows.Next() {
+		item, err := scanContentRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// revisionScanner reads the revision metadata columns ahead of the content
+// columns, letting the regular scanPost/scanMoment/scanGallery decode the
+// snapshot.
+type revisionScanner struct {
+	scanner   interface{ Scan(dest ...any) error }
+	revision  *ContentRevision
+	updatedBy *sql.NullString
+}
+
+func (r revisionScanner) Scan(dest ...any) error {
+	head := []any{&r.revision.Revision, r.updatedBy, &r.revision.UpdatedAt, &r.revision.ReplacedAt}
+	return r.scanner.Scan(append(head, dest...)...)
+}
+
+func (s *Store) queryRevision(ctx context.Context, kind, contentID string, revision int, columns string) (*sql.Row, error) {
+	table, err := lookupRevisionTable(kind)
+	if err != nil {
+		return nil, err
+	}
+	return s.db.QueryRowContext(
+		ctx,
+		fmt.Sprintf(
+			`SELECT h.revision, h.updated_by, h.updated_at, h.replaced_at, %s
+			 FROM %s h, jsonb_populate_record(NULL::%s, h.snapshot) c
+			 WHERE h.%s = $1 AND h.revision = $2
+			 LIMIT 1`,
+			columns,
+			table.revisions,
+			table.table,
+			table.foreignKey,
+		),
+		contentID,
+		revision,
+	), nil
+}
+
+func (s *Store) GetPostRevision(ctx context.Context, id string, revision int) (ContentRevision, Post, error) {
+	row, err := s.queryRevision(ctx, "post", id, revision,
+		`c.id::text, c.translation_key::text, c.slug, c.locale, c.title, c.excerpt, c.content, c.cover_url, c.tags, c.status, c.card_span,
+		 c.published_at, c.created_at, c.updated_at, COALESCE(c.revision, 1)`,
+	)
+	if err != nil {
+		return ContentRevision{}, Post{}, err
+	}
+	var meta ContentRevision
+	var updatedBy sql.NullString
+	item, err := scanPost(revisionScanner{scanner: row, revision: &meta, updatedBy: &updatedBy})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ContentRevision{}, Post{}, ErrNotFound
+		}
+		return ContentRevision{}, Post{}, err
+	}
+	meta.UpdatedBy = nullableString(updatedBy)
+	return meta, item, nil
+}
+
+func (s *Store) GetMomentRevision(ctx context.Context, id string, revision int) (ContentRevision, Moment, error) {
+	row, err := s.queryRevision(ctx, "moment", id, revision,
+		`c.id::text, c.translation_key::text, c.content, c.media, c.locale, c.visibility, c.location, c.status, c.card_span,
+		 c.published_at, c.created_at, c.updated_at, COALESCE(c.revision, 1)`,
+	)
+	if err != nil {
+		return ContentRevision{}, Moment{}, err
+	}
+	var meta ContentRevision
+	var updatedBy sql.NullString
+	item, err := scanMoment(revisionScanner{scanner: row, revision: &meta, updatedBy: &updatedBy})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ContentRevision{}, Moment{}, ErrNotFound
+		}
+		return ContentRevision{}, Moment{}, err
+	}
+	meta.UpdatedBy = nullableString(updatedBy)
+	return meta, item, nil
+}
+
+func (s *Store) GetGalleryRevision(ctx context.Context, id string, revision int) (ContentRevision, GalleryItem, error) {
+	row, err := s.queryRevision(ctx, "gallery", id, revision,
+		`c.id::text, c.translation_key::text, c.locale, c.file_url, c.thumb_url, c.title, c.width, c.height, c.captured_at, c.camera, c.lens,
+		 c.focal_length, c.aperture, c.iso, c.latitude, c.longitude, COALESCE(c.is_live_photo, false), c.video_url,
+		 c.status, c.published_at, c.created_at, c.updated_at, COALESCE(c.revision, 1)`,
+	)
+	if err != nil {
+		return ContentRevision{}, GalleryItem{}, err
+	}
+	var meta ContentRevision
+	var updatedBy sql.NullString
+	item, err := scanGallery(revisionScanner{scanner: row, revision: &meta, updatedBy: &updatedBy})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ContentRevision{}, GalleryItem{}, ErrNotFound
+		}
+		return ContentRevision{}, GalleryItem{}, err
+	}
+	meta.UpdatedBy = nullableString(updatedBy)
+	return meta, item, nil
+}
+
+// restoreRevision copies an archived version's content back onto the row as a
+// new revision, archiving the version it replaces first, and records the
+// restore with the revision it restored and the one it created.
+func (s *Store) restoreRevision(ctx context.Context, kind, id string, revision int, updatedBy *string, change ContentChange) error {
+	table, err := lookupRevisionTable(kind)
+	if err != nil {
+		return err
+	}
+	assignments := make([]string, 0, len(table.restoreColumns))
+	for _, column := range table.restoreColumns {
+		assignments = append(assignments, fmt.Sprintf("%s = r.%s", column, column))
+	}
+
+	return s.updateWithRevision(ctx, kind, id, nil, func(tx *sql.Tx) error {
+		var newRevision int
+		err := tx.QueryRowContext(
+			ctx,
+			fmt.Sprintf(
+				`UPDATE %s AS c
+				 SET %s,
+				     revision = COALESCE(c.revision, 1) + 1,
+				     updated_by = $3,
+				     updated_at = NOW()
+				 FROM %s h, jsonb_populate_record(NULL::%s, h.snapshot) r
+				 WHERE c.id = $1 AND c.deleted_at IS NULL AND h.%s = c.id AND h.revision = $2
+				 RETURNING c.revision`,
+				table.table,
+				strings.Join(assignments, ",\n\t\t\t\t     "),
+				table.revisions,
+				table.table,
+				table.foreignKey,
+			),
+			id,
+			revision,
+			updatedBy,
+		).Scan(&newRevision)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			// The revision's slug and locale may since have been taken by
+			// another item.
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+				return ErrRestoreConflict
+			}
+			return err
+		}
+		change = change.withMetadata("restoredRevision", revision).withMetadata("revision", newRevision)
+		return s.recordContentChange(ctx, tx, kind, id, nil, change)
+	})
+}
+
+func (s *Store) RestorePostRevision(ctx context.Context, id string, revision int, updatedBy *string, change ContentChange) (Post, error) {
+	if err := s.restoreRevision(ctx, "post", id, revision, updatedBy, change); err != nil {
+		return Post{}, err
+	}
+	return s.GetPostByID(ctx, id)
+}
+
+func (s *Store) RestoreMomentRevision(ctx context.Context, id string, revision int, updatedBy *string, change ContentChange) (Moment, error) {
+	if err := s.restoreRevision(ctx, "moment", id, revision, updatedBy, change); err != nil {
+		return Moment{}, err
+	}
+	return s.GetMomentByID(ctx, id)
+}
+
+func (s *Store) RestoreGalleryRevision(ctx context.Context, id string, revision int, updatedBy *string, change ContentChange) (GalleryItem, error) {
+	if err := s.restoreRevision(ctx, "gallery", id, revision, updatedBy, change); err != nil {
+		return GalleryItem{}, err
+	}
+	return s.GetGalleryByID(ctx, id)
+}
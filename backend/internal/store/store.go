@@ -9,6 +9,8 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"tdp-lite/backend/internal/secrets"
 )
 
 var (
@@ -17,6 +19,10 @@ var (
 	ErrIdempotencyConflict          = errors.New("idempotency key conflict")
 	ErrIdempotencyInProgress        = errors.New("idempotency request in progress")
 	ErrMomentContentOrMediaRequired = errors.New("moment content or media is required")
+	ErrLeaseLost                    = errors.New("job lease lost")
+	ErrScheduleTimeRequired         = errors.New("publishedAt is required for scheduled content")
+	ErrVersionConflict              = errors.New("content version changed")
+	ErrRestoreConflict              = errors.New("restored revision conflicts with another item")
 )
 
 const canonicalPublicLocale = "zh"
@@ -41,13 +47,29 @@ func momentForLocaleView(item Moment, locale string) Moment {
 }
 
 type Store struct {
-	db *sql.DB
+	db       *sql.DB
+	secrets  *secrets.Keyring
+	auditKey []byte
 }
 
 func New(db *sql.DB) *Store {
 	return &Store{db: db}
 }
 
+// SetSecretKeyring enables encryption of API key secrets at rest. Without a
+// keyring new secrets are stored in plaintext, as before.
+func (s *Store) SetSecretKeyring(keyring *secrets.Keyring) {
+	s.secrets = keyring
+}
+
+// SetAuditKey keys the audit log hash chain with HMAC-SHA256. The key stays
+// out of Postgres, so someone who can write to the database cannot recompute
+// the chain after editing it. Without a key entries are chained with plain
+// SHA-256.
+func (s *Store) SetAuditKey(key []byte) {
+	s.auditKey = key
+}
+
 func (s *Store) Ping(ctx context.Context) error {
 	return s.db.PingContext(ctx)
 }
@@ -156,10 +178,19 @@ func (s *Store) GetAPIKeyByKeyID(ctx context.Context, keyID string) (APIKeyRecor
 	var scopesRaw []byte
 	var revokedAt sql.NullTime
 	var lastUsedAt sql.NullTime
+	var previousSecret sql.NullString
+	var previousPublicKey sql.NullString
+	var previousExpiresAt sql.NullTime
+	var expiresAt sql.NullTime
+	var cidrsRaw []byte
 
 	err := s.db.QueryRowContext(
 		ctx,
-		`SELECT id::text, key_id, name, secret_ciphertext, scopes, revoked_at, created_at, last_used_at
+		`SELECT id::text, key_id, name, COALESCE(secret_ciphertext, ''), scopes, revoked_at, created_at, last_used_at,
+		        CASE WHEN previous_secret_expires_at > NOW() THEN previous_secret_ciphertext END,
+		        CASE WHEN previous_secret_expires_at > NOW() THEN previous_public_key END,
+		        CASE WHEN previous_secret_expires_at > NOW() THEN previous_secret_expires_at END,
+		        expires_at, allowed_cidrs, rate_limit_per_minute, algorithm, COALESCE(public_key, '')
 		 FROM api_keys
 		 WHERE key_id = $1
 		 LIMIT 1`,
@@ -173,6 +204,14 @@ func (s *Store) GetAPIKeyByKeyID(ctx context.Context, keyID string) (APIKeyRecor
 		&revokedAt,
 		&record.CreatedAt,
 		&lastUsedAt,
+		&previousSecret,
+		&previousPublicKey,
+		&previousExpiresAt,
+		&expiresAt,
+		&cidrsRaw,
+		&record.RateLimitPerMinute,
+		&record.Algorithm,
+		&record.PublicKey,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -185,12 +224,49 @@ func (s *Store) GetAPIKeyByKeyID(ctx context.Context, keyID string) (APIKeyRecor
 	if err != nil {
 		return APIKeyRecord{}, err
 	}
+	record.AllowedCIDRs, err = parseJSONArray(cidrsRaw)
+	if err != nil {
+		return APIKeyRecord{}, err
+	}
+	record.ExpiresAt = nullableTime(expiresAt)
+	record.Secret, err = s.secrets.Open(record.Secret, []byte(record.KeyID))
+	if err != nil {
+		return APIKeyRecord{}, err
+	}
+	if previousSecret.Valid {
+		record.PreviousSecret, err = s.secrets.Open(previousSecret.String, []byte(record.KeyID))
+		if err != nil {
+			return APIKeyRecord{}, err
+		}
+	}
+	record.PreviousPublicKey = previousPublicKey.String
+	if previousSecret.Valid || previousPublicKey.Valid {
+		record.PreviousSecretExpiresAt = nullableTime(previousExpiresAt)
+	}
 	record.Scopes = scopes
 	record.RevokedAt = nullableTime(revokedAt)
 	record.LastUsedAt = nullableTime(lastUsedAt)
 	return record, nil
 }
 
+// sealSecret returns the value to store in a secret column (such as
+// api_keys.secret_ciphertext) and the master key version it was sealed with
+// (NULL for plaintext). owner, the API key id or webhook id, is bound to the
+// sealed value. An empty secret (Ed25519 keys) stores NULL.
+func (s *Store) sealSecret(owner, secret string) (any, any, error) {
+	if secret == "" {
+		return nil, nil, nil
+	}
+	if s.secrets == nil {
+		return secret, nil, nil
+	}
+	sealed, err := s.secrets.Seal(secret, []byte(owner))
+	if err != nil {
+		return "", nil, err
+	}
+	return sealed, s.secrets.ActiveVersion(), nil
+}
+
 func (s *Store) TouchAPIKeyUsage(ctx context.Context, keyID string) error {
 	_, err := s.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = NOW() WHERE key_id = $1`, keyID)
 	return err
@@ -215,25 +291,63 @@ func (s *Store) RegisterNonce(ctx context.Context, keyID string, nonce string, t
 	if rows == 0 {
 		return ErrNonceUsed
 	}
-
-	_, _ = s.db.ExecContext(ctx, `DELETE FROM request_nonces WHERE expires_at < NOW()`)
 	return nil
 }
 
+// CountAPIKeyRequest counts a request against the key's current one-minute
+// window and returns the count so far and the time left until the window
+// resets.
+func (s *Store) CountAPIKeyRequest(ctx context.Context, keyID string) (int, time.Duration, error) {
+	var count int
+	var resetSeconds float64
+	err := s.db.QueryRowContext(
+		ctx,
+		`INSERT INTO api_key_rate_windows (key_id, window_start, request_count)
+		 VALUES ($1, date_trunc('minute', NOW()), 1)
+		 ON CONFLICT (key_id) DO UPDATE
+		 SET request_count = CASE
+		       WHEN api_key_rate_windows.window_start = EXCLUDED.window_start THEN api_key_rate_windows.request_count + 1
+		       ELSE 1
+		     END,
+		     window_start = EXCLUDED.window_start
+		 RETURNING request_count, EXTRACT(EPOCH FROM window_start + INTERVAL '1 minute' - NOW())::double precision`,
+		keyID,
+	).Scan(&count, &resetSeconds)
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, time.Duration(resetSeconds * float64(time.Second)), nil
+}
+
+// IdempotencyResult is the outcome of claiming an idempotency key. When the
+// key already completed, Owned is false and the stored response is returned
+// for replay.
 type IdempotencyResult struct {
 	Owned       bool
-	Response    *map[string]any
 	RequestHash string
+	StatusCode  int
+	Headers     map[string]string
+	Response    json.RawMessage
 }
 
-func (s *Store) BeginIdempotency(ctx context.Context, key string, requestHash string) (IdempotencyResult, error) {
+// BeginIdempotency claims key for the calling API key (scope). A key left
+// in_progress past its lock (the request crashed or timed out) is taken over
+// by a retry with the same payload.
+func (s *Store) BeginIdempotency(ctx context.Context, scope, key, requestHash string, lockTTL time.Duration) (IdempotencyResult, error) {
 	result, err := s.db.ExecContext(
 		ctx,
-		`INSERT INTO idempotency_keys (key, request_hash, status, created_at, updated_at)
-		 VALUES ($1, $2, 'in_progress', NOW(), NOW())
-		 ON CONFLICT (key) DO NOTHING`,
+		`INSERT INTO idempotency_keys (api_key_id, key, request_hash, status, locked_until, created_at, updated_at)
+		 VALUES ($1, $2, $3, 'in_progress', NOW() + make_interval(secs => $4::double precision), NOW(), NOW())
+		 ON CONFLICT (api_key_id, key) DO UPDATE
+		 SET locked_until = EXCLUDED.locked_until,
+		     updated_at = NOW()
+		 WHERE idempotency_keys.status = 'in_progress'
+		   AND idempotency_keys.locked_until < NOW()
+		   AND idempotency_keys.request_hash = EXCLUDED.request_hash`,
+		scope,
 		key,
 		requestHash,
+		lockTTL.Seconds(),
 	)
 	if err != nil {
 		return IdempotencyResult{}, err
@@ -245,14 +359,17 @@ func (s *Store) BeginIdempotency(ctx context.Context, key string, requestHash st
 
 	var storedHash string
 	var status string
+	var statusCode sql.NullInt32
+	var headersRaw []byte
 	var responseRaw []byte
 	err = s.db.QueryRowContext(
 		ctx,
-		`SELECT request_hash, status, COALESCE(response::text, '{}')
+		`SELECT request_hash, status, status_code, response_headers, COALESCE(response::text, '{}')
 		 FROM idempotency_keys
-		 WHERE key = $1`,
+		 WHERE api_key_id = $1 AND key = $2`,
+		scope,
 		key,
-	).Scan(&storedHash, &status, &responseRaw)
+	).Scan(&storedHash, &status, &statusCode, &headersRaw, &responseRaw)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return IdempotencyResult{}, ErrIdempotencyInProgress
@@ -265,37 +382,73 @@ func (s *Store) BeginIdempotency(ctx context.Context, key string, requestHash st
 	}
 
 	if status == "completed" {
-		var payload map[string]any
-		if err := json.Unmarshal(responseRaw, &payload); err != nil {
+		headers := map[string]string{}
+		if err := json.Unmarshal(headersRaw, &headers); err != nil {
 			return IdempotencyResult{}, err
 		}
-		return IdempotencyResult{Owned: false, RequestHash: storedHash, Response: &payload}, nil
+		code := 200
+		if statusCode.Valid {
+			code = int(statusCode.Int32)
+		}
+		return IdempotencyResult{
+			RequestHash: storedHash,
+			StatusCode:  code,
+			Headers:     headers,
+			Response:    json.RawMessage(responseRaw),
+		}, nil
 	}
 
 	return IdempotencyResult{}, ErrIdempotencyInProgress
 }
 
-func (s *Store) FinalizeIdempotency(ctx context.Context, key string, requestHash string, response any) error {
+// FinalizeIdempotency stores the response for replay.
+func (s *Store) FinalizeIdempotency(ctx context.Context, scope, key, requestHash string, statusCode int, headers map[string]string, response any) error {
 	responseRaw, err := json.Marshal(response)
 	if err != nil {
 		return err
 	}
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	headersRaw, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
 	_, err = s.db.ExecContext(
 		ctx,
 		`UPDATE idempotency_keys
-		 SET status = 'completed', response = $3::jsonb, updated_at = NOW()
-		 WHERE key = $1 AND request_hash = $2`,
+		 SET status = 'completed', status_code = $4, response_headers = $5::jsonb, response = $6::jsonb, updated_at = NOW()
+		 WHERE api_key_id = $1 AND key = $2 AND request_hash = $3`,
+		scope,
 		key,
 		requestHash,
+		statusCode,
+		string(headersRaw),
 		string(responseRaw),
 	)
 	return err
 }
 
+// ReleaseIdempotency forgets an in-progress key whose request failed, so the
+// client can retry it right away.
+func (s *Store) ReleaseIdempotency(ctx context.Context, scope, key, requestHash string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`DELETE FROM idempotency_keys
+		 WHERE api_key_id = $1 AND key = $2 AND request_hash = $3 AND status = 'in_progress'`,
+		scope,
+		key,
+		requestHash,
+	)
+	return err
+}
+
 func (s *Store) ListAPIKeys(ctx context.Context) ([]APIKeyRecord, error) {
 	rows, err := s.db.QueryContext(
 		ctx,
-		`SELECT id::text, key_id, name, secret_ciphertext, scopes, revoked_at, created_at, last_used_at
+		`SELECT id::text, key_id, name, scopes, revoked_at, created_at, last_used_at,
+		        CASE WHEN previous_secret_expires_at > NOW() THEN previous_secret_expires_at END,
+		        expires_at, allowed_cidrs, rate_limit_per_minute, algorithm, COALESCE(public_key, '')
 		 FROM api_keys
 		 ORDER BY created_at DESC`,
 	)
@@ -310,15 +463,23 @@ func (s *Store) ListAPIKeys(ctx context.Context) ([]APIKeyRecord, error) {
 		var scopesRaw []byte
 		var revokedAt sql.NullTime
 		var lastUsedAt sql.NullTime
+		var previousExpiresAt sql.NullTime
+		var expiresAt sql.NullTime
+		var cidrsRaw []byte
 		if err := rows.Scan(
 			&row.ID,
 			&row.KeyID,
 			&row.Name,
-			&row.Secret,
 			&scopesRaw,
 			&revokedAt,
 			&row.CreatedAt,
 			&lastUsedAt,
+			&previousExpiresAt,
+			&expiresAt,
+			&cidrsRaw,
+			&row.RateLimitPerMinute,
+			&row.Algorithm,
+			&row.PublicKey,
 		); err != nil {
 			return nil, err
 		}
@@ -326,16 +487,35 @@ func (s *Store) ListAPIKeys(ctx context.Context) ([]APIKeyRecord, error) {
 		if err != nil {
 			return nil, err
 		}
+		row.AllowedCIDRs, err = parseJSONArray(cidrsRaw)
+		if err != nil {
+			return nil, err
+		}
+		row.ExpiresAt = nullableTime(expiresAt)
 		row.Scopes = scopes
 		row.RevokedAt = nullableTime(revokedAt)
 		row.LastUsedAt = nullableTime(lastUsedAt)
+		row.PreviousSecretExpiresAt = nullableTime(previousExpiresAt)
 		keys = append(keys, row)
 	}
 	return keys, rows.Err()
 }
 
-func (s *Store) CreateAPIKey(ctx context.Context, name, keyID, secret, keyHash string, scopes []string) (APIKeyRecord, error) {
-	scopesRaw, err := json.Marshal(scopes)
+func (s *Store) CreateAPIKey(ctx context.Context, input CreateAPIKeyInput) (APIKeyRecord, error) {
+	scopesRaw, err := json.Marshal(input.Scopes)
+	if err != nil {
+		return APIKeyRecord{}, err
+	}
+	limits := input.Limits
+	if limits.AllowedCIDRs == nil {
+		limits.AllowedCIDRs = []string{}
+	}
+	cidrsRaw, err := json.Marshal(limits.AllowedCIDRs)
+	if err != nil {
+		return APIKeyRecord{}, err
+	}
+
+	storedSecret, secretVersion, err := s.sealSecret(input.KeyID, input.Credential.Secret)
 	if err != nil {
 		return APIKeyRecord{}, err
 	}
@@ -344,26 +524,38 @@ func (s *Store) CreateAPIKey(ctx context.Context, name, keyID, secret, keyHash s
 	var storedScopes []byte
 	err = s.db.QueryRowContext(
 		ctx,
-		`INSERT INTO api_keys (name, key_hash, permissions, key_id, secret_ciphertext, scopes)
-		 VALUES ($1, $2, $3::jsonb, $4, $5, $6::jsonb)
-		 RETURNING id::text, key_id, name, secret_ciphertext, scopes, created_at`,
-		name,
-		keyHash,
+		`INSERT INTO api_keys (
+			name, key_hash, permissions, key_id, secret_ciphertext, secret_key_version, scopes,
+			expires_at, allowed_cidrs, rate_limit_per_minute, algorithm, public_key
+		 )
+		 VALUES ($1, $2, $3::jsonb, $4, $5, $6, $7::jsonb, $8, $9::jsonb, $10, $11, $12)
+		 RETURNING id::text, key_id, name, scopes, created_at`,
+		input.Name,
+		input.KeyHash,
 		string(scopesRaw),
-		keyID,
-		secret,
+		input.KeyID,
+		storedSecret,
+		secretVersion,
 		string(scopesRaw),
+		limits.ExpiresAt,
+		string(cidrsRaw),
+		limits.RateLimitPerMinute,
+		input.Credential.Algorithm,
+		sql.NullString{String: input.Credential.PublicKey, Valid: input.Credential.PublicKey != ""},
 	).Scan(
 		&record.ID,
 		&record.KeyID,
 		&record.Name,
-		&record.Secret,
 		&storedScopes,
 		&record.CreatedAt,
 	)
 	if err != nil {
 		return APIKeyRecord{}, err
 	}
+	record.Secret = input.Credential.Secret
+	record.Algorithm = input.Credential.Algorithm
+	record.PublicKey = input.Credential.PublicKey
+	record.APIKeyLimits = limits
 
 	record.Scopes, err = parseJSONArray(storedScopes)
 	if err != nil {
@@ -372,41 +564,173 @@ func (s *Store) CreateAPIKey(ctx context.Context, name, keyID, secret, keyHash s
 	return record, nil
 }
 
-func (s *Store) RotateAPIKey(ctx context.Context, keyID string, newSecret string, newHash string) error {
-	_, err := s.db.ExecContext(
+// RotateAPIKey replaces a key's secret or public key. For a grace period the
+// replaced credential stays valid as previous_*, so deployed clients keep
+// working until they pick up the new one; it returns when that window ends
+// (nil when grace is zero or the key was revoked).
+func (s *Store) RotateAPIKey(ctx context.Context, keyID string, credential APIKeyCredential, newHash string, grace time.Duration) (*time.Time, error) {
+	storedSecret, secretVersion, err := s.sealSecret(keyID, credential.Secret)
+	if err != nil {
+		return nil, err
+	}
+	var previousExpiresAt sql.NullTime
+	err = s.db.QueryRowContext(
 		ctx,
 		`UPDATE api_keys
-		 SET secret_ciphertext = $2,
+		 SET previous_secret_ciphertext = CASE WHEN $5::double precision > 0 AND revoked_at IS NULL THEN secret_ciphertext END,
+		     previous_secret_key_version = CASE WHEN $5::double precision > 0 AND revoked_at IS NULL THEN secret_key_version END,
+		     previous_public_key = CASE WHEN $5::double precision > 0 AND revoked_at IS NULL THEN public_key END,
+		     previous_secret_expires_at = CASE WHEN $5::double precision > 0 AND revoked_at IS NULL
+		                                       THEN NOW() + make_interval(secs => $5::double precision) END,
+		     secret_ciphertext = $2,
+		     secret_key_version = $4,
+		     public_key = $6,
 		     key_hash = $3,
 		     revoked_at = NULL,
 		     updated_at = NOW()
-		 WHERE key_id = $1`,
+		 WHERE key_id = $1
+		 RETURNING previous_secret_expires_at`,
 		keyID,
-		newSecret,
+		storedSecret,
 		newHash,
-	)
-	return err
+		secretVersion,
+		grace.Seconds(),
+		sql.NullString{String: credential.PublicKey, Valid: credential.PublicKey != ""},
+	).Scan(&previousExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return nullableTime(previousExpiresAt), nil
 }
 
-func (s *Store) RevokeAPIKey(ctx context.Context, keyID string) error {
-	_, err := s.db.ExecContext(ctx, `UPDATE api_keys SET revoked_at = NOW(), updated_at = NOW() WHERE key_id = $1`, keyID)
-	return err
+// sealedSecretColumns lists every stored secret with its master key version
+// column and the owner its seal is bound to.
+var sealedSecretColumns = []struct {
+	table    string
+	idColumn string
+	secret   string
+	version  string
+	owner    func(id string) string
+}{
+	{"api_keys", "key_id", "secret_ciphertext", "secret_key_version", apiKeySecretOwner},
+	{"api_keys", "key_id", "previous_secret_ciphertext", "previous_secret_key_version", apiKeySecretOwner},
+	{"webhook_subscriptions", "id", "secret_ciphertext", "secret_key_version", webhookSecretOwner},
+}
+
+func apiKeySecretOwner(keyID string) string {
+	return keyID
+}
+
+// ReencryptSecrets seals every API key secret (current and, during a
+// rotation grace period, previous) and webhook subscription secret that is
+// still plaintext or sealed with an older master key version under the active
+// version. Each value is updated only if it is unchanged, so it is safe to run
+// while the API is serving; it returns how many values were rewritten.
+func (s *Store) ReencryptSecrets(ctx context.Context) (int, error) {
+	if s.secrets == nil {
+		return 0, secrets.ErrNoKeyring
+	}
+	updated := 0
+	for _, column := range sealedSecretColumns {
+		count, err := s.reencryptSecretColumn(ctx, column.table, column.idColumn, column.secret, column.version, column.owner)
+		updated += count
+		if err != nil {
+			return updated, err
+		}
+	}
+	return updated, nil
 }
 
-func (s *Store) InsertAuditLog(ctx context.Context, actorKeyID, action, resourceType, resourceID string, metadata any) error {
-	metaRaw, err := toJSONRaw(metadata)
+func (s *Store) reencryptSecretColumn(ctx context.Context, table, idColumn, secretColumn, versionColumn string, owner func(string) string) (int, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			`SELECT %[3]s::text, %[1]s
+			 FROM %[4]s
+			 WHERE %[1]s IS NOT NULL
+			   AND %[2]s IS DISTINCT FROM $1`,
+			secretColumn,
+			versionColumn,
+			idColumn,
+			table,
+		),
+		s.secrets.ActiveVersion(),
+	)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	_, err = s.db.ExecContext(
+	type pendingSecret struct {
+		id     string
+		stored string
+	}
+	pending := make([]pendingSecret, 0)
+	for rows.Next() {
+		var item pendingSecret
+		if err := rows.Scan(&item.id, &item.stored); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pending = append(pending, item)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, err
+	}
+	rows.Close()
+
+	updated := 0
+	for _, item := range pending {
+		plaintext, err := s.secrets.Open(item.stored, []byte(owner(item.id)))
+		if err != nil {
+			return updated, fmt.Errorf("open %s.%s for %s: %w", table, secretColumn, item.id, err)
+		}
+		sealed, version, err := s.sealSecret(owner(item.id), plaintext)
+		if err != nil {
+			return updated, err
+		}
+		result, err := s.db.ExecContext(
+			ctx,
+			fmt.Sprintf(
+				`UPDATE %[4]s
+				 SET %[1]s = $3,
+				     %[2]s = $4,
+				     updated_at = NOW()
+				 WHERE %[3]s = $1 AND %[1]s = $2`,
+				secretColumn,
+				versionColumn,
+				idColumn,
+				table,
+			),
+			item.id,
+			item.stored,
+			sealed,
+			version,
+		)
+		if err != nil {
+			return updated, err
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+func (s *Store) RevokeAPIKey(ctx context.Context, keyID string) error {
+	_, err := s.db.ExecContext(
 		ctx,
-		`INSERT INTO audit_logs (actor_key_id, action, resource_type, resource_id, metadata)
-		 VALUES ($1, $2, $3, $4, $5::jsonb)`,
-		actorKeyID,
-		action,
-		resourceType,
-		resourceID,
-		string(metaRaw),
+		`UPDATE api_keys
+		 SET revoked_at = NOW(),
+		     previous_secret_ciphertext = NULL,
+		     previous_secret_key_version = NULL,
+		     previous_public_key = NULL,
+		     previous_secret_expires_at = NULL,
+		     updated_at = NOW()
+		 WHERE key_id = $1`,
+		keyID,
 	)
 	return err
 }
@@ -753,22 +1077,47 @@ type CreatePostInput struct {
 	UpdatedBy      *string
 }
 
-func (s *Store) CreatePost(ctx context.Context, input CreatePostInput) (Post, error) {
+// resolvePublishState maps a requested status to the stored status and
+// published_at. Published content dated in the future is held back as
+// scheduled; tdp-worker publishes it once published_at has passed.
+func resolvePublishState(status string, publishedAt *time.Time) (string, any, error) {
+	switch status {
+	case "published":
+		if publishedAt == nil {
+			return status, time.Now().UTC(), nil
+		}
+		if publishedAt.After(time.Now()) {
+			return "scheduled", publishedAt.UTC(), nil
+		}
+		return status, publishedAt.UTC(), nil
+	case "scheduled":
+		if publishedAt == nil {
+			return "", nil, ErrScheduleTimeRequired
+		}
+		return status, publishedAt.UTC(), nil
+	default:
+		return status, nil, nil
+	}
+}
+
+func (s *Store) CreatePost(ctx context.Context, input CreatePostInput, change ContentChange) (Post, error) {
 	tagsRaw, err := json.Marshal(input.Tags)
 	if err != nil {
 		return Post{}, err
 	}
 
-	var publishedAt any = nil
-	if input.Status == "published" {
-		if input.PublishedAt != nil {
-			publishedAt = input.PublishedAt.UTC()
-		} else {
-			publishedAt = time.Now().UTC()
-		}
+	status, publishedAt, err := resolvePublishState(input.Status, input.PublishedAt)
+	if err != nil {
+		return Post{}, err
 	}
 
-	row := s.db.QueryRowContext(
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Post{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	row := tx.QueryRowContext(
 		ctx,
 		`INSERT INTO posts (translation_key, slug, locale, title, excerpt, content, cover_url, tags, status, card_span, published_at, revision, updated_by)
 		 VALUES (COALESCE($1::uuid, gen_random_uuid()), $2, $3, $4, $5, $6, $7, $8::jsonb, $9, $10, $11, 1, $12)
@@ -782,12 +1131,22 @@ func (s *Store) CreatePost(ctx context.Context, input CreatePostInput) (Post, er
 		input.Content,
 		input.CoverURL,
 		string(tagsRaw),
-		input.Status,
+		status,
 		input.CardSpan,
 		publishedAt,
 		input.UpdatedBy,
 	)
-	return scanPost(row)
+	item, err := scanPost(row)
+	if err != nil {
+		return Post{}, err
+	}
+	if err := s.recordContentChange(ctx, tx, "post", item.ID, item, change.withMetadata("status", item.Status)); err != nil {
+		return Post{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Post{}, err
+	}
+	return item, nil
 }
 
 type UpdatePostInput struct {
@@ -804,13 +1163,19 @@ type UpdatePostInput struct {
 	PublishedAt    *time.Time
 	PublishedAtSet bool
 	UpdatedBy      *string
+	// ExpectedVersion, when set, makes the update fail with
+	// ErrVersionConflict unless the post is still at that version.
+	ExpectedVersion *ContentVersion
 }
 
-func (s *Store) UpdatePost(ctx context.Context, id string, input UpdatePostInput) (Post, error) {
+func (s *Store) UpdatePost(ctx context.Context, id string, input UpdatePostInput, change ContentChange) (Post, error) {
 	existing, err := s.GetPostByID(ctx, id)
 	if err != nil {
 		return Post{}, err
 	}
+	if input.ExpectedVersion != nil && !input.ExpectedVersion.Matches(existing.Version()) {
+		return Post{}, ErrVersionConflict
+	}
 
 	if input.Title != nil {
 		existing.Title = *input.Title
@@ -848,50 +1213,52 @@ func (s *Store) UpdatePost(ctx context.Context, id string, input UpdatePostInput
 		return Post{}, err
 	}
 
-	var publishedAt any
-	if existing.Status == "published" {
-		if existing.PublishedAt != nil {
-			publishedAt = existing.PublishedAt.UTC()
-		} else {
-			publishedAt = time.Now().UTC()
-		}
-	} else {
-		publishedAt = nil
+	status, publishedAt, err := resolvePublishState(existing.Status, existing.PublishedAt)
+	if err != nil {
+		return Post{}, err
 	}
 
-	row := s.db.QueryRowContext(
-		ctx,
-		`UPDATE posts
-		 SET slug = $2,
-		     locale = $3,
-		     title = $4,
-		     excerpt = $5,
-		     content = $6,
-		     cover_url = $7,
-		     tags = $8::jsonb,
-		     status = $9,
-		     card_span = $10,
-		     published_at = $11,
-		     revision = COALESCE(revision, 1) + 1,
-		     updated_by = $12,
-		     updated_at = NOW()
-		 WHERE id = $1 AND deleted_at IS NULL
-		 RETURNING id::text, translation_key::text, slug, locale, title, excerpt, content, cover_url, tags, status, card_span,
-		           published_at, created_at, updated_at, COALESCE(revision, 1)`,
-		id,
-		existing.Slug,
-		existing.Locale,
-		existing.Title,
-		existing.Excerpt,
-		existing.Content,
-		existing.CoverURL,
-		string(tagsRaw),
-		existing.Status,
-		existing.CardSpan,
-		publishedAt,
-		input.UpdatedBy,
-	)
-	item, err := scanPost(row)
+	var item Post
+	err = s.updateWithRevision(ctx, "post", id, input.ExpectedVersion, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(
+			ctx,
+			`UPDATE posts
+			 SET slug = $2,
+			     locale = $3,
+			     title = $4,
+			     excerpt = $5,
+			     content = $6,
+			     cover_url = $7,
+			     tags = $8::jsonb,
+			     status = $9,
+			     card_span = $10,
+			     published_at = $11,
+			     revision = COALESCE(revision, 1) + 1,
+			     updated_by = $12,
+			     updated_at = NOW()
+			 WHERE id = $1 AND deleted_at IS NULL
+			 RETURNING id::text, translation_key::text, slug, locale, title, excerpt, content, cover_url, tags, status, card_span,
+			           published_at, created_at, updated_at, COALESCE(revision, 1)`,
+			id,
+			existing.Slug,
+			existing.Locale,
+			existing.Title,
+			existing.Excerpt,
+			existing.Content,
+			existing.CoverURL,
+			string(tagsRaw),
+			status,
+			existing.CardSpan,
+			publishedAt,
+			input.UpdatedBy,
+		)
+		var scanErr error
+		item, scanErr = scanPost(row)
+		if scanErr != nil {
+			return scanErr
+		}
+		return s.recordContentChange(ctx, tx, "post", item.ID, item, change)
+	})
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Post{}, ErrNotFound
@@ -901,7 +1268,7 @@ func (s *Store) UpdatePost(ctx context.Context, id string, input UpdatePostInput
 	return item, nil
 }
 
-func (s *Store) SetPostStatus(ctx context.Context, id, status string, updatedBy *string) (Post, error) {
+func (s *Store) SetPostStatus(ctx context.Context, id, status string, updatedBy *string, change ContentChange) (Post, error) {
 	var publishedAt any
 	if status == "published" {
 		publishedAt = time.Now().UTC()
@@ -909,23 +1276,31 @@ func (s *Store) SetPostStatus(ctx context.Context, id, status string, updatedBy
 		publishedAt = nil
 	}
 
-	row := s.db.QueryRowContext(
-		ctx,
-		`UPDATE posts
-		 SET status = $2,
-		     published_at = $3,
-		     revision = COALESCE(revision, 1) + 1,
-		     updated_by = $4,
-		     updated_at = NOW()
-		 WHERE id = $1 AND deleted_at IS NULL
-		 RETURNING id::text, translation_key::text, slug, locale, title, excerpt, content, cover_url, tags, status, card_span,
-		           published_at, created_at, updated_at, COALESCE(revision, 1)`,
-		id,
-		status,
-		publishedAt,
-		updatedBy,
-	)
-	item, err := scanPost(row)
+	var item Post
+	err := s.updateWithRevision(ctx, "post", id, nil, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(
+			ctx,
+			`UPDATE posts
+			 SET status = $2,
+			     published_at = $3,
+			     revision = COALESCE(revision, 1) + 1,
+			     updated_by = $4,
+			     updated_at = NOW()
+			 WHERE id = $1 AND deleted_at IS NULL
+			 RETURNING id::text, translation_key::text, slug, locale, title, excerpt, content, cover_url, tags, status, card_span,
+			           published_at, created_at, updated_at, COALESCE(revision, 1)`,
+			id,
+			status,
+			publishedAt,
+			updatedBy,
+		)
+		var scanErr error
+		item, scanErr = scanPost(row)
+		if scanErr != nil {
+			return scanErr
+		}
+		return s.recordContentChange(ctx, tx, "post", item.ID, item, change)
+	})
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Post{}, ErrNotFound
@@ -935,8 +1310,20 @@ func (s *Store) SetPostStatus(ctx context.Context, id, status string, updatedBy
 	return item, nil
 }
 
-func (s *Store) SoftDeletePost(ctx context.Context, id string) error {
-	result, err := s.db.ExecContext(ctx, `UPDATE posts SET deleted_at = NOW(), updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id)
+func (s *Store) SoftDeletePost(ctx context.Context, id string, change ContentChange) error {
+	return s.softDeleteContent(ctx, "post", "posts", id, change)
+}
+
+// softDeleteContent hides a post, moment or gallery item and records the
+// deletion in the same transaction.
+func (s *Store) softDeleteContent(ctx context.Context, kind, table, id string, change ContentChange) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	result, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET deleted_at = NOW(), updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, table), id)
 	if err != nil {
 		return err
 	}
@@ -944,7 +1331,10 @@ func (s *Store) SoftDeletePost(ctx context.Context, id string) error {
 	if rows == 0 {
 		return ErrNotFound
 	}
-	return nil
+	if err := s.recordContentChange(ctx, tx, kind, id, nil, change); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func scanMoment(scanner interface{ Scan(dest ...any) error }) (Moment, error) {
@@ -967,6 +1357,7 @@ func scanMoment(scanner interface{ Scan(dest ...any) error }) (Moment, error) {
 		&publishedAt,
 		&item.CreatedAt,
 		&updatedAt,
+		&item.Revision,
 	); err != nil {
 		return Moment{}, err
 	}
@@ -993,7 +1384,7 @@ func scanMoment(scanner interface{ Scan(dest ...any) error }) (Moment, error) {
 func (s *Store) listPublishedMomentsByLocale(ctx context.Context, locale string, limit, offset int) ([]Moment, error) {
 	rows, err := s.db.QueryContext(
 		ctx,
-		`SELECT id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at
+		`SELECT id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at, COALESCE(revision, 1)
 		 FROM moments
 		 WHERE status = 'published' AND visibility = 'public' AND deleted_at IS NULL AND locale = $1
 		 ORDER BY COALESCE(published_at, created_at) DESC
@@ -1038,7 +1429,7 @@ func (s *Store) listPublishedMomentsByTranslationKeys(
 	rows, err := s.db.QueryContext(
 		ctx,
 		fmt.Sprintf(
-			`SELECT id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at
+			`SELECT id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at, COALESCE(revision, 1)
 			 FROM moments
 			 WHERE status = 'published' AND visibility = 'public' AND deleted_at IS NULL AND locale = $1 AND translation_key::text IN (%s)`,
 			strings.Join(placeholders, ", "),
@@ -1064,7 +1455,7 @@ func (s *Store) listPublishedMomentsByTranslationKeys(
 func (s *Store) getPublishedMomentByIDForLocale(ctx context.Context, locale, id string) (Moment, error) {
 	row := s.db.QueryRowContext(
 		ctx,
-		`SELECT id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at
+		`SELECT id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at, COALESCE(revision, 1)
 		 FROM moments
 		 WHERE id = $1 AND locale = $2 AND status = 'published' AND visibility = 'public' AND deleted_at IS NULL
 		 LIMIT 1`,
@@ -1084,7 +1475,7 @@ func (s *Store) getPublishedMomentByIDForLocale(ctx context.Context, locale, id
 func (s *Store) getPublishedMomentByIDAnyLocale(ctx context.Context, id string) (Moment, error) {
 	row := s.db.QueryRowContext(
 		ctx,
-		`SELECT id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at
+		`SELECT id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at, COALESCE(revision, 1)
 		 FROM moments
 		 WHERE id = $1 AND status = 'published' AND visibility = 'public' AND deleted_at IS NULL
 		 ORDER BY CASE WHEN locale = $2 THEN 0 ELSE 1 END
@@ -1108,7 +1499,7 @@ func (s *Store) getPublishedMomentByTranslationKeyForLocale(
 ) (Moment, error) {
 	row := s.db.QueryRowContext(
 		ctx,
-		`SELECT id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at
+		`SELECT id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at, COALESCE(revision, 1)
 		 FROM moments
 		 WHERE status = 'published' AND visibility = 'public' AND deleted_at IS NULL AND locale = $1 AND translation_key::text = $2
 		 LIMIT 1`,
@@ -1198,7 +1589,7 @@ func (s *Store) ListMomentsForAdmin(ctx context.Context, locale, status string,
 	}
 
 	query := fmt.Sprintf(
-		`SELECT id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at
+		`SELECT id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at, COALESCE(revision, 1)
 		 FROM moments
 		 WHERE %s
 		 ORDER BY COALESCE(published_at, created_at) DESC
@@ -1256,7 +1647,7 @@ func (s *Store) GetPublicMomentByID(ctx context.Context, locale, id string) (Mom
 func (s *Store) GetMomentByID(ctx context.Context, id string) (Moment, error) {
 	row := s.db.QueryRowContext(
 		ctx,
-		`SELECT id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at
+		`SELECT id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at, COALESCE(revision, 1)
 		 FROM moments
 		 WHERE id = $1 AND deleted_at IS NULL
 		 LIMIT 1`,
@@ -1282,9 +1673,10 @@ type CreateMomentInput struct {
 	Status         string
 	CardSpan       *string
 	PublishedAt    *time.Time
+	UpdatedBy      *string
 }
 
-func (s *Store) CreateMoment(ctx context.Context, input CreateMomentInput) (Moment, error) {
+func (s *Store) CreateMoment(ctx context.Context, input CreateMomentInput, change ContentChange) (Moment, error) {
 	if strings.TrimSpace(input.Content) == "" && len(input.Media) == 0 {
 		return Moment{}, ErrMomentContentOrMediaRequired
 	}
@@ -1298,31 +1690,44 @@ func (s *Store) CreateMoment(ctx context.Context, input CreateMomentInput) (Mome
 		return Moment{}, err
 	}
 
-	var publishedAt any
-	if input.Status == "published" {
-		if input.PublishedAt != nil {
-			publishedAt = input.PublishedAt.UTC()
-		} else {
-			publishedAt = time.Now().UTC()
-		}
+	status, publishedAt, err := resolvePublishState(input.Status, input.PublishedAt)
+	if err != nil {
+		return Moment{}, err
 	}
 
-	row := s.db.QueryRowContext(
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Moment{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	row := tx.QueryRowContext(
 		ctx,
-		`INSERT INTO moments (translation_key, content, media, locale, visibility, location, status, card_span, published_at, updated_at)
-		 VALUES (COALESCE($1::uuid, gen_random_uuid()), $2, $3::jsonb, $4, $5, $6::jsonb, $7, $8, $9, NOW())
-		 RETURNING id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at`,
+		`INSERT INTO moments (translation_key, content, media, locale, visibility, location, status, card_span, published_at, revision, updated_by, updated_at)
+		 VALUES (COALESCE($1::uuid, gen_random_uuid()), $2, $3::jsonb, $4, $5, $6::jsonb, $7, $8, $9, 1, $10, NOW())
+		 RETURNING id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at, COALESCE(revision, 1)`,
 		input.TranslationKey,
 		input.Content,
 		string(mediaRaw),
 		input.Locale,
 		input.Visibility,
 		string(locationRaw),
-		input.Status,
+		status,
 		input.CardSpan,
 		publishedAt,
+		input.UpdatedBy,
 	)
-	return scanMoment(row)
+	item, err := scanMoment(row)
+	if err != nil {
+		return Moment{}, err
+	}
+	if err := s.recordContentChange(ctx, tx, "moment", item.ID, item, change.withMetadata("status", item.Status)); err != nil {
+		return Moment{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Moment{}, err
+	}
+	return item, nil
 }
 
 type UpdateMomentInput struct {
@@ -1336,13 +1741,20 @@ type UpdateMomentInput struct {
 	CardSpanSet    bool
 	PublishedAt    *time.Time
 	PublishedAtSet bool
+	UpdatedBy      *string
+	// ExpectedVersion, when set, makes the update fail with
+	// ErrVersionConflict unless the moment is still at that version.
+	ExpectedVersion *ContentVersion
 }
 
-func (s *Store) UpdateMoment(ctx context.Context, id string, input UpdateMomentInput) (Moment, error) {
+func (s *Store) UpdateMoment(ctx context.Context, id string, input UpdateMomentInput, change ContentChange) (Moment, error) {
 	existing, err := s.GetMomentByID(ctx, id)
 	if err != nil {
 		return Moment{}, err
 	}
+	if input.ExpectedVersion != nil && !input.ExpectedVersion.Matches(existing.Version()) {
+		return Moment{}, ErrVersionConflict
+	}
 	if input.Content != nil {
 		existing.Content = *input.Content
 	}
@@ -1381,40 +1793,47 @@ func (s *Store) UpdateMoment(ctx context.Context, id string, input UpdateMomentI
 		return Moment{}, err
 	}
 
-	var publishedAt any
-	if existing.Status == "published" {
-		if existing.PublishedAt != nil {
-			publishedAt = existing.PublishedAt.UTC()
-		} else {
-			publishedAt = time.Now().UTC()
-		}
+	status, publishedAt, err := resolvePublishState(existing.Status, existing.PublishedAt)
+	if err != nil {
+		return Moment{}, err
 	}
 
-	row := s.db.QueryRowContext(
-		ctx,
-		`UPDATE moments
-		 SET content = $2,
-		     media = $3::jsonb,
-		     locale = $4,
-		     visibility = $5,
-		     location = $6::jsonb,
-		     status = $7,
-		     card_span = $8,
-		     published_at = $9,
-		     updated_at = NOW()
-		 WHERE id = $1 AND deleted_at IS NULL
-		 RETURNING id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at`,
-		id,
-		existing.Content,
-		string(mediaRaw),
-		existing.Locale,
-		existing.Visibility,
-		string(locationRaw),
-		existing.Status,
-		existing.CardSpan,
-		publishedAt,
-	)
-	item, err := scanMoment(row)
+	var item Moment
+	err = s.updateWithRevision(ctx, "moment", id, input.ExpectedVersion, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(
+			ctx,
+			`UPDATE moments
+			 SET content = $2,
+			     media = $3::jsonb,
+			     locale = $4,
+			     visibility = $5,
+			     location = $6::jsonb,
+			     status = $7,
+			     card_span = $8,
+			     published_at = $9,
+			     revision = COALESCE(revision, 1) + 1,
+			     updated_by = $10,
+			     updated_at = NOW()
+			 WHERE id = $1 AND deleted_at IS NULL
+			 RETURNING id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at, COALESCE(revision, 1)`,
+			id,
+			existing.Content,
+			string(mediaRaw),
+			existing.Locale,
+			existing.Visibility,
+			string(locationRaw),
+			status,
+			existing.CardSpan,
+			publishedAt,
+			input.UpdatedBy,
+		)
+		var scanErr error
+		item, scanErr = scanMoment(row)
+		if scanErr != nil {
+			return scanErr
+		}
+		return s.recordContentChange(ctx, tx, "moment", item.ID, item, change)
+	})
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Moment{}, ErrNotFound
@@ -1424,25 +1843,36 @@ func (s *Store) UpdateMoment(ctx context.Context, id string, input UpdateMomentI
 	return item, nil
 }
 
-func (s *Store) SetMomentStatus(ctx context.Context, id, status string) (Moment, error) {
+func (s *Store) SetMomentStatus(ctx context.Context, id, status string, updatedBy *string, change ContentChange) (Moment, error) {
 	var publishedAt any
 	if status == "published" {
 		publishedAt = time.Now().UTC()
 	}
-	row := s.db.QueryRowContext(
-		ctx,
-		`UPDATE moments
-		 SET status = $2,
-		     published_at = $3,
-		     updated_at = NOW()
-		 WHERE id = $1 AND deleted_at IS NULL
-		 RETURNING id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at`,
-		id,
-		status,
-		publishedAt,
-	)
-	item, err := scanMoment(row)
-	if err != nil {
+	var item Moment
+	err := s.updateWithRevision(ctx, "moment", id, nil, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(
+			ctx,
+			`UPDATE moments
+			 SET status = $2,
+			     published_at = $3,
+			     revision = COALESCE(revision, 1) + 1,
+			     updated_by = $4,
+			     updated_at = NOW()
+			 WHERE id = $1 AND deleted_at IS NULL
+			 RETURNING id::text, translation_key::text, content, media, locale, visibility, location, status, card_span, published_at, created_at, updated_at, COALESCE(revision, 1)`,
+			id,
+			status,
+			publishedAt,
+			updatedBy,
+		)
+		var scanErr error
+		item, scanErr = scanMoment(row)
+		if scanErr != nil {
+			return scanErr
+		}
+		return s.recordContentChange(ctx, tx, "moment", item.ID, item, change)
+	})
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Moment{}, ErrNotFound
 		}
@@ -1451,16 +1881,8 @@ func (s *Store) SetMomentStatus(ctx context.Context, id, status string) (Moment,
 	return item, nil
 }
 
-func (s *Store) SoftDeleteMoment(ctx context.Context, id string) error {
-	result, err := s.db.ExecContext(ctx, `UPDATE moments SET deleted_at = NOW(), updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id)
-	if err != nil {
-		return err
-	}
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return ErrNotFound
-	}
-	return nil
+func (s *Store) SoftDeleteMoment(ctx context.Context, id string, change ContentChange) error {
+	return s.softDeleteContent(ctx, "moment", "moments", id, change)
 }
 
 func scanGallery(scanner interface{ Scan(dest ...any) error }) (GalleryItem, error) {
@@ -1500,6 +1922,7 @@ func scanGallery(scanner interface{ Scan(dest ...any) error }) (GalleryItem, err
 		&publishedAt,
 		&item.CreatedAt,
 		&item.UpdatedAt,
+		&item.Revision,
 	); err != nil {
 		return GalleryItem{}, err
 	}
@@ -1523,7 +1946,7 @@ func (s *Store) ListPublicGallery(ctx context.Context, locale string, limit, off
 		ctx,
 		`SELECT id::text, translation_key::text, locale, file_url, thumb_url, title, width, height, captured_at, camera, lens,
 		        focal_length, aperture, iso, latitude, longitude, COALESCE(is_live_photo, false), video_url,
-		        status, published_at, created_at, updated_at
+		        status, published_at, created_at, updated_at, COALESCE(revision, 1)
 		 FROM gallery
 		 WHERE status = 'published' AND deleted_at IS NULL AND locale = $1
 		 ORDER BY COALESCE(published_at, created_at) DESC
@@ -1553,7 +1976,7 @@ func (s *Store) GetPublicGalleryByID(ctx context.Context, locale, id string) (Ga
 		ctx,
 		`SELECT id::text, translation_key::text, locale, file_url, thumb_url, title, width, height, captured_at, camera, lens,
 		        focal_length, aperture, iso, latitude, longitude, COALESCE(is_live_photo, false), video_url,
-		        status, published_at, created_at, updated_at
+		        status, published_at, created_at, updated_at, COALESCE(revision, 1)
 		 FROM gallery
 		 WHERE id = $1 AND locale = $2 AND status = 'published' AND deleted_at IS NULL
 		 LIMIT 1`,
@@ -1575,7 +1998,7 @@ func (s *Store) GetGalleryByID(ctx context.Context, id string) (GalleryItem, err
 		ctx,
 		`SELECT id::text, translation_key::text, locale, file_url, thumb_url, title, width, height, captured_at, camera, lens,
 		        focal_length, aperture, iso, latitude, longitude, COALESCE(is_live_photo, false), video_url,
-		        status, published_at, created_at, updated_at
+		        status, published_at, created_at, updated_at, COALESCE(revision, 1)
 		 FROM gallery
 		 WHERE id = $1 AND deleted_at IS NULL
 		 LIMIT 1`,
@@ -1610,29 +2033,32 @@ type CreateGalleryInput struct {
 	VideoURL    *string
 	Status      string
 	PublishedAt *time.Time
+	UpdatedBy   *string
 }
 
-func (s *Store) CreateGallery(ctx context.Context, input CreateGalleryInput) (GalleryItem, error) {
-	var publishedAt any
-	if input.Status == "published" {
-		if input.PublishedAt != nil {
-			publishedAt = input.PublishedAt.UTC()
-		} else {
-			publishedAt = time.Now().UTC()
-		}
+func (s *Store) CreateGallery(ctx context.Context, input CreateGalleryInput, change ContentChange) (GalleryItem, error) {
+	status, publishedAt, err := resolvePublishState(input.Status, input.PublishedAt)
+	if err != nil {
+		return GalleryItem{}, err
 	}
 
-	row := s.db.QueryRowContext(
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return GalleryItem{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	row := tx.QueryRowContext(
 		ctx,
 		`INSERT INTO gallery (locale, file_url, thumb_url, title, width, height, captured_at, camera, lens,
 		                     focal_length, aperture, iso, latitude, longitude, is_live_photo, video_url,
-		                     status, published_at, updated_at)
+		                     status, published_at, revision, updated_by, updated_at)
 		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9,
 		         $10, $11, $12, $13, $14, $15, $16,
-		         $17, $18, NOW())
+		         $17, $18, 1, $19, NOW())
 		 RETURNING id::text, translation_key::text, locale, file_url, thumb_url, title, width, height, captured_at, camera, lens,
 		           focal_length, aperture, iso, latitude, longitude, COALESCE(is_live_photo, false), video_url,
-		           status, published_at, created_at, updated_at`,
+		           status, published_at, created_at, updated_at, COALESCE(revision, 1)`,
 		input.Locale,
 		input.FileURL,
 		input.ThumbURL,
@@ -1649,37 +2075,57 @@ func (s *Store) CreateGallery(ctx context.Context, input CreateGalleryInput) (Ga
 		input.Longitude,
 		input.IsLivePhoto,
 		input.VideoURL,
-		input.Status,
+		status,
 		publishedAt,
+		input.UpdatedBy,
 	)
-	return scanGallery(row)
+	item, err := scanGallery(row)
+	if err != nil {
+		return GalleryItem{}, err
+	}
+	if err := s.recordContentChange(ctx, tx, "gallery", item.ID, item, change.withMetadata("status", item.Status)); err != nil {
+		return GalleryItem{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return GalleryItem{}, err
+	}
+	return item, nil
 }
 
 type UpdateGalleryInput struct {
-	Locale      *string
-	FileURL     *string
-	ThumbURL    *string
-	Title       *string
-	Width       *int
-	Height      *int
-	CapturedAt  *time.Time
-	Camera      *string
-	Lens        *string
-	FocalLength *string
-	Aperture    *string
-	ISO         *int
-	Latitude    *float64
-	Longitude   *float64
-	IsLivePhoto *bool
-	VideoURL    *string
-	Status      *string
+	Locale         *string
+	FileURL        *string
+	ThumbURL       *string
+	Title          *string
+	Width          *int
+	Height         *int
+	CapturedAt     *time.Time
+	Camera         *string
+	Lens           *string
+	FocalLength    *string
+	Aperture       *string
+	ISO            *int
+	Latitude       *float64
+	Longitude      *float64
+	IsLivePhoto    *bool
+	VideoURL       *string
+	Status         *string
+	PublishedAt    *time.Time
+	PublishedAtSet bool
+	UpdatedBy      *string
+	// ExpectedVersion, when set, makes the update fail with
+	// ErrVersionConflict unless the item is still at that version.
+	ExpectedVersion *ContentVersion
 }
 
-func (s *Store) UpdateGallery(ctx context.Context, id string, input UpdateGalleryInput) (GalleryItem, error) {
+func (s *Store) UpdateGallery(ctx context.Context, id string, input UpdateGalleryInput, change ContentChange) (GalleryItem, error) {
 	existing, err := s.GetGalleryByID(ctx, id)
 	if err != nil {
 		return GalleryItem{}, err
 	}
+	if input.ExpectedVersion != nil && !input.ExpectedVersion.Matches(existing.Version()) {
+		return GalleryItem{}, ErrVersionConflict
+	}
 	if input.Locale != nil {
 		existing.Locale = *input.Locale
 	}
@@ -1731,63 +2177,73 @@ func (s *Store) UpdateGallery(ctx context.Context, id string, input UpdateGaller
 	if input.Status != nil {
 		existing.Status = *input.Status
 	}
+	if input.PublishedAtSet {
+		existing.PublishedAt = input.PublishedAt
+	}
 
-	var publishedAt any
-	if existing.Status == "published" {
-		if existing.PublishedAt != nil {
-			publishedAt = *existing.PublishedAt
-		} else {
-			publishedAt = time.Now().UTC()
-		}
+	status, publishedAt, err := resolvePublishState(existing.Status, existing.PublishedAt)
+	if err != nil {
+		return GalleryItem{}, err
 	}
 
-	row := s.db.QueryRowContext(
-		ctx,
-		`UPDATE gallery
-		 SET locale = $2,
-		     file_url = $3,
-		     thumb_url = $4,
-		     title = $5,
-		     width = $6,
-		     height = $7,
-		     captured_at = $8,
-		     camera = $9,
-		     lens = $10,
-		     focal_length = $11,
-		     aperture = $12,
-		     iso = $13,
-		     latitude = $14,
-		     longitude = $15,
-		     is_live_photo = $16,
-		     video_url = $17,
-		     status = $18,
-		     published_at = $19,
-		     updated_at = NOW()
-		 WHERE id = $1 AND deleted_at IS NULL
-		 RETURNING id::text, translation_key::text, locale, file_url, thumb_url, title, width, height, captured_at, camera, lens,
-		           focal_length, aperture, iso, latitude, longitude, COALESCE(is_live_photo, false), video_url,
-		           status, published_at, created_at, updated_at`,
-		id,
-		existing.Locale,
-		existing.FileURL,
-		existing.ThumbURL,
-		existing.Title,
-		existing.Width,
-		existing.Height,
-		existing.CapturedAt,
-		existing.Camera,
-		existing.Lens,
-		existing.FocalLength,
-		existing.Aperture,
-		existing.ISO,
-		existing.Latitude,
-		existing.Longitude,
-		existing.IsLivePhoto,
-		existing.VideoURL,
-		existing.Status,
-		publishedAt,
-	)
-	item, err := scanGallery(row)
+	var item GalleryItem
+	err = s.updateWithRevision(ctx, "gallery", id, input.ExpectedVersion, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(
+			ctx,
+			`UPDATE gallery
+			 SET locale = $2,
+			     file_url = $3,
+			     thumb_url = $4,
+			     title = $5,
+			     width = $6,
+			     height = $7,
+			     captured_at = $8,
+			     camera = $9,
+			     lens = $10,
+			     focal_length = $11,
+			     aperture = $12,
+			     iso = $13,
+			     latitude = $14,
+			     longitude = $15,
+			     is_live_photo = $16,
+			     video_url = $17,
+			     status = $18,
+			     published_at = $19,
+			     revision = COALESCE(revision, 1) + 1,
+			     updated_by = $20,
+			     updated_at = NOW()
+			 WHERE id = $1 AND deleted_at IS NULL
+			 RETURNING id::text, translation_key::text, locale, file_url, thumb_url, title, width, height, captured_at, camera, lens,
+			           focal_length, aperture, iso, latitude, longitude, COALESCE(is_live_photo, false), video_url,
+			           status, published_at, created_at, updated_at, COALESCE(revision, 1)`,
+			id,
+			existing.Locale,
+			existing.FileURL,
+			existing.ThumbURL,
+			existing.Title,
+			existing.Width,
+			existing.Height,
+			existing.CapturedAt,
+			existing.Camera,
+			existing.Lens,
+			existing.FocalLength,
+			existing.Aperture,
+			existing.ISO,
+			existing.Latitude,
+			existing.Longitude,
+			existing.IsLivePhoto,
+			existing.VideoURL,
+			status,
+			publishedAt,
+			input.UpdatedBy,
+		)
+		var scanErr error
+		item, scanErr = scanGallery(row)
+		if scanErr != nil {
+			return scanErr
+		}
+		return s.recordContentChange(ctx, tx, "gallery", item.ID, item, change)
+	})
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return GalleryItem{}, ErrNotFound
@@ -1797,26 +2253,37 @@ func (s *Store) UpdateGallery(ctx context.Context, id string, input UpdateGaller
 	return item, nil
 }
 
-func (s *Store) SetGalleryStatus(ctx context.Context, id, status string) (GalleryItem, error) {
+func (s *Store) SetGalleryStatus(ctx context.Context, id, status string, updatedBy *string, change ContentChange) (GalleryItem, error) {
 	var publishedAt any
 	if status == "published" {
 		publishedAt = time.Now().UTC()
 	}
-	row := s.db.QueryRowContext(
-		ctx,
-		`UPDATE gallery
-		 SET status = $2,
-		     published_at = $3,
-		     updated_at = NOW()
-		 WHERE id = $1 AND deleted_at IS NULL
-		 RETURNING id::text, translation_key::text, locale, file_url, thumb_url, title, width, height, captured_at, camera, lens,
-		           focal_length, aperture, iso, latitude, longitude, COALESCE(is_live_photo, false), video_url,
-		           status, published_at, created_at, updated_at`,
-		id,
-		status,
-		publishedAt,
-	)
-	item, err := scanGallery(row)
+	var item GalleryItem
+	err := s.updateWithRevision(ctx, "gallery", id, nil, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(
+			ctx,
+			`UPDATE gallery
+			 SET status = $2,
+			     published_at = $3,
+			     revision = COALESCE(revision, 1) + 1,
+			     updated_by = $4,
+			     updated_at = NOW()
+			 WHERE id = $1 AND deleted_at IS NULL
+			 RETURNING id::text, translation_key::text, locale, file_url, thumb_url, title, width, height, captured_at, camera, lens,
+			           focal_length, aperture, iso, latitude, longitude, COALESCE(is_live_photo, false), video_url,
+			           status, published_at, created_at, updated_at, COALESCE(revision, 1)`,
+			id,
+			status,
+			publishedAt,
+			updatedBy,
+		)
+		var scanErr error
+		item, scanErr = scanGallery(row)
+		if scanErr != nil {
+			return scanErr
+		}
+		return s.recordContentChange(ctx, tx, "gallery", item.ID, item, change)
+	})
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return GalleryItem{}, ErrNotFound
@@ -1826,16 +2293,8 @@ func (s *Store) SetGalleryStatus(ctx context.Context, id, status string) (Galler
 	return item, nil
 }
 
-func (s *Store) SoftDeleteGallery(ctx context.Context, id string) error {
-	result, err := s.db.ExecContext(ctx, `UPDATE gallery SET deleted_at = NOW(), updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id)
-	if err != nil {
-		return err
-	}
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return ErrNotFound
-	}
-	return nil
+func (s *Store) SoftDeleteGallery(ctx context.Context, id string, change ContentChange) error {
+	return s.softDeleteContent(ctx, "gallery", "gallery", id, change)
 }
 
 func (s *Store) ListPublicFeed(ctx context.Context, locale string, limit int) ([]FeedItem, error) {
@@ -1884,12 +2343,33 @@ type CreateMediaAssetInput struct {
 	Status    string
 }
 
+func scanMediaAsset(scanner interface{ Scan(dest ...any) error }) (MediaAsset, error) {
+	var asset MediaAsset
+	var thumbURL sql.NullString
+	if err := scanner.Scan(
+		&asset.ID,
+		&asset.ObjectKey,
+		&asset.URL,
+		&asset.Mime,
+		&asset.Size,
+		&asset.SHA256,
+		&asset.Status,
+		&thumbURL,
+		&asset.CreatedAt,
+		&asset.UpdatedAt,
+	); err != nil {
+		return MediaAsset{}, err
+	}
+	asset.ThumbURL = nullableString(thumbURL)
+	return asset, nil
+}
+
 func (s *Store) CreateMediaAsset(ctx context.Context, input CreateMediaAssetInput) (MediaAsset, error) {
 	row := s.db.QueryRowContext(
 		ctx,
 		`INSERT INTO media_assets (object_key, url, mime, size, sha256, status)
 		 VALUES ($1, $2, $3, $4, $5, $6)
-		 RETURNING id::text, object_key, url, mime, size, sha256, status, created_at, updated_at`,
+		 RETURNING id::text, object_key, url, mime, size, sha256, status, thumb_url, created_at, updated_at`,
 		input.ObjectKey,
 		input.URL,
 		input.Mime,
@@ -1897,18 +2377,8 @@ func (s *Store) CreateMediaAsset(ctx context.Context, input CreateMediaAssetInpu
 		input.SHA256,
 		input.Status,
 	)
-	var asset MediaAsset
-	if err := row.Scan(
-		&asset.ID,
-		&asset.ObjectKey,
-		&asset.URL,
-		&asset.Mime,
-		&asset.Size,
-		&asset.SHA256,
-		&asset.Status,
-		&asset.CreatedAt,
-		&asset.UpdatedAt,
-	); err != nil {
+	asset, err := scanMediaAsset(row)
+	if err != nil {
 		return MediaAsset{}, err
 	}
 	return asset, nil
@@ -1929,25 +2399,15 @@ func (s *Store) CompleteMediaAsset(ctx context.Context, id string, size int64, s
 		     exif_json = $5::jsonb,
 		     updated_at = NOW()
 		 WHERE id = $1
-		 RETURNING id::text, object_key, url, mime, size, sha256, status, created_at, updated_at`,
+		 RETURNING id::text, object_key, url, mime, size, sha256, status, thumb_url, created_at, updated_at`,
 		id,
 		size,
 		sha256,
 		status,
 		string(exifRaw),
 	)
-	var asset MediaAsset
-	if err := row.Scan(
-		&asset.ID,
-		&asset.ObjectKey,
-		&asset.URL,
-		&asset.Mime,
-		&asset.Size,
-		&asset.SHA256,
-		&asset.Status,
-		&asset.CreatedAt,
-		&asset.UpdatedAt,
-	); err != nil {
+	asset, err := scanMediaAsset(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return MediaAsset{}, ErrNotFound
 		}
@@ -1959,24 +2419,14 @@ func (s *Store) CompleteMediaAsset(ctx context.Context, id string, size int64, s
 func (s *Store) GetMediaAssetByID(ctx context.Context, id string) (MediaAsset, error) {
 	row := s.db.QueryRowContext(
 		ctx,
-		`SELECT id::text, object_key, url, mime, size, sha256, status, created_at, updated_at
+		`SELECT id::text, object_key, url, mime, size, sha256, status, thumb_url, created_at, updated_at
 		 FROM media_assets
 		 WHERE id = $1
 		 LIMIT 1`,
 		id,
 	)
-	var asset MediaAsset
-	if err := row.Scan(
-		&asset.ID,
-		&asset.ObjectKey,
-		&asset.URL,
-		&asset.Mime,
-		&asset.Size,
-		&asset.SHA256,
-		&asset.Status,
-		&asset.CreatedAt,
-		&asset.UpdatedAt,
-	); err != nil {
+	asset, err := scanMediaAsset(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return MediaAsset{}, ErrNotFound
 		}
@@ -1985,6 +2435,27 @@ func (s *Store) GetMediaAssetByID(ctx context.Context, id string) (MediaAsset, e
 	return asset, nil
 }
 
+func (s *Store) SetMediaAssetThumbnail(ctx context.Context, id, objectKey, url string) error {
+	result, err := s.db.ExecContext(
+		ctx,
+		`UPDATE media_assets
+		 SET thumb_object_key = $2,
+		     thumb_url = $3,
+		     updated_at = NOW()
+		 WHERE id = $1`,
+		id,
+		objectKey,
+		url,
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 func (s *Store) UpsertPreviewSession(ctx context.Context, sessionID string, payload []byte, expiresAt time.Time) (PreviewSession, error) {
 	if sessionID != "" {
 		row := s.db.QueryRowContext(
@@ -2065,26 +2536,59 @@ type CreateAIJobInput struct {
 	Prompt    string
 }
 
+// AI jobs keep the request in ai_jobs and share their id with the jobs row
+// that carries queue state.
+const (
+	aiJobColumns = `a.id::text, a.kind, a.content_id, a.provider, a.model, a.prompt, q.status,
+	CASE WHEN q.status = 'succeeded' THEN NULL ELSE q.last_error END,
+	q.attempts, q.next_run_at, q.last_error, q.locked_by, q.lease_expires_at,
+	a.created_at, q.updated_at, q.completed_at`
+	aiJobFrom = `ai_jobs a JOIN jobs q ON q.id = a.id`
+)
+
 func (s *Store) CreateAIJob(ctx context.Context, input CreateAIJobInput) (AIJob, error) {
-	row := s.db.QueryRowContext(
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return AIJob{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var id string
+	if err := tx.QueryRowContext(
 		ctx,
-		`INSERT INTO ai_jobs (kind, content_id, provider, model, prompt, status)
-		 VALUES ($1, $2, $3, $4, $5, 'queued')
-		 RETURNING id::text, kind, content_id, provider, model, prompt, status, error_message, created_at, updated_at, completed_at`,
+		`INSERT INTO ai_jobs (kind, content_id, provider, model, prompt)
+		 VALUES ($1, $2, $3, $4, $5)
+		 RETURNING id::text`,
 		input.Kind,
 		input.ContentID,
 		input.Provider,
 		input.Model,
 		input.Prompt,
-	)
-	return scanAIJob(row, nil)
+	).Scan(&id); err != nil {
+		return AIJob{}, err
+	}
+	if _, err := enqueueJob(ctx, tx, id, EnqueueJobInput{Type: JobTypeAI}); err != nil {
+		return AIJob{}, err
+	}
+	item, err := scanAIJob(tx.QueryRowContext(ctx, `SELECT `+aiJobColumns+` FROM `+aiJobFrom+` WHERE a.id = $1`, id), nil)
+	if err != nil {
+		return AIJob{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return AIJob{}, err
+	}
+	_ = s.NotifyJobs(ctx, NotifyTopicJob, item.ID)
+	return item, nil
 }
 
-func scanAIJob(scanner interface{ Scan(dest ...any) error }, resultRaw []byte) (AIJob, error) {
+func scanAIJob(scanner interface{ Scan(dest ...any) error }, resultRaw *sql.NullString) (AIJob, error) {
 	var item AIJob
 	var errMsg sql.NullString
+	var lastError sql.NullString
+	var lockedBy sql.NullString
+	var leaseExpiresAt sql.NullTime
 	var completedAt sql.NullTime
-	if err := scanner.Scan(
+	dest := []any{
 		&item.ID,
 		&item.Kind,
 		&item.ContentID,
@@ -2093,17 +2597,29 @@ func scanAIJob(scanner interface{ Scan(dest ...any) error }, resultRaw []byte) (
 		&item.Prompt,
 		&item.Status,
 		&errMsg,
+		&item.Attempts,
+		&item.NextRunAt,
+		&lastError,
+		&lockedBy,
+		&leaseExpiresAt,
 		&item.CreatedAt,
 		&item.UpdatedAt,
 		&completedAt,
-	); err != nil {
+	}
+	if resultRaw != nil {
+		dest = append(dest, resultRaw)
+	}
+	if err := scanner.Scan(dest...); err != nil {
 		return AIJob{}, err
 	}
 	item.ErrorMessage = nullableString(errMsg)
+	item.LastError = nullableString(lastError)
+	item.LockedBy = nullableString(lockedBy)
+	item.LeaseExpiresAt = nullableTime(leaseExpiresAt)
 	item.CompletedAt = nullableTime(completedAt)
-	if len(resultRaw) > 0 && string(resultRaw) != "null" {
+	if resultRaw != nil && resultRaw.Valid && resultRaw.String != "" && resultRaw.String != "null" {
 		var result map[string]any
-		if err := json.Unmarshal(resultRaw, &result); err != nil {
+		if err := json.Unmarshal([]byte(resultRaw.String), &result); err != nil {
 			return AIJob{}, err
 		}
 		item.Result = &result
@@ -2114,140 +2630,64 @@ func scanAIJob(scanner interface{ Scan(dest ...any) error }, resultRaw []byte) (
 func (s *Store) GetAIJobByID(ctx context.Context, id string) (AIJob, error) {
 	row := s.db.QueryRowContext(
 		ctx,
-		`SELECT j.id::text, j.kind, j.content_id, j.provider, j.model, j.prompt, j.status,
-		        j.error_message, j.created_at, j.updated_at, j.completed_at,
-		        (SELECT result FROM ai_job_results r WHERE r.job_id = j.id ORDER BY r.created_at DESC LIMIT 1)::text
-		 FROM ai_jobs j
-		 WHERE j.id = $1
+		`SELECT `+aiJobColumns+`,
+		        (SELECT result FROM ai_job_results r WHERE r.job_id = a.id ORDER BY r.created_at DESC LIMIT 1)::text
+		 FROM `+aiJobFrom+`
+		 WHERE a.id = $1
 		 LIMIT 1`,
 		id,
 	)
 	var resultRaw sql.NullString
-	var item AIJob
-	var errMsg sql.NullString
-	var completedAt sql.NullTime
-	if err := row.Scan(
-		&item.ID,
-		&item.Kind,
-		&item.ContentID,
-		&item.Provider,
-		&item.Model,
-		&item.Prompt,
-		&item.Status,
-		&errMsg,
-		&item.CreatedAt,
-		&item.UpdatedAt,
-		&completedAt,
-		&resultRaw,
-	); err != nil {
+	item, err := scanAIJob(row, &resultRaw)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return AIJob{}, ErrNotFound
 		}
 		return AIJob{}, err
 	}
-	item.ErrorMessage = nullableString(errMsg)
-	item.CompletedAt = nullableTime(completedAt)
-	if resultRaw.Valid && resultRaw.String != "" && resultRaw.String != "null" {
-		var result map[string]any
-		if err := json.Unmarshal([]byte(resultRaw.String), &result); err != nil {
-			return AIJob{}, err
-		}
-		item.Result = &result
-	}
 	return item, nil
 }
 
-func (s *Store) ClaimNextQueuedAIJob(ctx context.Context) (AIJob, error) {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return AIJob{}, err
+func (s *Store) ListAIJobs(ctx context.Context, status string, limit, offset int) ([]AIJob, error) {
+	args := make([]any, 0, 3)
+	addArg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
 	}
-	defer func() {
-		_ = tx.Rollback()
-	}()
 
-	row := tx.QueryRowContext(
-		ctx,
-		`WITH picked AS (
-			SELECT id
-			FROM ai_jobs
-			WHERE status = 'queued'
-			ORDER BY created_at ASC
-			LIMIT 1
-			FOR UPDATE SKIP LOCKED
-		)
-		UPDATE ai_jobs AS j
-		SET status = 'running',
-		    updated_at = NOW()
-		FROM picked
-		WHERE j.id = picked.id
-		RETURNING j.id::text, j.kind, j.content_id, j.provider, j.model, j.prompt,
-		          j.status, j.error_message, j.created_at, j.updated_at, j.completed_at`,
-	)
-	job, err := scanAIJob(row, nil)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return AIJob{}, ErrNotFound
-		}
-		return AIJob{}, err
+	where := []string{"TRUE"}
+	if strings.TrimSpace(status) != "" {
+		where = append(where, "q.status = "+addArg(status))
 	}
 
-	if err := tx.Commit(); err != nil {
-		return AIJob{}, err
-	}
-	return job, nil
-}
+	query := fmt.Sprintf(
+		`SELECT %s
+		 FROM %s
+		 WHERE %s
+		 ORDER BY a.created_at DESC
+		 LIMIT %s OFFSET %s`,
+		aiJobColumns,
+		aiJobFrom,
+		strings.Join(where, " AND "),
+		addArg(limit),
+		addArg(offset),
+	)
 
-func (s *Store) CompleteAIJob(ctx context.Context, id string, result map[string]any) error {
-	resultRaw, err := json.Marshal(result)
-	if err != nil {
-		return err
-	}
-	tx, err := s.db.BeginTx(ctx, nil)
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return err
-	}
-	defer func() { _ = tx.Rollback() }()
-
-	if _, err := tx.ExecContext(
-		ctx,
-		`INSERT INTO ai_job_results (job_id, provider, model, result)
-		 VALUES ($1, (SELECT provider FROM ai_jobs WHERE id = $1), (SELECT model FROM ai_jobs WHERE id = $1), $2::jsonb)`,
-		id,
-		string(resultRaw),
-	); err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	if _, err := tx.ExecContext(
-		ctx,
-		`UPDATE ai_jobs
-		 SET status = 'succeeded',
-		     completed_at = NOW(),
-		     updated_at = NOW(),
-		     error_message = NULL
-		 WHERE id = $1`,
-		id,
-	); err != nil {
-		return err
+	items := make([]AIJob, 0)
+	for rows.Next() {
+		item, err := scanAIJob(rows, nil)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
 	}
-
-	return tx.Commit()
-}
-
-func (s *Store) FailAIJob(ctx context.Context, id string, reason string) error {
-	_, err := s.db.ExecContext(
-		ctx,
-		`UPDATE ai_jobs
-		 SET status = 'failed',
-		     error_message = $2,
-		     completed_at = NOW(),
-		     updated_at = NOW()
-		 WHERE id = $1`,
-		id,
-		reason,
-	)
-	return err
+	return items, rows.Err()
 }
 
 func (s *Store) GetContentBody(ctx context.Context, kind, contentID string) (string, error) {
@@ -2302,7 +2742,10 @@ func (s *Store) GetContentBody(ctx context.Context, kind, contentID string) (str
 	}
 }
 
-func (s *Store) ApplyAIResultToContent(ctx context.Context, job AIJob) error {
+// ApplyAIResultToContent writes a succeeded job's rewrite onto its content
+// item and records change with it. A result without a rewrite changes nothing
+// and records nothing.
+func (s *Store) ApplyAIResultToContent(ctx context.Context, job AIJob, updatedBy *string, change ContentChange) error {
 	if job.Result == nil {
 		return nil
 	}
@@ -2311,46 +2754,44 @@ func (s *Store) ApplyAIResultToContent(ctx context.Context, job AIJob) error {
 		return nil
 	}
 
+	var query string
 	switch job.Kind {
 	case "post":
-		_, err := s.db.ExecContext(
-			ctx,
-			`UPDATE posts
+		query = `UPDATE posts
 			 SET excerpt = COALESCE(excerpt, $2),
 			     updated_at = NOW(),
-			     revision = COALESCE(revision, 1) + 1
-			 WHERE id = $1 AND deleted_at IS NULL`,
-			job.ContentID,
-			rewrite,
-		)
-		return err
+			     revision = COALESCE(revision, 1) + 1,
+			     updated_by = $3
+			 WHERE id = $1 AND deleted_at IS NULL`
 	case "moment":
-		_, err := s.db.ExecContext(
-			ctx,
-			`UPDATE moments
+		query = `UPDATE moments
 			 SET content = $2,
-			     updated_at = NOW()
-			 WHERE id = $1 AND deleted_at IS NULL`,
-			job.ContentID,
-			rewrite,
-		)
-		return err
+			     updated_at = NOW(),
+			     revision = COALESCE(revision, 1) + 1,
+			     updated_by = $3
+			 WHERE id = $1 AND deleted_at IS NULL`
 	case "gallery":
-		_, err := s.db.ExecContext(
-			ctx,
-			`UPDATE gallery
+		query = `UPDATE gallery
 			 SET title = COALESCE(title, $2),
-			     updated_at = NOW()
-			 WHERE id = $1 AND deleted_at IS NULL`,
-			job.ContentID,
-			rewrite,
-		)
-		return err
+			     updated_at = NOW(),
+			     revision = COALESCE(revision, 1) + 1,
+			     updated_by = $3
+			 WHERE id = $1 AND deleted_at IS NULL`
 	default:
 		return fmt.Errorf("unsupported content kind: %s", job.Kind)
 	}
+
+	return s.updateWithRevision(ctx, job.Kind, job.ContentID, nil, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, query, job.ContentID, rewrite, updatedBy); err != nil {
+			return err
+		}
+		return s.recordContentChange(ctx, tx, job.Kind, job.ContentID, nil, change)
+	})
 }
 
+const presenceColumns = `city, region, country, country_code, timezone, source, last_heartbeat_at, updated_at, created_at,
+	visibility, granularity, hidden_fields`
+
 func scanPresence(scanner interface{ Scan(dest ...any) error }) (PresenceStatus, error) {
 	var item PresenceStatus
 	var region sql.NullString
@@ -2358,6 +2799,7 @@ func scanPresence(scanner interface{ Scan(dest ...any) error }) (PresenceStatus,
 	var countryCode sql.NullString
 	var timezone sql.NullString
 	var source sql.NullString
+	var hiddenFieldsRaw []byte
 
 	if err := scanner.Scan(
 		&item.City,
@@ -2369,9 +2811,17 @@ func scanPresence(scanner interface{ Scan(dest ...any) error }) (PresenceStatus,
 		&item.LastHeartbeatAt,
 		&item.UpdatedAt,
 		&item.CreatedAt,
+		&item.Privacy.Visibility,
+		&item.Privacy.Granularity,
+		&hiddenFieldsRaw,
 	); err != nil {
 		return PresenceStatus{}, err
 	}
+	hiddenFields, err := parseJSONArray(hiddenFieldsRaw)
+	if err != nil {
+		return PresenceStatus{}, err
+	}
+	item.Privacy.HiddenFields = hiddenFields
 
 	item.Region = nullableString(region)
 	item.Country = nullableString(country)
@@ -2384,7 +2834,7 @@ func scanPresence(scanner interface{ Scan(dest ...any) error }) (PresenceStatus,
 func (s *Store) GetPresence(ctx context.Context) (PresenceStatus, error) {
 	row := s.db.QueryRowContext(
 		ctx,
-		`SELECT city, region, country, country_code, timezone, source, last_heartbeat_at, updated_at, created_at
+		`SELECT `+presenceColumns+`
 		 FROM presence_status
 		 WHERE id = 1
 		 LIMIT 1`,
@@ -2400,13 +2850,40 @@ func (s *Store) GetPresence(ctx context.Context) (PresenceStatus, error) {
 	return item, nil
 }
 
+// UpsertPresence overwrites the presence row and appends the heartbeat to
+// presence_history in one transaction. Privacy settings left nil in input
+// keep their stored values, and the history row honors the settings in
+// effect after the write.
 func (s *Store) UpsertPresence(ctx context.Context, input UpsertPresenceInput) (PresenceStatus, error) {
-	row := s.db.QueryRowContext(
+	var hiddenFieldsRaw any
+	if input.HiddenFields != nil {
+		hiddenFields := *input.HiddenFields
+		if hiddenFields == nil {
+			hiddenFields = []string{}
+		}
+		raw, err := json.Marshal(hiddenFields)
+		if err != nil {
+			return PresenceStatus{}, err
+		}
+		hiddenFieldsRaw = string(raw)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return PresenceStatus{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	row := tx.QueryRowContext(
 		ctx,
 		`INSERT INTO presence_status (
-			 id, city, region, country, country_code, timezone, source, last_heartbeat_at, updated_at
+			 id, city, region, country, country_code, timezone, source, last_heartbeat_at, updated_at,
+			 visibility, granularity, hidden_fields
+		 )
+		 VALUES (
+			 1, $1, $2, $3, $4, $5, $6, $7, NOW(),
+			 COALESCE($8, 'visible'), COALESCE($9, 'city'), COALESCE($10::jsonb, '[]'::jsonb)
 		 )
-		 VALUES (1, $1, $2, $3, $4, $5, $6, $7, NOW())
 		 ON CONFLICT (id) DO UPDATE SET
 		   city = EXCLUDED.city,
 		   region = EXCLUDED.region,
@@ -2415,8 +2892,11 @@ func (s *Store) UpsertPresence(ctx context.Context, input UpsertPresenceInput) (
 		   timezone = EXCLUDED.timezone,
 		   source = EXCLUDED.source,
 		   last_heartbeat_at = EXCLUDED.last_heartbeat_at,
-		   updated_at = NOW()
-		 RETURNING city, region, country, country_code, timezone, source, last_heartbeat_at, updated_at, created_at`,
+		   updated_at = NOW(),
+		   visibility = COALESCE($8, presence_status.visibility),
+		   granularity = COALESCE($9, presence_status.granularity),
+		   hidden_fields = COALESCE($10::jsonb, presence_status.hidden_fields)
+		 RETURNING `+presenceColumns,
 		input.City,
 		input.Region,
 		input.Country,
@@ -2424,12 +2904,21 @@ func (s *Store) UpsertPresence(ctx context.Context, input UpsertPresenceInput) (
 		input.Timezone,
 		input.Source,
 		input.HeartbeatAt,
+		input.Visibility,
+		input.Granularity,
+		hiddenFieldsRaw,
 	)
 
 	item, err := scanPresence(row)
 	if err != nil {
 		return PresenceStatus{}, err
 	}
+	if err := insertPresenceHistory(ctx, tx, item); err != nil {
+		return PresenceStatus{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return PresenceStatus{}, err
+	}
 	return item, nil
 }
 
@@ -2605,13 +3094,69 @@ func (s *Store) GetSearchSnapshot(ctx context.Context, locale string) (SearchSna
 	return item, nil
 }
 
+// UpsertSearchSnapshot stores one locale's snapshot, as synced through the
+// API, and records its generatedAt as processed_at. It does not advance the
+// processed generation: the sync cannot tell which content it covers, so a
+// pending refresh is still rebuilt by tdp-worker.
 func (s *Store) UpsertSearchSnapshot(ctx context.Context, input UpsertSearchSnapshotInput) (SearchSnapshot, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return SearchSnapshot{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	item, err := upsertSearchSnapshot(ctx, tx, input)
+	if err != nil {
+		return SearchSnapshot{}, err
+	}
+	if err := markSearchSnapshotRefreshProcessed(ctx, tx, input.GeneratedAt); err != nil {
+		return SearchSnapshot{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return SearchSnapshot{}, err
+	}
+	return item, nil
+}
+
+// ReplaceSearchSnapshots stores a full rebuild, one snapshot per locale, and
+// marks refreshes up to generation processed. generation must be the
+// requested generation read before the build started. All of it commits in
+// one transaction, so a failed locale leaves the refresh pending for the retry.
+func (s *Store) ReplaceSearchSnapshots(ctx context.Context, inputs []UpsertSearchSnapshotInput, generation int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, input := range inputs {
+		if _, err := upsertSearchSnapshot(ctx, tx, input); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(
+		ctx,
+		`UPDATE search_snapshot_refresh_state
+		 SET processed_generation = GREATEST(processed_generation, $1),
+		     processed_at = NOW(),
+		     updated_at = NOW()
+		 WHERE id = 1`,
+		generation,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// upsertSearchSnapshot writes one locale's snapshot and records a
+// search_snapshot.refreshed event for it.
+func upsertSearchSnapshot(ctx context.Context, tx *sql.Tx, input UpsertSearchSnapshotInput) (SearchSnapshot, error) {
 	snapshotRaw, err := toJSONRaw(input.Snapshot)
 	if err != nil {
 		return SearchSnapshot{}, err
 	}
 
-	row := s.db.QueryRowContext(
+	row := tx.QueryRowContext(
 		ctx,
 		`INSERT INTO search_snapshots (
 			 locale, snapshot_json, generated_at, updated_at
@@ -2631,7 +3176,10 @@ func (s *Store) UpsertSearchSnapshot(ctx context.Context, input UpsertSearchSnap
 	if err != nil {
 		return SearchSnapshot{}, err
 	}
-	if err := s.MarkSearchSnapshotRefreshProcessed(ctx, input.GeneratedAt); err != nil {
+	if err := insertOutboxEvent(ctx, tx, "search_snapshot.refreshed", "search_snapshot", item.Locale, "", map[string]any{
+		"locale":      item.Locale,
+		"generatedAt": item.GeneratedAt,
+	}, false); err != nil {
 		return SearchSnapshot{}, err
 	}
 	return item, nil
@@ -2652,6 +3200,8 @@ func scanSearchSnapshotRefreshState(scanner interface{ Scan(dest ...any) error }
 	if err := scanner.Scan(
 		&requestedAt,
 		&processedAt,
+		&item.RequestedGeneration,
+		&item.ProcessedGeneration,
 		&item.UpdatedAt,
 		&item.CreatedAt,
 	); err != nil {
@@ -2666,7 +3216,7 @@ func scanSearchSnapshotRefreshState(scanner interface{ Scan(dest ...any) error }
 func (s *Store) GetSearchSnapshotRefreshState(ctx context.Context) (SearchSnapshotRefreshState, error) {
 	row := s.db.QueryRowContext(
 		ctx,
-		`SELECT requested_at, processed_at, updated_at, created_at
+		`SELECT requested_at, processed_at, requested_generation, processed_generation, updated_at, created_at
 		 FROM search_snapshot_refresh_state
 		 WHERE id = 1
 		 LIMIT 1`,
@@ -2682,33 +3232,50 @@ func (s *Store) GetSearchSnapshotRefreshState(ctx context.Context) (SearchSnapsh
 	return item, nil
 }
 
-func (s *Store) RequestSearchSnapshotRefresh(ctx context.Context) (SearchSnapshotRefreshState, error) {
-	row := s.db.QueryRowContext(
+// requestSearchSnapshotRefresh marks the snapshot stale by bumping the
+// requested generation and queues a rebuild in tx. It runs in the outbox
+// dispatch transaction, which commits only after the content writes it covers,
+// so a rebuild that reads the new generation also sees their content.
+func requestSearchSnapshotRefresh(ctx context.Context, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(
 		ctx,
 		`INSERT INTO search_snapshot_refresh_state (
-			 id, requested_at, updated_at
+			 id, requested_at, requested_generation, updated_at
 		 )
-		 VALUES (1, NOW(), NOW())
+		 VALUES (1, NOW(), 1, NOW())
 		 ON CONFLICT (id) DO UPDATE SET
 		   requested_at = NOW(),
-		   updated_at = NOW()
-		 RETURNING requested_at, processed_at, updated_at, created_at`,
-	)
-
-	item, err := scanSearchSnapshotRefreshState(row)
-	if err != nil {
-		return SearchSnapshotRefreshState{}, err
+		   requested_generation = search_snapshot_refresh_state.requested_generation + 1,
+		   updated_at = NOW()`,
+	); err != nil {
+		return err
 	}
-	return item, nil
+	_, err := enqueueJob(ctx, tx, "", searchSnapshotJobInput)
+	return err
+}
+
+var searchSnapshotJobInput = EnqueueJobInput{
+	Type:      JobTypeSearchSnapshot,
+	DedupeKey: "singleton",
+}
+
+// EnqueueSearchSnapshotJob queues a snapshot rebuild. Requests coalesce into
+// the one queued rebuild, which reads content when it runs.
+func (s *Store) EnqueueSearchSnapshotJob(ctx context.Context) (Job, error) {
+	return s.EnqueueJob(ctx, searchSnapshotJobInput)
 }
 
 func (s *Store) MarkSearchSnapshotRefreshProcessed(ctx context.Context, processedAt *time.Time) error {
+	return markSearchSnapshotRefreshProcessed(ctx, s.db, processedAt)
+}
+
+func markSearchSnapshotRefreshProcessed(ctx context.Context, q execer, processedAt *time.Time) error {
 	var value any
 	if processedAt != nil {
 		value = *processedAt
 	}
 
-	_, err := s.db.ExecContext(
+	_, err := q.ExecContext(
 		ctx,
 		`INSERT INTO search_snapshot_refresh_state (
 			 id, requested_at, processed_at, updated_at
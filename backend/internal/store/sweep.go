@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// sweepBatchSize bounds each DELETE so a large backlog is cleared in short
+// transactions instead of one long lock.
+const sweepBatchSize = 5000
+
+type SweepResult struct {
+	Nonces          int64 `json:"nonces"`
+	PreviewSessions int64 `json:"previewSessions"`
+	IdempotencyKeys int64 `json:"idempotencyKeys"`
+	RateWindows     int64 `json:"rateWindows"`
+	OutboxEvents    int64 `json:"outboxEvents"`
+	PresenceHistory int64 `json:"presenceHistory"`
+}
+
+func (r SweepResult) Total() int64 {
+	return r.Nonces + r.PreviewSessions + r.IdempotencyKeys + r.RateWindows + r.OutboxEvents + r.PresenceHistory
+}
+
+// SweepExpired deletes expired request nonces and preview sessions,
+// idempotency keys last touched before idempotencyRetention, API key rate
+// windows that have closed, outbox events dispatched before outboxRetention
+// and presence history older than presenceHistoryRetention. tdp-worker runs
+// it periodically.
+func (s *Store) SweepExpired(ctx context.Context, idempotencyRetention, outboxRetention, presenceHistoryRetention time.Duration) (SweepResult, error) {
+	var result SweepResult
+	var err error
+	if result.Nonces, err = s.sweepTable(ctx, "request_nonces", "expires_at < NOW()"); err != nil {
+		return result, err
+	}
+	if result.PreviewSessions, err = s.sweepTable(ctx, "preview_sessions", "expires_at < NOW()"); err != nil {
+		return result, err
+	}
+	if result.IdempotencyKeys, err = s.sweepTable(
+		ctx,
+		"idempotency_keys",
+		"updated_at < NOW() - make_interval(secs => $1::double precision)",
+		idempotencyRetention.Seconds(),
+	); err != nil {
+		return result, err
+	}
+	if result.RateWindows, err = s.sweepTable(ctx, "api_key_rate_windows", "window_start < NOW() - INTERVAL '1 minute'"); err != nil {
+		return result, err
+	}
+	if result.OutboxEvents, err = s.sweepTable(
+		ctx,
+		"outbox_events",
+		"dispatched_at < NOW() - make_interval(secs => $1::double precision)",
+		outboxRetention.Seconds(),
+	); err != nil {
+		return result, err
+	}
+	if result.PresenceHistory, err = s.sweepTable(
+		ctx,
+		"presence_history",
+		"heartbeat_at < NOW() - make_interval(secs => $1::double precision)",
+		presenceHistoryRetention.Seconds(),
+	); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+func (s *Store) sweepTable(ctx context.Context, table, condition string, args ...any) (int64, error) {
+	var total int64
+	for {
+		result, err := s.db.ExecContext(
+			ctx,
+			fmt.Sprintf(
+				`DELETE FROM %[1]s
+				 WHERE ctid IN (SELECT ctid FROM %[1]s WHERE %[2]s LIMIT %[3]d)`,
+				table,
+				condition,
+				sweepBatchSize,
+			),
+			args...,
+		)
+		if err != nil {
+			return total, fmt.Errorf("sweep %s: %w", table, err)
+		}
+		deleted, _ := result.RowsAffected()
+		total += deleted
+		if deleted < sweepBatchSize {
+			return total, nil
+		}
+	}
+}
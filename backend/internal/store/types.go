@@ -2,6 +2,29 @@ package store
 
 import "time"
 
+// Request signing algorithms. HMAC keys share a secret with the server;
+// Ed25519 keys register only the client's public key.
+const (
+	KeyAlgorithmHMAC    = "hmac-sha256"
+	KeyAlgorithmEd25519 = "ed25519"
+)
+
+// APIKeyCredential is what a key's requests are verified against: Secret for
+// HMAC keys, PublicKey (base64) for Ed25519 keys.
+type APIKeyCredential struct {
+	Algorithm string
+	Secret    string
+	PublicKey string
+}
+
+// APIKeyLimits are optional restrictions on a key, enforced by the
+// authenticator. Zero values mean no restriction.
+type APIKeyLimits struct {
+	ExpiresAt          *time.Time
+	AllowedCIDRs       []string
+	RateLimitPerMinute int
+}
+
 type APIKeyRecord struct {
 	ID         string
 	KeyID      string
@@ -11,6 +34,23 @@ type APIKeyRecord struct {
 	RevokedAt  *time.Time
 	CreatedAt  time.Time
 	LastUsedAt *time.Time
+	APIKeyLimits
+	Algorithm string
+	PublicKey string
+	// PreviousSecret / PreviousPublicKey are the credential replaced by the
+	// last rotation, still accepted until PreviousSecretExpiresAt.
+	PreviousSecret          string
+	PreviousPublicKey       string
+	PreviousSecretExpiresAt *time.Time
+}
+
+type CreateAPIKeyInput struct {
+	Name       string
+	KeyID      string
+	Credential APIKeyCredential
+	KeyHash    string
+	Scopes     []string
+	Limits     APIKeyLimits
 }
 
 type Post struct {
@@ -66,6 +106,7 @@ type Moment struct {
 	PublishedAt    *time.Time        `json:"publishedAt,omitempty"`
 	CreatedAt      time.Time         `json:"createdAt"`
 	UpdatedAt      time.Time         `json:"updatedAt"`
+	Revision       int               `json:"revision"`
 }
 
 type GalleryItem struct {
@@ -91,6 +132,109 @@ type GalleryItem struct {
 	PublishedAt    *time.Time `json:"publishedAt,omitempty"`
 	CreatedAt      time.Time  `json:"createdAt"`
 	UpdatedAt      time.Time  `json:"updatedAt"`
+	Revision       int        `json:"revision"`
+}
+
+// ContentVersion identifies one saved version of a post, moment or gallery
+// item, as exposed to clients through the ETag header.
+type ContentVersion struct {
+	Revision  int
+	UpdatedAt time.Time
+}
+
+// Matches compares at microsecond precision, the resolution Postgres stores.
+func (v ContentVersion) Matches(other ContentVersion) bool {
+	return v.Revision == other.Revision && v.UpdatedAt.UnixMicro() == other.UpdatedAt.UnixMicro()
+}
+
+func (p Post) Version() ContentVersion {
+	return ContentVersion{Revision: p.Revision, UpdatedAt: p.UpdatedAt}
+}
+
+func (m Moment) Version() ContentVersion {
+	return ContentVersion{Revision: m.Revision, UpdatedAt: m.UpdatedAt}
+}
+
+func (g GalleryItem) Version() ContentVersion {
+	return ContentVersion{Revision: g.Revision, UpdatedAt: g.UpdatedAt}
+}
+
+// ContentRevision describes an archived version of a post, moment or gallery
+// item: who wrote it, when, and when a later change replaced it.
+type ContentRevision struct {
+	Revision   int       `json:"revision"`
+	UpdatedBy  *string   `json:"updatedBy,omitempty"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	ReplacedAt time.Time `json:"replacedAt"`
+}
+
+// AuditLog is one entry written by InsertAuditLog. Seq and EntryHash place it
+// in the audit hash chain; entries written before the chain have neither.
+type AuditLog struct {
+	ID           string         `json:"id"`
+	Seq          *int64         `json:"seq,omitempty"`
+	ActorKeyID   *string        `json:"actorKeyId,omitempty"`
+	Action       string         `json:"action"`
+	ResourceType *string        `json:"resourceType,omitempty"`
+	ResourceID   *string        `json:"resourceId,omitempty"`
+	Metadata     map[string]any `json:"metadata"`
+	EntryHash    *string        `json:"entryHash,omitempty"`
+	CreatedAt    time.Time      `json:"createdAt"`
+}
+
+// WebhookSubscription is an endpoint that receives the events it lists.
+// Secret is only filled in for delivery.
+type WebhookSubscription struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Description *string   `json:"description,omitempty"`
+	Active      bool      `json:"active"`
+	CreatedBy   *string   `json:"createdBy,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	Secret      string    `json:"-"`
+}
+
+// WebhookDelivery is one event queued for one subscription. Status moves from
+// pending to succeeded, or to failed once its job is dead-lettered.
+type WebhookDelivery struct {
+	ID             string         `json:"id"`
+	SubscriptionID string         `json:"subscriptionId"`
+	EventID        string         `json:"eventId"`
+	EventType      string         `json:"eventType"`
+	Payload        map[string]any `json:"payload"`
+	Status         string         `json:"status"`
+	Attempts       int            `json:"attempts"`
+	ResponseStatus *int           `json:"responseStatus,omitempty"`
+	LastError      *string        `json:"lastError,omitempty"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	UpdatedAt      time.Time      `json:"updatedAt"`
+	DeliveredAt    *time.Time     `json:"deliveredAt,omitempty"`
+}
+
+type WebhookDeliveryAttempt struct {
+	Attempt        int       `json:"attempt"`
+	ResponseStatus *int      `json:"responseStatus,omitempty"`
+	Error          *string   `json:"error,omitempty"`
+	DurationMs     int       `json:"durationMs"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// OutboxEvent is a change recorded by the transaction that made it: a content
+// event, a job status change or a search snapshot rebuild. ID orders the
+// event stream; EventID is the eventId webhook deliveries carry.
+type OutboxEvent struct {
+	ID           int64          `json:"id"`
+	TxID         int64          `json:"-"`
+	EventID      string         `json:"eventId"`
+	Type         string         `json:"type"`
+	ResourceType string         `json:"resourceType"`
+	ResourceID   string         `json:"resourceId"`
+	ActorKeyID   *string        `json:"actorKeyId,omitempty"`
+	Payload      map[string]any `json:"payload"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	DispatchedAt *time.Time     `json:"-"`
 }
 
 type FeedItem struct {
@@ -109,6 +253,7 @@ type MediaAsset struct {
 	Size      int64     `json:"size"`
 	SHA256    string    `json:"sha256"`
 	Status    string    `json:"status"`
+	ThumbURL  *string   `json:"thumbUrl,omitempty"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
@@ -122,40 +267,92 @@ type PreviewSession struct {
 }
 
 type AIJob struct {
-	ID           string          `json:"id"`
-	Kind         string          `json:"kind"`
-	ContentID    string          `json:"contentId"`
-	Provider     string          `json:"provider"`
-	Model        string          `json:"model"`
-	Prompt       string          `json:"prompt"`
-	Status       string          `json:"status"`
-	ErrorMessage *string         `json:"errorMessage,omitempty"`
-	CreatedAt    time.Time       `json:"createdAt"`
-	UpdatedAt    time.Time       `json:"updatedAt"`
-	CompletedAt  *time.Time      `json:"completedAt,omitempty"`
-	Result       *map[string]any `json:"result,omitempty"`
+	ID             string          `json:"id"`
+	Kind           string          `json:"kind"`
+	ContentID      string          `json:"contentId"`
+	Provider       string          `json:"provider"`
+	Model          string          `json:"model"`
+	Prompt         string          `json:"prompt"`
+	Status         string          `json:"status"`
+	ErrorMessage   *string         `json:"errorMessage,omitempty"`
+	Attempts       int             `json:"attempts"`
+	NextRunAt      time.Time       `json:"nextRunAt"`
+	LastError      *string         `json:"lastError,omitempty"`
+	LockedBy       *string         `json:"lockedBy,omitempty"`
+	LeaseExpiresAt *time.Time      `json:"leaseExpiresAt,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	UpdatedAt      time.Time       `json:"updatedAt"`
+	CompletedAt    *time.Time      `json:"completedAt,omitempty"`
+	Result         *map[string]any `json:"result,omitempty"`
+}
+
+type Job struct {
+	ID             string          `json:"id"`
+	Type           string          `json:"type"`
+	Payload        map[string]any  `json:"payload"`
+	DedupeKey      *string         `json:"dedupeKey,omitempty"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextRunAt      time.Time       `json:"nextRunAt"`
+	LastError      *string         `json:"lastError,omitempty"`
+	Result         *map[string]any `json:"result,omitempty"`
+	LockedBy       *string         `json:"lockedBy,omitempty"`
+	LeaseExpiresAt *time.Time      `json:"leaseExpiresAt,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	UpdatedAt      time.Time       `json:"updatedAt"`
+	CompletedAt    *time.Time      `json:"completedAt,omitempty"`
+}
+
+type ScheduledPublication struct {
+	Kind        string    `json:"kind"`
+	ID          string    `json:"id"`
+	PublishedAt time.Time `json:"publishedAt"`
 }
 
 type PresenceStatus struct {
-	City            string    `json:"city"`
-	Region          *string   `json:"region,omitempty"`
-	Country         *string   `json:"country,omitempty"`
-	CountryCode     *string   `json:"countryCode,omitempty"`
-	Timezone        *string   `json:"timezone,omitempty"`
-	Source          *string   `json:"source,omitempty"`
-	LastHeartbeatAt time.Time `json:"lastHeartbeatAt"`
-	UpdatedAt       time.Time `json:"updatedAt"`
-	CreatedAt       time.Time `json:"createdAt"`
+	City            string          `json:"city"`
+	Region          *string         `json:"region,omitempty"`
+	Country         *string         `json:"country,omitempty"`
+	CountryCode     *string         `json:"countryCode,omitempty"`
+	Timezone        *string         `json:"timezone,omitempty"`
+	Source          *string         `json:"source,omitempty"`
+	LastHeartbeatAt time.Time       `json:"lastHeartbeatAt"`
+	UpdatedAt       time.Time       `json:"updatedAt"`
+	CreatedAt       time.Time       `json:"createdAt"`
+	Privacy         PresencePrivacy `json:"privacy"`
+}
+
+// PresencePrivacy controls what the public presence endpoints reveal.
+type PresencePrivacy struct {
+	// Visibility is visible or hidden (do not disturb).
+	Visibility string `json:"visibility"`
+	// Granularity is city, country or online (status only).
+	Granularity string `json:"granularity"`
+	// HiddenFields lists fields from PresenceHideableFields to leave out.
+	HiddenFields []string `json:"hiddenFields"`
 }
 
 type UpsertPresenceInput struct {
-	City        string
-	Region      *string
-	Country     *string
-	CountryCode *string
-	Timezone    *string
-	Source      *string
-	HeartbeatAt time.Time
+	City         string
+	Region       *string
+	Country      *string
+	CountryCode  *string
+	Timezone     *string
+	Source       *string
+	HeartbeatAt  time.Time
+	Visibility   *string
+	Granularity  *string
+	HiddenFields *[]string
+}
+
+// PresenceVisit is a stay in one city on the presence timeline.
+type PresenceVisit struct {
+	City        *string   `json:"city,omitempty"`
+	Region      *string   `json:"region,omitempty"`
+	Country     *string   `json:"country,omitempty"`
+	CountryCode *string   `json:"countryCode,omitempty"`
+	ArrivedAt   time.Time `json:"arrivedAt"`
+	LastSeenAt  time.Time `json:"lastSeenAt"`
 }
 
 type ProfileSnapshot struct {
@@ -176,6 +373,10 @@ type UpsertProfileSnapshotInput struct {
 	SyncedAt     *time.Time
 }
 
+// SearchSnapshotSchemaVersion is the snapshot JSON layout shared with the
+// frontend search reader (src/lib/search/searchSnapshot.ts).
+const SearchSnapshotSchemaVersion = 1
+
 type SearchSnapshot struct {
 	Locale      string         `json:"locale"`
 	Snapshot    map[string]any `json:"snapshot,omitempty"`
@@ -191,8 +392,16 @@ type UpsertSearchSnapshotInput struct {
 }
 
 type SearchSnapshotRefreshState struct {
-	RequestedAt *time.Time `json:"requestedAt,omitempty"`
-	ProcessedAt *time.Time `json:"processedAt,omitempty"`
-	UpdatedAt   time.Time  `json:"updatedAt"`
-	CreatedAt   time.Time  `json:"createdAt"`
+	RequestedAt         *time.Time `json:"requestedAt,omitempty"`
+	ProcessedAt         *time.Time `json:"processedAt,omitempty"`
+	RequestedGeneration int64      `json:"requestedGeneration"`
+	ProcessedGeneration int64      `json:"processedGeneration"`
+	UpdatedAt           time.Time  `json:"updatedAt"`
+	CreatedAt           time.Time  `json:"createdAt"`
+}
+
+// Pending reports whether a refresh was requested after the last rebuild
+// started reading content.
+func (s SearchSnapshotRefreshState) Pending() bool {
+	return s.RequestedGeneration > s.ProcessedGeneration
 }
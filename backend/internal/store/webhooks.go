@@ -0,0 +1,483 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const JobTypeWebhookDelivery = "webhook_delivery"
+
+// Webhook delivery statuses.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookEventTypes lists every event a subscription can ask for. Besides
+// these a subscription may list "*" or a "<kind>.*" wildcard.
+var WebhookEventTypes = func() []string {
+	actions := []string{"created", "updated", "published", "unpublished", "deleted", "restored"}
+	types := make([]string, 0, len(scheduledContentTables)*len(actions))
+	for _, entry := range scheduledContentTables {
+		for _, action := range actions {
+			types = append(types, entry.kind+"."+action)
+		}
+	}
+	return types
+}()
+
+// ValidateWebhookEvent reports whether event is a known event type, "*", or a
+// wildcard over a known kind.
+func ValidateWebhookEvent(event string) error {
+	if event == "*" || matchesKnownEvent(WebhookEventTypes, event) {
+		return nil
+	}
+	return fmt.Errorf("unknown webhook event: %s", event)
+}
+
+// matchesKnownEvent reports whether pattern is one of known or a "<prefix>.*"
+// wildcard covering at least one of them.
+func matchesKnownEvent(known []string, pattern string) bool {
+	prefix, wildcard := strings.CutSuffix(pattern, ".*")
+	for _, eventType := range known {
+		if eventType == pattern || (wildcard && strings.HasPrefix(eventType, prefix+".")) {
+			return true
+		}
+	}
+	return false
+}
+
+const webhookSubscriptionColumns = `id::text, url, events, description, active, created_by, created_at, updated_at`
+
+const webhookDeliveryColumns = `id::text, subscription_id::text, event_id::text, event_type, payload::text, status, attempts,
+	response_status, last_error, created_at, updated_at, delivered_at`
+
+type CreateWebhookSubscriptionInput struct {
+	URL         string
+	Events      []string
+	Description *string
+	Secret      string
+	CreatedBy   string
+}
+
+type UpdateWebhookSubscriptionInput struct {
+	URL         *string
+	Events      *[]string
+	Description *string
+	Active      *bool
+}
+
+// webhookSecretOwner is bound to a sealed webhook secret so it only opens for
+// its own subscription.
+func webhookSecretOwner(id string) string {
+	return "webhook:" + id
+}
+
+func scanWebhookSubscription(scanner interface{ Scan(dest ...any) error }) (WebhookSubscription, error) {
+	var item WebhookSubscription
+	var eventsRaw []byte
+	var description sql.NullString
+	var createdBy sql.NullString
+	if err := scanner.Scan(
+		&item.ID,
+		&item.URL,
+		&eventsRaw,
+		&description,
+		&item.Active,
+		&createdBy,
+		&item.CreatedAt,
+		&item.UpdatedAt,
+	); err != nil {
+		return WebhookSubscription{}, err
+	}
+	events, err := parseJSONArray(eventsRaw)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	item.Events = events
+	item.Description = nullableString(description)
+	item.CreatedBy = nullableString(createdBy)
+	return item, nil
+}
+
+func scanWebhookDelivery(scanner interface{ Scan(dest ...any) error }) (WebhookDelivery, error) {
+	var item WebhookDelivery
+	var payloadRaw string
+	var responseStatus sql.NullInt32
+	var lastError sql.NullString
+	var deliveredAt sql.NullTime
+	if err := scanner.Scan(
+		&item.ID,
+		&item.SubscriptionID,
+		&item.EventID,
+		&item.EventType,
+		&payloadRaw,
+		&item.Status,
+		&item.Attempts,
+		&responseStatus,
+		&lastError,
+		&item.CreatedAt,
+		&item.UpdatedAt,
+		&deliveredAt,
+	); err != nil {
+		return WebhookDelivery{}, err
+	}
+	if responseStatus.Valid {
+		status := int(responseStatus.Int32)
+		item.ResponseStatus = &status
+	}
+	item.LastError = nullableString(lastError)
+	item.DeliveredAt = nullableTime(deliveredAt)
+
+	item.Payload = map[string]any{}
+	if payloadRaw != "" && payloadRaw != "null" {
+		if err := json.Unmarshal([]byte(payloadRaw), &item.Payload); err != nil {
+			return WebhookDelivery{}, err
+		}
+	}
+	return item, nil
+}
+
+func (s *Store) CreateWebhookSubscription(ctx context.Context, input CreateWebhookSubscriptionInput) (WebhookSubscription, error) {
+	id := uuid.NewString()
+	eventsRaw, err := json.Marshal(input.Events)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	storedSecret, secretVersion, err := s.sealSecret(webhookSecretOwner(id), input.Secret)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	row := s.db.QueryRowContext(
+		ctx,
+		`INSERT INTO webhook_subscriptions (id, url, events, description, secret_ciphertext, secret_key_version, created_by)
+		 VALUES ($1, $2, $3::jsonb, $4, $5, $6, $7)
+		 RETURNING `+webhookSubscriptionColumns,
+		id,
+		input.URL,
+		string(eventsRaw),
+		input.Description,
+		storedSecret,
+		secretVersion,
+		input.CreatedBy,
+	)
+	return scanWebhookSubscription(row)
+}
+
+func (s *Store) ListWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT `+webhookSubscriptionColumns+`
+		 FROM webhook_subscriptions
+		 WHERE deleted_at IS NULL
+		 ORDER BY created_at DESC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]WebhookSubscription, 0)
+	for rows.Next() {
+		item, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *Store) GetWebhookSubscription(ctx context.Context, id string) (WebhookSubscription, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT `+webhookSubscriptionColumns+`
+		 FROM webhook_subscriptions
+		 WHERE id = $1 AND deleted_at IS NULL
+		 LIMIT 1`,
+		id,
+	)
+	item, err := scanWebhookSubscription(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return WebhookSubscription{}, ErrNotFound
+		}
+		return WebhookSubscription{}, err
+	}
+	return item, nil
+}
+
+func (s *Store) UpdateWebhookSubscription(ctx context.Context, id string, input UpdateWebhookSubscriptionInput) (WebhookSubscription, error) {
+	var eventsRaw any
+	if input.Events != nil {
+		raw, err := json.Marshal(*input.Events)
+		if err != nil {
+			return WebhookSubscription{}, err
+		}
+		eventsRaw = string(raw)
+	}
+	row := s.db.QueryRowContext(
+		ctx,
+		`UPDATE webhook_subscriptions
+		 SET url = COALESCE($2, url),
+		     events = COALESCE($3::jsonb, events),
+		     description = COALESCE($4, description),
+		     active = COALESCE($5, active),
+		     updated_at = NOW()
+		 WHERE id = $1 AND deleted_at IS NULL
+		 RETURNING `+webhookSubscriptionColumns,
+		id,
+		input.URL,
+		eventsRaw,
+		input.Description,
+		input.Active,
+	)
+	item, err := scanWebhookSubscription(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return WebhookSubscription{}, ErrNotFound
+		}
+		return WebhookSubscription{}, err
+	}
+	return item, nil
+}
+
+// DeleteWebhookSubscription stops deliveries to a subscription. Its delivery
+// log is kept; deliveries already queued fail when their job runs.
+func (s *Store) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(
+		ctx,
+		`UPDATE webhook_subscriptions
+		 SET deleted_at = NOW(), active = FALSE, updated_at = NOW()
+		 WHERE id = $1 AND deleted_at IS NULL`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// enqueueWebhookEvent records a delivery of the event for every active
+// subscription that asked for it and queues a webhook_delivery job for each.
+// It returns how many deliveries were queued.
+func enqueueWebhookEvent(ctx context.Context, tx *sql.Tx, eventID, eventType string, payload map[string]any) (int, error) {
+	payloadRaw, err := toJSONRaw(payload)
+	if err != nil {
+		return 0, err
+	}
+	kind, _, _ := strings.Cut(eventType, ".")
+	rows, err := tx.QueryContext(
+		ctx,
+		`INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+		 SELECT id, $1::uuid, $2, $3::jsonb
+		 FROM webhook_subscriptions
+		 WHERE deleted_at IS NULL AND active
+		   AND (events ? $2 OR events ? '*' OR events ? $4)
+		 RETURNING id::text`,
+		eventID,
+		eventType,
+		string(payloadRaw),
+		kind+".*",
+	)
+	if err != nil {
+		return 0, err
+	}
+	deliveryIDs := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		deliveryIDs = append(deliveryIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, err
+	}
+	rows.Close()
+
+	for _, id := range deliveryIDs {
+		if _, err := enqueueJob(ctx, tx, "", EnqueueJobInput{
+			Type:    JobTypeWebhookDelivery,
+			Payload: map[string]any{"deliveryId": id},
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return len(deliveryIDs), nil
+}
+
+// GetWebhookSubscriptionSecret loads a subscription with its secret opened,
+// for tdp-worker to sign a delivery.
+func (s *Store) GetWebhookSubscriptionSecret(ctx context.Context, id string) (WebhookSubscription, error) {
+	var storedSecret string
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT `+webhookSubscriptionColumns+`, secret_ciphertext
+		 FROM webhook_subscriptions
+		 WHERE id = $1 AND deleted_at IS NULL
+		 LIMIT 1`,
+		id,
+	)
+	item, err := scanWebhookSubscription(secretScanner{scanner: row, secret: &storedSecret})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return WebhookSubscription{}, ErrNotFound
+		}
+		return WebhookSubscription{}, err
+	}
+	item.Secret, err = s.secrets.Open(storedSecret, []byte(webhookSecretOwner(item.ID)))
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	return item, nil
+}
+
+// secretScanner reads a trailing secret column after the regular columns.
+type secretScanner struct {
+	scanner interface{ Scan(dest ...any) error }
+	secret  *string
+}
+
+func (r secretScanner) Scan(dest ...any) error {
+	return r.scanner.Scan(append(dest, r.secret)...)
+}
+
+func (s *Store) GetWebhookDelivery(ctx context.Context, id string) (WebhookDelivery, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT `+webhookDeliveryColumns+`
+		 FROM webhook_deliveries
+		 WHERE id = $1
+		 LIMIT 1`,
+		id,
+	)
+	item, err := scanWebhookDelivery(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return WebhookDelivery{}, ErrNotFound
+		}
+		return WebhookDelivery{}, err
+	}
+	return item, nil
+}
+
+func (s *Store) ListWebhookDeliveries(ctx context.Context, subscriptionID string, limit, offset int) ([]WebhookDelivery, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT `+webhookDeliveryColumns+`
+		 FROM webhook_deliveries
+		 WHERE subscription_id = $1
+		 ORDER BY created_at DESC
+		 LIMIT $2 OFFSET $3`,
+		subscriptionID,
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]WebhookDelivery, 0)
+	for rows.Next() {
+		item, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *Store) ListWebhookDeliveryAttempts(ctx context.Context, deliveryID string) ([]WebhookDeliveryAttempt, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT attempt, response_status, error, duration_ms, created_at
+		 FROM webhook_delivery_attempts
+		 WHERE delivery_id = $1
+		 ORDER BY attempt ASC, created_at ASC`,
+		deliveryID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]WebhookDeliveryAttempt, 0)
+	for rows.Next() {
+		var item WebhookDeliveryAttempt
+		var responseStatus sql.NullInt32
+		var attemptError sql.NullString
+		if err := rows.Scan(&item.Attempt, &responseStatus, &attemptError, &item.DurationMs, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		if responseStatus.Valid {
+			status := int(responseStatus.Int32)
+			item.ResponseStatus = &status
+		}
+		item.Error = nullableString(attemptError)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// RecordWebhookAttempt logs one delivery attempt and moves the delivery to
+// status (pending while retries remain).
+func (s *Store) RecordWebhookAttempt(ctx context.Context, deliveryID, status string, attempt WebhookDeliveryAttempt) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO webhook_delivery_attempts (delivery_id, attempt, response_status, error, duration_ms)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		deliveryID,
+		attempt.Attempt,
+		attempt.ResponseStatus,
+		attempt.Error,
+		attempt.DurationMs,
+	); err != nil {
+		return err
+	}
+	var deliveredAt any
+	if status == WebhookDeliverySucceeded {
+		deliveredAt = time.Now().UTC()
+	}
+	if _, err := tx.ExecContext(
+		ctx,
+		`UPDATE webhook_deliveries
+		 SET status = $2,
+		     attempts = GREATEST(attempts, $3),
+		     response_status = $4,
+		     last_error = $5,
+		     delivered_at = COALESCE($6::timestamptz, delivered_at),
+		     updated_at = NOW()
+		 WHERE id = $1`,
+		deliveryID,
+		status,
+		attempt.Attempt,
+		attempt.ResponseStatus,
+		attempt.Error,
+		deliveredAt,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,57 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const anthropicAPIVersion = "2023-06-01"
+
+type AnthropicProvider struct {
+	APIKey  string
+	BaseURL string
+	Client  *http.Client
+}
+
+type anthropicMessagesResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+}
+
+func (p *AnthropicProvider) Name() string {
+	return "anthropic"
+}
+
+func (p *AnthropicProvider) Generate(ctx context.Context, req GenerateRequest) (GenerateResult, error) {
+	body := map[string]any{
+		"model":      req.Model,
+		"max_tokens": 2048,
+		"system":     aiSystemPrompt,
+		"messages": []map[string]string{
+			{"role": "user", "content": buildUserPrompt(req)},
+		},
+	}
+
+	var resp anthropicMessagesResponse
+	if err := postJSON(ctx, p.Client, strings.TrimRight(p.BaseURL, "/")+"/v1/messages", map[string]string{
+		"x-api-key":         p.APIKey,
+		"anthropic-version": anthropicAPIVersion,
+	}, body, &resp); err != nil {
+		return GenerateResult{}, err
+	}
+
+	var text strings.Builder
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return GenerateResult{}, fmt.Errorf("anthropic returned no text content")
+	}
+	return parseGenerateOutput(text.String())
+}
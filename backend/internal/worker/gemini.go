@@ -0,0 +1,61 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type GeminiProvider struct {
+	APIKey  string
+	BaseURL string
+	Client  *http.Client
+}
+
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiGenerateResponse struct {
+	Candidates []struct {
+		Content geminiContent `json:"content"`
+	} `json:"candidates"`
+}
+
+func (p *GeminiProvider) Name() string {
+	return "gemini"
+}
+
+func (p *GeminiProvider) Generate(ctx context.Context, req GenerateRequest) (GenerateResult, error) {
+	body := map[string]any{
+		"systemInstruction": geminiContent{Parts: []geminiPart{{Text: aiSystemPrompt}}},
+		"contents": []geminiContent{
+			{Role: "user", Parts: []geminiPart{{Text: buildUserPrompt(req)}}},
+		},
+		"generationConfig": map[string]any{"responseMimeType": "application/json"},
+	}
+
+	endpoint := fmt.Sprintf("%s/v1beta/models/%s:generateContent", strings.TrimRight(p.BaseURL, "/"), url.PathEscape(req.Model))
+	var resp geminiGenerateResponse
+	if err := postJSON(ctx, p.Client, endpoint, map[string]string{
+		"x-goog-api-key": p.APIKey,
+	}, body, &resp); err != nil {
+		return GenerateResult{}, err
+	}
+	if len(resp.Candidates) == 0 {
+		return GenerateResult{}, fmt.Errorf("gemini returned no candidates")
+	}
+
+	var text strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		text.WriteString(part.Text)
+	}
+	return parseGenerateOutput(text.String())
+}
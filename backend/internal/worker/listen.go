@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"tdp-lite/backend/internal/store"
+)
+
+func signalWake(wake chan<- struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// listen holds a dedicated LISTEN connection on store.JobNotifyChannel and
+// wakes idle claim loops when jobs are queued. It reconnects with backoff; the
+// poll ticker covers any notifications missed meanwhile.
+func (w *Worker) listen(ctx context.Context, wake chan<- struct{}) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		connected, err := w.listenOnce(ctx, wake)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = time.Second
+		}
+		log.Printf("job listener disconnected: %v (retrying in %s)", err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+func (w *Worker) listenOnce(ctx context.Context, wake chan<- struct{}) (bool, error) {
+	conn, err := pgx.Connect(ctx, w.cfg.DatabaseURL)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{store.JobNotifyChannel}.Sanitize()); err != nil {
+		return false, err
+	}
+	log.Printf("job listener subscribed to %s", store.JobNotifyChannel)
+
+	// Catch up on anything queued while the listener was down.
+	signalWake(wake)
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+		item, err := store.ParseJobNotification(notification.Payload)
+		if err != nil {
+			log.Printf("job listener ignored malformed payload %q: %v", notification.Payload, err)
+			continue
+		}
+		switch item.Topic {
+		case store.NotifyTopicJob:
+			signalWake(wake)
+		}
+	}
+}
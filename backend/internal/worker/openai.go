@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type OpenAIProvider struct {
+	APIKey  string
+	BaseURL string
+	Client  *http.Client
+}
+
+type openAIChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message openAIChatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+func (p *OpenAIProvider) Name() string {
+	return "openai"
+}
+
+func (p *OpenAIProvider) Generate(ctx context.Context, req GenerateRequest) (GenerateResult, error) {
+	body := map[string]any{
+		"model": req.Model,
+		"messages": []openAIChatMessage{
+			{Role: "system", Content: aiSystemPrompt},
+			{Role: "user", Content: buildUserPrompt(req)},
+		},
+		"response_format": map[string]string{"type": "json_object"},
+	}
+
+	var resp openAIChatResponse
+	if err := postJSON(ctx, p.Client, strings.TrimRight(p.BaseURL, "/")+"/chat/completions", map[string]string{
+		"authorization": "Bearer " + p.APIKey,
+	}, body, &resp); err != nil {
+		return GenerateResult{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return GenerateResult{}, fmt.Errorf("openai returned no choices")
+	}
+	return parseGenerateOutput(resp.Choices[0].Message.Content)
+}
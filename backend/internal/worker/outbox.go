@@ -0,0 +1,26 @@
+package worker
+
+import (
+	"context"
+
+	"tdp-lite/backend/internal/store"
+)
+
+const outboxDispatchBatchSize = 100
+
+// runOutboxDispatchJob relays pending outbox events in batches until none are
+// left. A failed batch rolls back whole and the job retries it.
+func (w *Worker) runOutboxDispatchJob(ctx context.Context, job store.Job) (map[string]any, error) {
+	var total store.OutboxDispatchResult
+	for {
+		result, err := w.store.DispatchOutbox(ctx, w.auditActor(), outboxDispatchBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		total.Events += result.Events
+		total.Deliveries += result.Deliveries
+		if result.Events < outboxDispatchBatchSize {
+			return map[string]any{"events": total.Events, "deliveries": total.Deliveries}, nil
+		}
+	}
+}
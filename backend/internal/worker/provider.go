@@ -0,0 +1,136 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"tdp-lite/backend/internal/config"
+)
+
+const aiSystemPrompt = `You are an editorial assistant for a personal blog.
+Follow the user's instruction for the content below.
+Respond with a single JSON object and nothing else, using exactly these keys:
+{"summary": "<two or three sentence summary>", "rewrite": "<improved version of the content>"}
+Keep the language of the original content.`
+
+type GenerateRequest struct {
+	Model   string
+	Prompt  string
+	Content string
+}
+
+type GenerateResult struct {
+	Summary string
+	Rewrite string
+}
+
+type Provider interface {
+	Name() string
+	Generate(ctx context.Context, req GenerateRequest) (GenerateResult, error)
+}
+
+func newProviders(cfg config.Config, client *http.Client) map[string]Provider {
+	providers := make(map[string]Provider)
+	if cfg.OpenAIAPIKey != "" {
+		providers["openai"] = &OpenAIProvider{APIKey: cfg.OpenAIAPIKey, BaseURL: cfg.OpenAIBaseURL, Client: client}
+	}
+	if cfg.AnthropicAPIKey != "" {
+		providers["anthropic"] = &AnthropicProvider{APIKey: cfg.AnthropicAPIKey, BaseURL: cfg.AnthropicBaseURL, Client: client}
+	}
+	if cfg.GeminiAPIKey != "" {
+		providers["gemini"] = &GeminiProvider{APIKey: cfg.GeminiAPIKey, BaseURL: cfg.GeminiBaseURL, Client: client}
+	}
+	return providers
+}
+
+func buildUserPrompt(req GenerateRequest) string {
+	content := strings.TrimSpace(req.Content)
+	if content == "" {
+		content = "(empty)"
+	}
+	return strings.TrimSpace(req.Prompt) + "\n\nContent:\n" + content
+}
+
+// parseGenerateOutput extracts the summary/rewrite JSON object from model text,
+// tolerating markdown code fences around it.
+func parseGenerateOutput(text string) (GenerateResult, error) {
+	raw := strings.TrimSpace(text)
+	raw = strings.TrimPrefix(raw, "```json")
+	raw = strings.TrimPrefix(raw, "```")
+	raw = strings.TrimSuffix(raw, "```")
+	raw = strings.TrimSpace(raw)
+	if start, end := strings.Index(raw, "{"), strings.LastIndex(raw, "}"); start >= 0 && end > start {
+		raw = raw[start : end+1]
+	}
+
+	var parsed struct {
+		Summary string `json:"summary"`
+		Rewrite string `json:"rewrite"`
+	}
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		return GenerateResult{}, fmt.Errorf("provider returned non-JSON output: %w", err)
+	}
+	parsed.Summary = strings.TrimSpace(parsed.Summary)
+	parsed.Rewrite = strings.TrimSpace(parsed.Rewrite)
+	if parsed.Summary == "" && parsed.Rewrite == "" {
+		return GenerateResult{}, fmt.Errorf("provider returned empty summary and rewrite")
+	}
+	return GenerateResult{Summary: parsed.Summary, Rewrite: parsed.Rewrite}, nil
+}
+
+type ProviderHTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ProviderHTTPError) Error() string {
+	return fmt.Sprintf("provider responded %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the request may succeed if sent again later.
+func (e *ProviderHTTPError) Retryable() bool {
+	return e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body any, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("content-type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: 60 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet := strings.TrimSpace(string(respBody))
+		if len(snippet) > 300 {
+			snippet = snippet[:300] + "..."
+		}
+		return &ProviderHTTPError{StatusCode: resp.StatusCode, Body: snippet}
+	}
+	return json.Unmarshal(respBody, out)
+}
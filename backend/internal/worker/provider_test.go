@@ -0,0 +1,272 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// stubRequest is what a stub provider server received.
+type stubRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   map[string]any
+}
+
+// newStubServer answers every request with status and body and records the
+// last request it received.
+func newStubServer(t *testing.T, status int, body string) (*httptest.Server, *stubRequest) {
+	t.Helper()
+	received := &stubRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("read request body: %v", err)
+		}
+		received.method = r.Method
+		received.path = r.URL.Path
+		received.header = r.Header.Clone()
+		received.body = map[string]any{}
+		if err := json.Unmarshal(raw, &received.body); err != nil {
+			t.Errorf("request body is not JSON: %v", err)
+		}
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+var stubGenerateRequest = GenerateRequest{
+	Model:   "test-model",
+	Prompt:  "Tighten this",
+	Content: "Hello world",
+}
+
+const stubGenerateOutput = `{"summary":"A greeting.","rewrite":"Hello, world."}`
+
+func jsonString(t *testing.T, value string) string {
+	t.Helper()
+	raw, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(raw)
+}
+
+func assertGenerateResult(t *testing.T, result GenerateResult, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if result.Summary != "A greeting." || result.Rewrite != "Hello, world." {
+		t.Fatalf("Generate = %+v", result)
+	}
+}
+
+func assertUserPrompt(t *testing.T, got any) {
+	t.Helper()
+	want := buildUserPrompt(stubGenerateRequest)
+	if got != want {
+		t.Fatalf("user prompt = %q, want %q", got, want)
+	}
+}
+
+func TestOpenAIProviderGenerate(t *testing.T) {
+	server, received := newStubServer(t, http.StatusOK,
+		`{"choices":[{"message":{"role":"assistant","content":`+jsonString(t, stubGenerateOutput)+`}}]}`)
+	provider := &OpenAIProvider{APIKey: "sk-test", BaseURL: server.URL + "/", Client: server.Client()}
+
+	result, err := provider.Generate(context.Background(), stubGenerateRequest)
+	assertGenerateResult(t, result, err)
+
+	if received.method != http.MethodPost || received.path != "/chat/completions" {
+		t.Fatalf("request = %s %s", received.method, received.path)
+	}
+	if got := received.header.Get("authorization"); got != "Bearer sk-test" {
+		t.Fatalf("authorization = %q", got)
+	}
+	if received.body["model"] != "test-model" {
+		t.Fatalf("model = %v", received.body["model"])
+	}
+	format, _ := received.body["response_format"].(map[string]any)
+	if format["type"] != "json_object" {
+		t.Fatalf("response_format = %v", received.body["response_format"])
+	}
+	messages, _ := received.body["messages"].([]any)
+	if len(messages) != 2 {
+		t.Fatalf("messages = %v", received.body["messages"])
+	}
+	system, _ := messages[0].(map[string]any)
+	user, _ := messages[1].(map[string]any)
+	if system["role"] != "system" || system["content"] != aiSystemPrompt {
+		t.Fatalf("system message = %v", system)
+	}
+	if user["role"] != "user" {
+		t.Fatalf("user message = %v", user)
+	}
+	assertUserPrompt(t, user["content"])
+}
+
+func TestOpenAIProviderNoChoices(t *testing.T) {
+	server, _ := newStubServer(t, http.StatusOK, `{"choices":[]}`)
+	provider := &OpenAIProvider{APIKey: "sk-test", BaseURL: server.URL, Client: server.Client()}
+
+	if _, err := provider.Generate(context.Background(), stubGenerateRequest); err == nil {
+		t.Fatal("Generate succeeded without choices")
+	}
+}
+
+func TestAnthropicProviderGenerate(t *testing.T) {
+	server, received := newStubServer(t, http.StatusOK,
+		`{"content":[{"type":"thinking","text":"ignored"},{"type":"text","text":`+jsonString(t, "```json\n"+stubGenerateOutput+"\n```")+`}]}`)
+	provider := &AnthropicProvider{APIKey: "ak-test", BaseURL: server.URL, Client: server.Client()}
+
+	result, err := provider.Generate(context.Background(), stubGenerateRequest)
+	assertGenerateResult(t, result, err)
+
+	if received.method != http.MethodPost || received.path != "/v1/messages" {
+		t.Fatalf("request = %s %s", received.method, received.path)
+	}
+	if got := received.header.Get("x-api-key"); got != "ak-test" {
+		t.Fatalf("x-api-key = %q", got)
+	}
+	if got := received.header.Get("anthropic-version"); got != anthropicAPIVersion {
+		t.Fatalf("anthropic-version = %q", got)
+	}
+	if received.body["model"] != "test-model" || received.body["system"] != aiSystemPrompt {
+		t.Fatalf("body = %v", received.body)
+	}
+	if received.body["max_tokens"] != float64(2048) {
+		t.Fatalf("max_tokens = %v", received.body["max_tokens"])
+	}
+	messages, _ := received.body["messages"].([]any)
+	if len(messages) != 1 {
+		t.Fatalf("messages = %v", received.body["messages"])
+	}
+	user, _ := messages[0].(map[string]any)
+	if user["role"] != "user" {
+		t.Fatalf("user message = %v", user)
+	}
+	assertUserPrompt(t, user["content"])
+}
+
+func TestAnthropicProviderNoText(t *testing.T) {
+	server, _ := newStubServer(t, http.StatusOK, `{"content":[{"type":"tool_use"}]}`)
+	provider := &AnthropicProvider{APIKey: "ak-test", BaseURL: server.URL, Client: server.Client()}
+
+	if _, err := provider.Generate(context.Background(), stubGenerateRequest); err == nil {
+		t.Fatal("Generate succeeded without text content")
+	}
+}
+
+func TestGeminiProviderGenerate(t *testing.T) {
+	half := len(stubGenerateOutput) / 2
+	server, received := newStubServer(t, http.StatusOK,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":`+jsonString(t, stubGenerateOutput[:half])+`},{"text":`+jsonString(t, stubGenerateOutput[half:])+`}]}}]}`)
+	provider := &GeminiProvider{APIKey: "gk-test", BaseURL: server.URL, Client: server.Client()}
+
+	result, err := provider.Generate(context.Background(), stubGenerateRequest)
+	assertGenerateResult(t, result, err)
+
+	if received.method != http.MethodPost || received.path != "/v1beta/models/test-model:generateContent" {
+		t.Fatalf("request = %s %s", received.method, received.path)
+	}
+	if got := received.header.Get("x-goog-api-key"); got != "gk-test" {
+		t.Fatalf("x-goog-api-key = %q", got)
+	}
+	generationConfig, _ := received.body["generationConfig"].(map[string]any)
+	if generationConfig["responseMimeType"] != "application/json" {
+		t.Fatalf("generationConfig = %v", received.body["generationConfig"])
+	}
+	system, _ := received.body["systemInstruction"].(map[string]any)
+	systemParts, _ := system["parts"].([]any)
+	if len(systemParts) != 1 || systemParts[0].(map[string]any)["text"] != aiSystemPrompt {
+		t.Fatalf("systemInstruction = %v", received.body["systemInstruction"])
+	}
+	contents, _ := received.body["contents"].([]any)
+	if len(contents) != 1 {
+		t.Fatalf("contents = %v", received.body["contents"])
+	}
+	user, _ := contents[0].(map[string]any)
+	userParts, _ := user["parts"].([]any)
+	if user["role"] != "user" || len(userParts) != 1 {
+		t.Fatalf("user content = %v", user)
+	}
+	assertUserPrompt(t, userParts[0].(map[string]any)["text"])
+}
+
+func TestGeminiProviderNoCandidates(t *testing.T) {
+	server, _ := newStubServer(t, http.StatusOK, `{"candidates":[]}`)
+	provider := &GeminiProvider{APIKey: "gk-test", BaseURL: server.URL, Client: server.Client()}
+
+	if _, err := provider.Generate(context.Background(), stubGenerateRequest); err == nil {
+		t.Fatal("Generate succeeded without candidates")
+	}
+}
+
+func TestProviderHTTPErrors(t *testing.T) {
+	tests := []struct {
+		status    int
+		retryable bool
+	}{
+		{http.StatusBadRequest, false},
+		{http.StatusUnauthorized, false},
+		{http.StatusNotFound, false},
+		{http.StatusRequestTimeout, true},
+		{http.StatusTooManyRequests, true},
+		{http.StatusInternalServerError, true},
+		{http.StatusServiceUnavailable, true},
+	}
+	for _, tt := range tests {
+		server, _ := newStubServer(t, tt.status, `{"error":{"message":"`+strings.Repeat("x", 400)+`"}}`)
+		provider := &OpenAIProvider{APIKey: "sk-test", BaseURL: server.URL, Client: server.Client()}
+
+		_, err := provider.Generate(context.Background(), stubGenerateRequest)
+		var httpErr *ProviderHTTPError
+		if !errors.As(err, &httpErr) {
+			t.Fatalf("status %d: error = %v, want *ProviderHTTPError", tt.status, err)
+		}
+		if httpErr.StatusCode != tt.status {
+			t.Fatalf("status %d: StatusCode = %d", tt.status, httpErr.StatusCode)
+		}
+		if len(httpErr.Body) > 303 {
+			t.Fatalf("status %d: body snippet is %d bytes", tt.status, len(httpErr.Body))
+		}
+		if httpErr.Retryable() != tt.retryable {
+			t.Fatalf("status %d: Retryable() = %v, want %v", tt.status, httpErr.Retryable(), tt.retryable)
+		}
+		if isPermanent(err) == tt.retryable {
+			t.Fatalf("status %d: isPermanent() = %v", tt.status, isPermanent(err))
+		}
+	}
+}
+
+func TestParseGenerateOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		ok   bool
+	}{
+		{"plain", stubGenerateOutput, true},
+		{"fenced", "```json\n" + stubGenerateOutput + "\n```", true},
+		{"surrounded", "Here you go: " + stubGenerateOutput + " Done.", true},
+		{"not json", "Hello, world.", false},
+		{"empty fields", `{"summary":" ","rewrite":""}`, false},
+	}
+	for _, tt := range tests {
+		result, err := parseGenerateOutput(tt.text)
+		if tt.ok {
+			assertGenerateResult(t, result, err)
+		} else if err == nil {
+			t.Fatalf("%s: parseGenerateOutput succeeded with %+v", tt.name, result)
+		}
+	}
+}
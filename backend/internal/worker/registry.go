@@ -0,0 +1,27 @@
+package worker
+
+import (
+	"context"
+	"sort"
+
+	"tdp-lite/backend/internal/store"
+)
+
+// JobHandler runs one claimed job and returns the result stored on the job
+// row. Errors are retried with backoff unless wrapped with permanent.
+type JobHandler func(ctx context.Context, job store.Job) (map[string]any, error)
+
+// Register routes jobs of jobType to handler. The worker only claims job types
+// it has a handler for, so unregistered types stay queued for another worker.
+func (w *Worker) Register(jobType string, handler JobHandler) {
+	w.handlers[jobType] = handler
+}
+
+func (w *Worker) jobTypes() []string {
+	types := make([]string, 0, len(w.handlers))
+	for jobType := range w.handlers {
+		types = append(types, jobType)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"errors"
+	"time"
+
+	"tdp-lite/backend/internal/store"
+)
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// permanent marks an error that retrying cannot fix, so the job is
+// dead-lettered without spending its remaining attempts.
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var permErr *permanentError
+	if errors.As(err, &permErr) {
+		return true
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		return true
+	}
+	var httpErr *ProviderHTTPError
+	if errors.As(err, &httpErr) {
+		return !httpErr.Retryable()
+	}
+	var webhookErr *WebhookHTTPError
+	if errors.As(err, &webhookErr) {
+		return !webhookErr.Retryable()
+	}
+	return false
+}
+
+// retryBackoff returns base * 2^(attempt-1), capped at maxDelay.
+func retryBackoff(attempt int, base, maxDelay time.Duration) time.Duration {
+	if base <= 0 {
+		base = time.Second
+	}
+	delay := base
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if maxDelay > 0 && delay >= maxDelay {
+			return maxDelay
+		}
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
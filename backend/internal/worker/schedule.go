@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"tdp-lite/backend/internal/store"
+)
+
+func (w *Worker) auditActor() string {
+	return "worker:" + w.id
+}
+
+// runScheduledPublishJob publishes every scheduled item whose publishedAt has
+// passed. The store audits each one and records its outbox event in the same
+// transaction.
+func (w *Worker) runScheduledPublishJob(ctx context.Context, job store.Job) (map[string]any, error) {
+	items, err := w.store.PublishDueScheduledContent(ctx, w.auditActor(), store.ContentChange{
+		ActorKeyID: w.auditActor(),
+		Event:      "published",
+		Metadata: map[string]any{
+			"scheduled": true,
+			"jobId":     job.ID,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		log.Printf("scheduled %s published id=%s", item.Kind, item.ID)
+	}
+	return map[string]any{"published": items}, nil
+}
+
+func (w *Worker) enqueueDueScheduledPublish(ctx context.Context) {
+	due, err := w.store.HasDueScheduledContent(ctx)
+	if err != nil {
+		log.Printf("scheduled content check failed: %v", err)
+		return
+	}
+	if !due {
+		return
+	}
+	if _, err := w.store.EnqueueJob(ctx, store.EnqueueJobInput{
+		Type:      store.JobTypeScheduledPublish,
+		DedupeKey: "sweep",
+	}); err != nil {
+		log.Printf("scheduled publish enqueue failed: %v", err)
+	}
+}
+
+func (w *Worker) scheduleLoop(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.ScheduleCheckInterval)
+	defer ticker.Stop()
+
+	w.enqueueDueScheduledPublish(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.enqueueDueScheduledPublish(ctx)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+
+	"tdp-lite/backend/internal/store"
+)
+
+const searchSnapshotPageSize = 200
+
+var searchSnapshotLocales = []string{"en", "zh"}
+
+// Ported from stripMarkdown in src/lib/search/searchSnapshot.ts so server-built
+// snapshots match the ones the frontend build script produced.
+var markdownStripRules = []struct {
+	pattern *regexp.Regexp
+	repl    string
+}{
+	{regexp.MustCompile("(?s)```.*?```"), " "},
+	{regexp.MustCompile("`[^`]*`"), " "},
+	{regexp.MustCompile(`!\[[^\]]*]\([^)]*\)`), " "},
+	{regexp.MustCompile(`\[([^\]]+)]\([^)]*\)`), "$1"},
+	{regexp.MustCompile(`<[^>]+>`), " "},
+	{regexp.MustCompile(`[#>*_\-~]`), " "},
+	{regexp.MustCompile(`\s+`), " "},
+}
+
+var whitespacePattern = regexp.MustCompile(`\s+`)
+
+func stripMarkdown(input string) string {
+	for _, rule := range markdownStripRules {
+		input = rule.pattern.ReplaceAllString(input, rule.repl)
+	}
+	return strings.TrimSpace(input)
+}
+
+func shortenText(input string, maxLength int) string {
+	trimmed := []rune(strings.TrimSpace(input))
+	if len(trimmed) <= maxLength {
+		return string(trimmed)
+	}
+	return string(trimmed[:max(1, maxLength-3)]) + "..."
+}
+
+func normalizeSearchText(parts ...string) string {
+	joined := norm.NFKC.String(strings.Join(parts, " "))
+	return strings.TrimSpace(whitespacePattern.ReplaceAllString(strings.ToLower(joined), " "))
+}
+
+func snapshotTime(value time.Time) string {
+	return value.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+func snapshotSortAt(publishedAt *time.Time, createdAt time.Time) string {
+	if publishedAt != nil {
+		return snapshotTime(*publishedAt)
+	}
+	return snapshotTime(createdAt)
+}
+
+func galleryImageID(rawURL string) *string {
+	normalized := strings.TrimSpace(rawURL)
+	if strings.HasPrefix(normalized, "<") && strings.HasSuffix(normalized, ">") {
+		normalized = strings.TrimSpace(normalized[1 : len(normalized)-1])
+	}
+	if index := strings.Index(normalized, "#"); index >= 0 {
+		normalized = strings.TrimSpace(normalized[:index])
+	}
+	if normalized == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(normalized))
+	id := hex.EncodeToString(sum[:])[:20]
+	return &id
+}
+
+// feedItem serializes a content record the way the API returns it, tagged
+// with its feed type, for the frontend to revive from the snapshot.
+func feedItem(feedType string, value any) (map[string]any, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var item map[string]any
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return nil, err
+	}
+	item["type"] = feedType
+	return item, nil
+}
+
+func optionalString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func buildPostDocument(post store.Post) (map[string]any, error) {
+	item, err := feedItem("post", post)
+	if err != nil {
+		return nil, err
+	}
+	plain := stripMarkdown(post.Content)
+	excerpt := strings.TrimSpace(optionalString(post.Excerpt))
+	if excerpt == "" {
+		excerpt = plain
+	}
+	tags := make([]string, 0, len(post.Tags))
+	for _, tag := range post.Tags {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return map[string]any{
+		"id":             post.ID,
+		"section":        "post",
+		"locale":         post.Locale,
+		"sortAt":         snapshotSortAt(post.PublishedAt, post.CreatedAt),
+		"slug":           post.Slug,
+		"title":          post.Title,
+		"excerpt":        shortenText(excerpt, 180),
+		"tags":           tags,
+		"feedItem":       item,
+		"searchableText": normalizeSearchText(append([]string{post.Title, optionalString(post.Excerpt), plain}, tags...)...),
+	}, nil
+}
+
+func buildMomentDocument(moment store.Moment) (map[string]any, error) {
+	item, err := feedItem("moment", moment)
+	if err != nil {
+		return nil, err
+	}
+	var locationName *string
+	if moment.Location != nil && moment.Location.Name != "" {
+		locationName = &moment.Location.Name
+	}
+	return map[string]any{
+		"id":             moment.ID,
+		"section":        "moment",
+		"locale":         moment.Locale,
+		"sortAt":         snapshotSortAt(moment.PublishedAt, moment.CreatedAt),
+		"content":        shortenText(moment.Content, 220),
+		"locationName":   locationName,
+		"feedItem":       item,
+		"searchableText": normalizeSearchText(moment.Content, optionalString(locationName)),
+	}, nil
+}
+
+func buildGalleryDocument(gallery store.GalleryItem) (map[string]any, error) {
+	item, err := feedItem("gallery", gallery)
+	if err != nil {
+		return nil, err
+	}
+	iso := ""
+	if gallery.ISO != nil {
+		iso = strconv.Itoa(*gallery.ISO)
+	}
+	return map[string]any{
+		"id":          gallery.ID,
+		"section":     "gallery",
+		"locale":      gallery.Locale,
+		"sortAt":      snapshotSortAt(gallery.PublishedAt, gallery.CreatedAt),
+		"imageId":     galleryImageID(gallery.FileURL),
+		"title":       gallery.Title,
+		"camera":      gallery.Camera,
+		"lens":        gallery.Lens,
+		"focalLength": gallery.FocalLength,
+		"aperture":    gallery.Aperture,
+		"iso":         gallery.ISO,
+		"thumbUrl":    gallery.ThumbURL,
+		"fileUrl":     gallery.FileURL,
+		"feedItem":    item,
+		"searchableText": normalizeSearchText(
+			optionalString(gallery.Title),
+			optionalString(gallery.Camera),
+			optionalString(gallery.Lens),
+			optionalString(gallery.FocalLength),
+			optionalString(gallery.Aperture),
+			iso,
+		),
+	}, nil
+}
+
+// pageAll calls list with increasing offsets until a short page comes back.
+func pageAll[T any](ctx context.Context, list func(ctx context.Context, limit, offset int) ([]T, error)) ([]T, error) {
+	items := make([]T, 0)
+	for offset := 0; ; offset += searchSnapshotPageSize {
+		page, err := list(ctx, searchSnapshotPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+		if len(page) < searchSnapshotPageSize {
+			return items, nil
+		}
+	}
+}
+
+func (w *Worker) buildSearchSnapshot(ctx context.Context, locale string, generatedAt time.Time) (map[string]any, error) {
+	posts, err := pageAll(ctx, func(ctx context.Context, limit, offset int) ([]store.Post, error) {
+		return w.store.ListPublicPosts(ctx, locale, limit, offset)
+	})
+	if err != nil {
+		return nil, err
+	}
+	moments, err := pageAll(ctx, func(ctx context.Context, limit, offset int) ([]store.Moment, error) {
+		return w.store.ListPublicMoments(ctx, locale, limit, offset)
+	})
+	if err != nil {
+		return nil, err
+	}
+	gallery, err := pageAll(ctx, func(ctx context.Context, limit, offset int) ([]store.GalleryItem, error) {
+		return w.store.ListPublicGallery(ctx, locale, limit, offset)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]map[string]any, 0, len(posts)+len(moments)+len(gallery))
+	for _, post := range posts {
+		document, err := buildPostDocument(post)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, document)
+	}
+	for _, moment := range moments {
+		document, err := buildMomentDocument(moment)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, document)
+	}
+	for _, item := range gallery {
+		document, err := buildGalleryDocument(item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, document)
+	}
+
+	// Newest first, ties by id descending, matching compareDocuments.
+	sort.SliceStable(items, func(i, j int) bool {
+		left, right := items[i]["sortAt"].(string), items[j]["sortAt"].(string)
+		if left != right {
+			return left > right
+		}
+		return items[i]["id"].(string) > items[j]["id"].(string)
+	})
+
+	return map[string]any{
+		"schemaVersion": store.SearchSnapshotSchemaVersion,
+		"generatedAt":   snapshotTime(generatedAt),
+		"locale":        locale,
+		"counts": map[string]any{
+			"post":    len(posts),
+			"moment":  len(moments),
+			"gallery": len(gallery),
+		},
+		"items": items,
+	}, nil
+}
+
+// runSearchSnapshotJob rebuilds every locale's snapshot when a refresh is
+// pending. It records the generation read before building as processed, so a
+// refresh requested mid-build stays pending and queues another rebuild.
+func (w *Worker) runSearchSnapshotJob(ctx context.Context, job store.Job) (map[string]any, error) {
+	state, err := w.store.GetSearchSnapshotRefreshState(ctx)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	if !state.Pending() {
+		return map[string]any{"skipped": true, "reason": "no pending refresh"}, nil
+	}
+
+	generatedAt := time.Now().UTC()
+	counts := map[string]any{}
+	inputs := make([]store.UpsertSearchSnapshotInput, 0, len(searchSnapshotLocales))
+	for _, locale := range searchSnapshotLocales {
+		snapshot, err := w.buildSearchSnapshot(ctx, locale, generatedAt)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, store.UpsertSearchSnapshotInput{
+			Locale:      locale,
+			Snapshot:    snapshot,
+			GeneratedAt: &generatedAt,
+		})
+		counts[locale] = snapshot["counts"]
+	}
+	// Every locale is written, and the refresh marked processed, together.
+	if err := w.store.ReplaceSearchSnapshots(ctx, inputs, state.RequestedGeneration); err != nil {
+		return nil, err
+	}
+
+	log.Printf("search snapshot rebuilt generation=%d generatedAt=%s", state.RequestedGeneration, snapshotTime(generatedAt))
+	return map[string]any{
+		"generation":  state.RequestedGeneration,
+		"generatedAt": snapshotTime(generatedAt),
+		"counts":      counts,
+	}, nil
+}
+
+// ensureSearchSnapshotJob queues a rebuild for refreshes that were requested
+// without one, e.g. before this worker version or when the enqueue failed.
+func (w *Worker) ensureSearchSnapshotJob(ctx context.Context) {
+	state, err := w.store.GetSearchSnapshotRefreshState(ctx)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("search snapshot state check failed: %v", err)
+		}
+		return
+	}
+	if !state.Pending() {
+		return
+	}
+	if _, err := w.store.EnqueueSearchSnapshotJob(ctx); err != nil {
+		log.Printf("search snapshot enqueue failed: %v", err)
+	}
+}
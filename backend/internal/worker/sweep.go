@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// sweep deletes expired nonces, preview sessions, idempotency keys, rate
+// windows, dispatched outbox events and old presence history, keeping that
+// cleanup off the API request path.
+func (w *Worker) sweep(ctx context.Context) {
+	result, err := w.store.SweepExpired(ctx, w.cfg.IdempotencyRetention, w.cfg.OutboxRetention, w.cfg.PresenceRetention)
+	if err != nil {
+		log.Printf("sweeper error: %v", err)
+	}
+	if result.Total() > 0 {
+		log.Printf(
+			"sweeper removed nonces=%d preview_sessions=%d idempotency_keys=%d rate_windows=%d outbox_events=%d presence_history=%d",
+			result.Nonces,
+			result.PreviewSessions,
+			result.IdempotencyKeys,
+			result.RateWindows,
+			result.OutboxEvents,
+			result.PresenceHistory,
+		)
+	}
+}
+
+func (w *Worker) sweepLoop(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.SweepInterval)
+	defer ticker.Stop()
+
+	w.sweep(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.sweep(ctx)
+		}
+	}
+}
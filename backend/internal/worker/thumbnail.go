@@ -0,0 +1,161 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awscredentials "github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"tdp-lite/backend/internal/config"
+	"tdp-lite/backend/internal/store"
+)
+
+const (
+	thumbnailMaxEdge        = 480
+	thumbnailQuality        = 82
+	thumbnailMaxSourceBytes = 16 * 1024 * 1024
+	// thumbnailMaxSourcePixels bounds the decoded image (about 200 MB as
+	// RGBA), checked from the header before any pixels are decoded.
+	thumbnailMaxSourcePixels = 50_000_000
+)
+
+func newObjectStore(cfg config.Config) *s3.Client {
+	if cfg.S3Endpoint == "" || cfg.S3AccessKeyID == "" || cfg.S3SecretAccessKey == "" || cfg.S3Bucket == "" {
+		return nil
+	}
+	return s3.New(s3.Options{
+		Region:       cfg.S3Region,
+		Credentials:  awscredentials.NewStaticCredentialsProvider(cfg.S3AccessKeyID, cfg.S3SecretAccessKey, ""),
+		BaseEndpoint: aws.String(cfg.S3Endpoint),
+		UsePathStyle: true,
+	})
+}
+
+func thumbnailObjectKey(objectKey string) string {
+	return "thumbs/" + strings.TrimSuffix(objectKey, path.Ext(objectKey)) + ".jpg"
+}
+
+func (w *Worker) runThumbnailJob(ctx context.Context, job store.Job) (map[string]any, error) {
+	assetID, _ := job.Payload["assetId"].(string)
+	if assetID == "" {
+		return nil, permanent(errors.New("thumbnail job missing assetId"))
+	}
+	asset, err := w.store.GetMediaAssetByID(ctx, assetID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(asset.Mime, "image/") {
+		return nil, permanent(fmt.Errorf("thumbnail unsupported for mime %s", asset.Mime))
+	}
+
+	object, err := w.objects.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(w.cfg.S3Bucket),
+		Key:    aws.String(asset.ObjectKey),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", asset.ObjectKey, err)
+	}
+	defer object.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(object.Body, thumbnailMaxSourceBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", asset.ObjectKey, err)
+	}
+	if len(raw) > thumbnailMaxSourceBytes {
+		return nil, permanent(fmt.Errorf("%s exceeds %d bytes", asset.ObjectKey, thumbnailMaxSourceBytes))
+	}
+	header, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, permanent(fmt.Errorf("decode %s: %w", asset.ObjectKey, err))
+	}
+	if pixels := int64(header.Width) * int64(header.Height); pixels > thumbnailMaxSourcePixels {
+		return nil, permanent(fmt.Errorf("%s is %dx%d, over the %d pixel limit", asset.ObjectKey, header.Width, header.Height, thumbnailMaxSourcePixels))
+	}
+	src, format, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, permanent(fmt.Errorf("decode %s: %w", asset.ObjectKey, err))
+	}
+	thumb := scaleToFit(src, thumbnailMaxEdge)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, permanent(err)
+	}
+
+	key := thumbnailObjectKey(asset.ObjectKey)
+	if _, err := w.objects.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(w.cfg.S3Bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(buf.Bytes()),
+		ContentLength: aws.Int64(int64(buf.Len())),
+		ContentType:   aws.String("image/jpeg"),
+	}); err != nil {
+		return nil, fmt.Errorf("upload %s: %w", key, err)
+	}
+
+	url := strings.TrimRight(w.cfg.S3PublicURL, "/") + "/" + key
+	if err := w.store.SetMediaAssetThumbnail(ctx, asset.ID, key, url); err != nil {
+		return nil, err
+	}
+	bounds := thumb.Bounds()
+	return map[string]any{
+		"assetId":      asset.ID,
+		"objectKey":    key,
+		"url":          url,
+		"width":        bounds.Dx(),
+		"height":       bounds.Dy(),
+		"sourceFormat": format,
+	}, nil
+}
+
+// scaleToFit box-filters src down so its longest edge is at most maxEdge,
+// flattening transparency onto white since the output is JPEG.
+func scaleToFit(src image.Image, maxEdge int) *image.RGBA {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	dstW, dstH := srcW, srcH
+	if srcW >= srcH && srcW > maxEdge {
+		dstW, dstH = maxEdge, max(1, srcH*maxEdge/srcW)
+	} else if srcH > srcW && srcH > maxEdge {
+		dstW, dstH = max(1, srcW*maxEdge/srcH), maxEdge
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0 := bounds.Min.Y + y*srcH/dstH
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*srcH/dstH)
+		for x := 0; x < dstW; x++ {
+			x0 := bounds.Min.X + x*srcW/dstW
+			x1 := max(x0+1, bounds.Min.X+(x+1)*srcW/dstW)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			white := 0xffff - a/n
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8((r/n + white) >> 8),
+				G: uint8((g/n + white) >> 8),
+				B: uint8((b/n + white) >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,161 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"tdp-lite/backend/internal/auth"
+	"tdp-lite/backend/internal/store"
+	"tdp-lite/backend/internal/utils"
+)
+
+var errWebhookPrivateAddress = errors.New("webhook target resolves to a private, loopback or link-local address")
+
+// WebhookHTTPError is a non-2xx answer from a webhook subscriber.
+type WebhookHTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *WebhookHTTPError) Error() string {
+	return fmt.Sprintf("webhook responded %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the delivery may succeed if sent again later.
+func (e *WebhookHTTPError) Retryable() bool {
+	return e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// newWebhookClient does not follow redirects: a delivery goes to the
+// subscribed URL only, and a 3xx answer fails it. It dials public addresses
+// only, checked after DNS resolution so a rebinding host cannot reach internal
+// services, and it bypasses any proxy so the check sees the real target.
+func newWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !utils.IsPublicIP(net.ParseIP(host)) {
+				return errWebhookPrivateAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// runWebhookDeliveryJob posts one delivery to its subscription and logs the
+// attempt. 2xx responses succeed; 408, 429, 5xx and network errors are retried
+// with the job's backoff, any other response fails the delivery at once.
+func (w *Worker) runWebhookDeliveryJob(ctx context.Context, job store.Job) (map[string]any, error) {
+	deliveryID, _ := job.Payload["deliveryId"].(string)
+	if deliveryID == "" {
+		return nil, permanent(errors.New("webhook delivery job missing deliveryId"))
+	}
+	delivery, err := w.store.GetWebhookDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	started := time.Now()
+	statusCode, sendErr := w.sendWebhook(ctx, delivery)
+	attempt := store.WebhookDeliveryAttempt{
+		Attempt:    job.Attempts,
+		DurationMs: int(time.Since(started).Milliseconds()),
+	}
+	if statusCode > 0 {
+		attempt.ResponseStatus = &statusCode
+	}
+	status := store.WebhookDeliverySucceeded
+	if sendErr != nil {
+		message := sendErr.Error()
+		attempt.Error = &message
+		status = store.WebhookDeliveryPending
+		if isPermanent(sendErr) || job.Attempts >= w.cfg.JobMaxAttempts {
+			status = store.WebhookDeliveryFailed
+		}
+	}
+
+	recordCtx, cancel := finalizeContext(ctx)
+	defer cancel()
+	if err := w.store.RecordWebhookAttempt(recordCtx, delivery.ID, status, attempt); err != nil {
+		log.Printf("webhook attempt log failed delivery=%s err=%v", delivery.ID, err)
+	}
+	if sendErr != nil {
+		return nil, sendErr
+	}
+	return map[string]any{"deliveryId": delivery.ID, "responseStatus": statusCode}, nil
+}
+
+func (w *Worker) sendWebhook(ctx context.Context, delivery store.WebhookDelivery) (int, error) {
+	subscription, err := w.store.GetWebhookSubscriptionSecret(ctx, delivery.SubscriptionID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return 0, permanent(errors.New("webhook subscription deleted"))
+		}
+		return 0, err
+	}
+	if !subscription.Active {
+		return 0, permanent(errors.New("webhook subscription disabled"))
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"id":        delivery.EventID,
+		"type":      delivery.EventType,
+		"createdAt": delivery.CreatedAt,
+		"data":      delivery.Payload,
+	})
+	if err != nil {
+		return 0, permanent(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, permanent(err)
+	}
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("user-agent", "tdp-webhooks/1")
+	req.Header.Set(auth.WebhookEventHeader, delivery.EventType)
+	req.Header.Set(auth.WebhookDeliveryHeader, delivery.ID)
+	req.Header.Set(auth.WebhookSignatureHeader, auth.SignWebhook(subscription.Secret, time.Now(), body))
+
+	resp, err := w.webhooks.Do(req)
+	if err != nil {
+		if errors.Is(err, errWebhookPrivateAddress) {
+			return 0, permanent(errWebhookPrivateAddress)
+		}
+		return 0, fmt.Errorf("webhook post failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet := strings.TrimSpace(string(respBody))
+		if len(snippet) > 300 {
+			snippet = snippet[:300] + "..."
+		}
+		return resp.StatusCode, &WebhookHTTPError{StatusCode: resp.StatusCode, Body: snippet}
+	}
+	return resp.StatusCode, nil
+}
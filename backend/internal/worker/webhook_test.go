@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("webhook client reached a loopback server")
+	}))
+	t.Cleanup(server.Close)
+
+	client := newWebhookClient(5 * time.Second)
+	for _, target := range []string{server.URL, "http://169.254.169.254/latest/meta-data/", "http://10.0.0.1/"} {
+		resp, err := client.Get(target)
+		if err == nil {
+			resp.Body.Close()
+			t.Fatalf("GET %s succeeded, want %v", target, errWebhookPrivateAddress)
+		}
+		if !errors.Is(err, errWebhookPrivateAddress) {
+			t.Fatalf("GET %s: error = %v, want %v", target, err, errWebhookPrivateAddress)
+		}
+	}
+}
+
+func TestWebhookHTTPErrorsArePermanentUnlessRetryable(t *testing.T) {
+	tests := []struct {
+		status    int
+		permanent bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusNotFound, true},
+		{http.StatusRequestTimeout, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusBadGateway, false},
+	}
+	for _, tt := range tests {
+		err := &WebhookHTTPError{StatusCode: tt.status}
+		if got := isPermanent(err); got != tt.permanent {
+			t.Errorf("status %d: isPermanent = %v, want %v", tt.status, got, tt.permanent)
+		}
+	}
+}
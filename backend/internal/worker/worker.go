@@ -3,86 +3,335 @@ package worker
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
-	"strings"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
 	"tdp-lite/backend/internal/config"
 	"tdp-lite/backend/internal/store"
+	"tdp-lite/backend/internal/utils"
 )
 
 type Worker struct {
-	cfg   config.Config
-	store *store.Store
+	cfg       config.Config
+	store     *store.Store
+	providers map[string]Provider
+	handlers  map[string]JobHandler
+	objects   *s3.Client
+	webhooks  *http.Client
+	id        string
 }
 
 func New(cfg config.Config, st *store.Store) *Worker {
-	return &Worker{cfg: cfg, store: st}
+	client := &http.Client{Timeout: cfg.AIRequestTimeout}
+	id := cfg.WorkerID
+	if id == "" {
+		id = defaultWorkerID()
+	}
+	w := &Worker{
+		cfg:       cfg,
+		store:     st,
+		providers: newProviders(cfg, client),
+		handlers:  map[string]JobHandler{},
+		objects:   newObjectStore(cfg),
+		webhooks:  newWebhookClient(cfg.WebhookTimeout),
+		id:        id,
+	}
+	w.Register(store.JobTypeAI, w.runAIJob)
+	w.Register(store.JobTypeSearchSnapshot, w.runSearchSnapshotJob)
+	w.Register(store.JobTypeScheduledPublish, w.runScheduledPublishJob)
+	w.Register(store.JobTypeWebhookDelivery, w.runWebhookDeliveryJob)
+	w.Register(store.JobTypeOutboxDispatch, w.runOutboxDispatchJob)
+	if w.objects != nil {
+		w.Register(store.JobTypeThumbnail, w.runThumbnailJob)
+	} else {
+		log.Printf("tdp-worker %s has no S3 storage configured; thumbnail jobs stay queued for another worker", id)
+	}
+	return w
 }
 
-func summarize(content string) string {
-	trimmed := strings.TrimSpace(content)
-	if trimmed == "" {
-		return "No content provided."
+func defaultWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "tdp-worker"
 	}
-	if len(trimmed) <= 220 {
-		return trimmed
+	suffix, err := utils.RandomHex(3)
+	if err != nil {
+		suffix = "0"
 	}
-	return trimmed[:220] + "..."
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), suffix)
 }
 
-func buildAIResult(job store.AIJob, content string) map[string]any {
-	summary := summarize(content)
-	rewrite := summary
-	if len(summary) > 140 {
-		rewrite = summary[:140] + "..."
-	}
+func (w *Worker) ID() string {
+	return w.id
+}
+
+func buildAIResult(job store.AIJob, generated GenerateResult) map[string]any {
 	return map[string]any{
 		"provider":    job.Provider,
 		"model":       job.Model,
 		"prompt":      job.Prompt,
-		"summary":     summary,
-		"rewrite":     rewrite,
+		"summary":     generated.Summary,
+		"rewrite":     generated.Rewrite,
 		"generatedAt": time.Now().UTC().Format(time.RFC3339),
 	}
 }
 
-func (w *Worker) processOne(ctx context.Context) error {
-	job, err := w.store.ClaimNextQueuedAIJob(ctx)
+func (w *Worker) runAIJob(ctx context.Context, queued store.Job) (map[string]any, error) {
+	job, err := w.store.GetAIJobByID(ctx, queued.ID)
+	if err != nil {
+		return nil, err
+	}
+	provider, ok := w.providers[job.Provider]
+	if !ok {
+		return nil, permanent(fmt.Errorf("ai provider not configured: %s", job.Provider))
+	}
+
+	content, err := w.store.GetContentBody(ctx, job.Kind, job.ContentID)
+	if err != nil {
+		return nil, err
+	}
+
+	generated, err := provider.Generate(ctx, GenerateRequest{
+		Model:   job.Model,
+		Prompt:  job.Prompt,
+		Content: content,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s generate failed: %w", provider.Name(), err)
+	}
+	return buildAIResult(job, generated), nil
+}
+
+// finalizeContext keeps job bookkeeping writes alive after the job context is
+// canceled, so an aborted job is still returned to the queue.
+func finalizeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+}
+
+func (w *Worker) failJob(ctx context.Context, job store.Job, cause error) {
+	ctx, cancel := finalizeContext(ctx)
+	defer cancel()
+
+	if isPermanent(cause) || job.Attempts >= w.cfg.JobMaxAttempts {
+		if err := w.store.DeadLetterJob(ctx, job.ID, w.id, cause.Error()); err != nil {
+			log.Printf("dead-letter job failed id=%s type=%s err=%v", job.ID, job.Type, err)
+			return
+		}
+		log.Printf("job dead id=%s type=%s attempts=%d err=%v", job.ID, job.Type, job.Attempts, cause)
+		return
+	}
+
+	delay := retryBackoff(job.Attempts, w.cfg.JobRetryBaseDelay, w.cfg.JobRetryMaxDelay)
+	if err := w.store.RetryJob(ctx, job.ID, w.id, cause.Error(), time.Now().UTC().Add(delay)); err != nil {
+		log.Printf("retry job failed id=%s type=%s err=%v", job.ID, job.Type, err)
+		return
+	}
+	log.Printf("job retry scheduled id=%s type=%s attempt=%d delay=%s", job.ID, job.Type, job.Attempts, delay)
+}
+
+// releaseJob requeues a job aborted by the drain timeout. The job itself did
+// not fail, so the attempt is not counted against JobMaxAttempts.
+func (w *Worker) releaseJob(ctx context.Context, job store.Job, cause error) {
+	ctx, cancel := finalizeContext(ctx)
+	defer cancel()
+
+	if err := w.store.ReleaseJob(ctx, job.ID, w.id, "aborted on shutdown: "+cause.Error()); err != nil {
+		log.Printf("release job failed id=%s type=%s err=%v", job.ID, job.Type, err)
+		return
+	}
+	log.Printf("job released id=%s type=%s attempt=%d", job.ID, job.Type, job.Attempts)
+}
+
+// heartbeat renews the job lease until ctx is done. If the lease is lost to the
+// reaper, lost is called so the in-flight work can be abandoned.
+func (w *Worker) heartbeat(ctx context.Context, jobID string, lost func()) {
+	ticker := time.NewTicker(w.cfg.JobLeaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := w.store.RenewJobLease(ctx, jobID, w.id, w.cfg.JobLeaseTTL)
+			if err == nil {
+				continue
+			}
+			if errors.Is(err, store.ErrLeaseLost) {
+				log.Printf("job lease lost id=%s worker=%s", jobID, w.id)
+				lost()
+				return
+			}
+			if ctx.Err() == nil {
+				log.Printf("job lease renew failed id=%s err=%v", jobID, err)
+			}
+		}
+	}
+}
+
+// processOne claims and runs a single job. It reports whether a job was
+// claimed so callers can keep draining the queue without waiting.
+func (w *Worker) processOne(ctx context.Context) (bool, error) {
+	job, err := w.store.ClaimNextJob(ctx, w.id, w.cfg.JobLeaseTTL, w.jobTypes())
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
-			return nil
+			return false, nil
 		}
-		return err
+		return false, err
 	}
 
-	content, err := w.store.GetContentBody(ctx, job.Kind, job.ContentID)
+	jobCtx, cancelJob := context.WithCancel(ctx)
+	defer cancelJob()
+	var leaseLost atomic.Bool
+	go w.heartbeat(jobCtx, job.ID, func() {
+		leaseLost.Store(true)
+		cancelJob()
+	})
+
+	result, err := w.handlers[job.Type](jobCtx, job)
 	if err != nil {
-		_ = w.store.FailAIJob(ctx, job.ID, err.Error())
-		return err
+		// The reaper already requeued or dead-lettered the job; it is no
+		// longer ours to fail.
+		if leaseLost.Load() {
+			return true, fmt.Errorf("job %s abandoned after losing its lease: %w", job.ID, err)
+		}
+		if ctx.Err() != nil {
+			w.releaseJob(ctx, job, err)
+			return true, err
+		}
+		w.failJob(ctx, job, err)
+		return true, err
 	}
 
-	result := buildAIResult(job, content)
-	if err := w.store.CompleteAIJob(ctx, job.ID, result); err != nil {
-		_ = w.store.FailAIJob(ctx, job.ID, err.Error())
-		return err
+	finalCtx, cancelFinal := finalizeContext(ctx)
+	defer cancelFinal()
+	if err := w.store.CompleteJob(finalCtx, job.ID, w.id, result); err != nil {
+		if !errors.Is(err, store.ErrLeaseLost) {
+			w.failJob(ctx, job, err)
+		}
+		return true, err
 	}
-	log.Printf("processed ai job id=%s provider=%s model=%s", job.ID, job.Provider, job.Model)
-	return nil
+	log.Printf("processed job id=%s type=%s attempt=%d", job.ID, job.Type, job.Attempts)
+	return true, nil
 }
 
-func (w *Worker) Run(ctx context.Context) error {
+func (w *Worker) reapExpiredLeases(ctx context.Context) {
+	reclaimed, err := w.store.ReclaimExpiredJobLeases(ctx, w.cfg.JobMaxAttempts)
+	if err != nil {
+		log.Printf("job lease reaper error: %v", err)
+		return
+	}
+	if reclaimed > 0 {
+		log.Printf("job lease reaper reclaimed %d job(s)", reclaimed)
+	}
+}
+
+// loop drains the queue back-to-back while jobs are available and then waits
+// for a wakeup or the poll ticker. It stops claiming as soon as stopCtx is
+// done; the job in flight keeps running on workCtx.
+func (w *Worker) loop(stopCtx, workCtx context.Context, slot int, wake <-chan struct{}) {
 	ticker := time.NewTicker(w.cfg.JobPollInterval)
 	defer ticker.Stop()
 
+	for {
+		if stopCtx.Err() != nil {
+			return
+		}
+		claimed, err := w.processOne(workCtx)
+		if err != nil {
+			log.Printf("worker slot=%d process error: %v", slot, err)
+		}
+		if claimed {
+			continue
+		}
+
+		select {
+		case <-stopCtx.Done():
+			return
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) housekeeping(ctx context.Context) {
+	w.reapExpiredLeases(ctx)
+	w.ensureSearchSnapshotJob(ctx)
+}
+
+func (w *Worker) housekeepingLoop(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.JobLeaseTTL / 2)
+	defer ticker.Stop()
+
+	w.housekeeping(ctx)
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return
 		case <-ticker.C:
-			if err := w.processOne(ctx); err != nil {
-				log.Printf("worker process error: %v", err)
-			}
+			w.housekeeping(ctx)
 		}
 	}
 }
+
+// Run processes jobs with WorkerConcurrency goroutines until ctx is done, then
+// waits up to WorkerDrainTimeout for in-flight jobs before aborting them.
+func (w *Worker) Run(ctx context.Context) error {
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+
+	wake := make(chan struct{}, w.cfg.WorkerConcurrency)
+	if w.cfg.JobListenEnabled {
+		go w.listen(ctx, wake)
+	}
+
+	var wg sync.WaitGroup
+	for slot := 0; slot < w.cfg.WorkerConcurrency; slot++ {
+		wg.Add(1)
+		go func(slot int) {
+			defer wg.Done()
+			w.loop(ctx, workCtx, slot, wake)
+		}(slot)
+	}
+
+	var background sync.WaitGroup
+	background.Add(3)
+	go func() {
+		defer background.Done()
+		w.housekeepingLoop(ctx)
+	}()
+	go func() {
+		defer background.Done()
+		w.scheduleLoop(ctx)
+	}()
+	go func() {
+		defer background.Done()
+		w.sweepLoop(ctx)
+	}()
+
+	<-ctx.Done()
+	log.Printf("tdp-worker %s draining in-flight jobs (timeout %s)", w.id, w.cfg.WorkerDrainTimeout)
+
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(w.cfg.WorkerDrainTimeout):
+		log.Printf("tdp-worker %s drain timeout, aborting in-flight jobs", w.id)
+		cancelWork()
+		<-drained
+	}
+	background.Wait()
+	return ctx.Err()
+}
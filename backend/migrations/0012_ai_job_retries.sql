@@ -0,0 +1,16 @@
+-- AI job retries: attempt tracking, backoff scheduling and a dead-letter status.
+-- Requires 0001_api_platform.sql applied.
+
+ALTER TABLE ai_jobs ADD COLUMN IF NOT EXISTS attempts integer NOT NULL DEFAULT 0;
+ALTER TABLE ai_jobs ADD COLUMN IF NOT EXISTS next_run_at timestamptz NOT NULL DEFAULT NOW();
+ALTER TABLE ai_jobs ADD COLUMN IF NOT EXISTS last_error text;
+
+-- Legacy terminal failures become dead-lettered so they can be requeued.
+UPDATE ai_jobs
+SET status = 'dead',
+    last_error = COALESCE(last_error, error_message)
+WHERE status = 'failed';
+
+CREATE INDEX IF NOT EXISTS idx_ai_jobs_queued_next_run
+ON ai_jobs(next_run_at, created_at)
+WHERE status = 'queued';
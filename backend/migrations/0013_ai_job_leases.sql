@@ -0,0 +1,15 @@
+-- AI job leases: running jobs are owned by a worker until lease_expires_at,
+-- so jobs orphaned by a crashed worker can be reclaimed.
+-- Requires 0012_ai_job_retries.sql applied.
+
+ALTER TABLE ai_jobs ADD COLUMN IF NOT EXISTS locked_by text;
+ALTER TABLE ai_jobs ADD COLUMN IF NOT EXISTS lease_expires_at timestamptz;
+
+-- Jobs left running by pre-lease workers have no owner; expire them now.
+UPDATE ai_jobs
+SET lease_expires_at = NOW()
+WHERE status = 'running' AND lease_expires_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_ai_jobs_running_lease
+ON ai_jobs(lease_expires_at)
+WHERE status = 'running';
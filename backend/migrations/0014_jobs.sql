@@ -0,0 +1,57 @@
+-- Generic typed job queue shared by every tdp-worker job type.
+-- ai_jobs keeps the AI request and its results; queue state (status, attempts,
+-- lease) now lives in jobs under the same id.
+-- Requires 0013_ai_job_leases.sql applied.
+
+CREATE TABLE IF NOT EXISTS jobs (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  type text NOT NULL,
+  payload jsonb NOT NULL DEFAULT '{}'::jsonb,
+  dedupe_key text,
+  status text NOT NULL DEFAULT 'queued',
+  attempts integer NOT NULL DEFAULT 0,
+  next_run_at timestamptz NOT NULL DEFAULT NOW(),
+  last_error text,
+  result jsonb,
+  locked_by text,
+  lease_expires_at timestamptz,
+  created_at timestamptz NOT NULL DEFAULT NOW(),
+  updated_at timestamptz NOT NULL DEFAULT NOW(),
+  completed_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_queued_next_run
+ON jobs(next_run_at, created_at)
+WHERE status = 'queued';
+
+CREATE INDEX IF NOT EXISTS idx_jobs_running_lease
+ON jobs(lease_expires_at)
+WHERE status = 'running';
+
+CREATE INDEX IF NOT EXISTS idx_jobs_type_status_created
+ON jobs(type, status, created_at DESC);
+
+-- At most one queued job per (type, dedupe_key) that has not run yet; later
+-- enqueues coalesce into it. A retried or reclaimed job can go back to queued
+-- alongside a fresh one with the same dedupe key.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_pending_dedupe
+ON jobs(type, dedupe_key)
+WHERE status = 'queued' AND attempts = 0 AND dedupe_key IS NOT NULL;
+
+-- Move existing AI job queue state into jobs.
+INSERT INTO jobs (
+  id, type, payload, status, attempts, next_run_at, last_error,
+  locked_by, lease_expires_at, created_at, updated_at, completed_at
+)
+SELECT
+  a.id, 'ai', '{}'::jsonb, a.status, a.attempts, a.next_run_at, COALESCE(a.last_error, a.error_message),
+  a.locked_by, a.lease_expires_at, a.created_at, a.updated_at, a.completed_at
+FROM ai_jobs a
+ON CONFLICT (id) DO NOTHING;
+
+-- ai_jobs queue columns are no longer written; their indexes are unused.
+DROP INDEX IF EXISTS idx_ai_jobs_queued_next_run;
+DROP INDEX IF EXISTS idx_ai_jobs_running_lease;
+
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS thumb_object_key text;
+ALTER TABLE media_assets ADD COLUMN IF NOT EXISTS thumb_url text;
@@ -0,0 +1,32 @@
+-- Scheduled publishing: content with status 'scheduled' stays hidden from
+-- public reads until tdp-worker flips it to 'published' at published_at.
+-- Requires 0014_jobs.sql applied.
+
+-- Published rows dated in the future were visible early; hold them back. This
+-- runs only on the first application (before the scheduled indexes below
+-- exist): afterwards a future-dated published row was published on purpose.
+DO $$
+BEGIN
+  IF to_regclass('idx_posts_scheduled_published_at') IS NULL THEN
+    UPDATE posts SET status = 'scheduled', updated_at = NOW()
+    WHERE status = 'published' AND deleted_at IS NULL AND published_at > NOW();
+
+    UPDATE moments SET status = 'scheduled', updated_at = NOW()
+    WHERE status = 'published' AND deleted_at IS NULL AND published_at > NOW();
+
+    UPDATE gallery SET status = 'scheduled', updated_at = NOW()
+    WHERE status = 'published' AND deleted_at IS NULL AND published_at > NOW();
+  END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_posts_scheduled_published_at
+ON posts(published_at)
+WHERE status = 'scheduled' AND deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_moments_scheduled_published_at
+ON moments(published_at)
+WHERE status = 'scheduled' AND deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_gallery_scheduled_published_at
+ON gallery(published_at)
+WHERE status = 'scheduled' AND deleted_at IS NULL;
@@ -0,0 +1,43 @@
+-- Content revision history: every update archives the version it replaces,
+-- so posts, moments and gallery items can be diffed against and restored.
+-- Requires 0015_scheduled_content.sql applied.
+
+ALTER TABLE moments ADD COLUMN IF NOT EXISTS revision integer NOT NULL DEFAULT 1;
+ALTER TABLE moments ADD COLUMN IF NOT EXISTS updated_by text;
+ALTER TABLE gallery ADD COLUMN IF NOT EXISTS revision integer NOT NULL DEFAULT 1;
+ALTER TABLE gallery ADD COLUMN IF NOT EXISTS updated_by text;
+
+-- snapshot holds the full row (to_jsonb) as it was before the change;
+-- updated_by/updated_at describe who wrote that version and when.
+CREATE TABLE IF NOT EXISTS post_revisions (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  post_id uuid NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+  revision integer NOT NULL,
+  snapshot jsonb NOT NULL,
+  updated_by text,
+  updated_at timestamptz NOT NULL,
+  replaced_at timestamptz NOT NULL DEFAULT NOW(),
+  UNIQUE(post_id, revision)
+);
+
+CREATE TABLE IF NOT EXISTS moment_revisions (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  moment_id uuid NOT NULL REFERENCES moments(id) ON DELETE CASCADE,
+  revision integer NOT NULL,
+  snapshot jsonb NOT NULL,
+  updated_by text,
+  updated_at timestamptz NOT NULL,
+  replaced_at timestamptz NOT NULL DEFAULT NOW(),
+  UNIQUE(moment_id, revision)
+);
+
+CREATE TABLE IF NOT EXISTS gallery_revisions (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  gallery_id uuid NOT NULL REFERENCES gallery(id) ON DELETE CASCADE,
+  revision integer NOT NULL,
+  snapshot jsonb NOT NULL,
+  updated_by text,
+  updated_at timestamptz NOT NULL,
+  replaced_at timestamptz NOT NULL DEFAULT NOW(),
+  UNIQUE(gallery_id, revision)
+);
@@ -0,0 +1,7 @@
+-- API key secrets are sealed with a versioned master key (TDP_SECRET_KEYS).
+-- secret_key_version records which one; NULL means the row still holds a
+-- legacy plaintext secret. Run `tdp-api secrets migrate` after deploying to
+-- seal existing rows.
+-- Requires 0016_content_revisions.sql applied.
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS secret_key_version text;
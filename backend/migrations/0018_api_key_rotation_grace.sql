@@ -0,0 +1,8 @@
+-- Rotating an API key keeps the replaced secret valid until
+-- previous_secret_expires_at (TDP_KEY_ROTATION_GRACE), sealed the same way as
+-- secret_ciphertext.
+-- Requires 0017_api_key_secret_encryption.sql applied.
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS previous_secret_ciphertext text;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS previous_secret_key_version text;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS previous_secret_expires_at timestamptz;
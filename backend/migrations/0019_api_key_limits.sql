@@ -0,0 +1,15 @@
+-- Optional per-key restrictions enforced by the authenticator: an expiry, a
+-- list of allowed client CIDRs (empty allows any) and a requests-per-minute
+-- quota (0 is unlimited). api_key_rate_windows holds each key's current
+-- one-minute counter.
+-- Requires 0018_api_key_rotation_grace.sql applied.
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS expires_at timestamptz;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS allowed_cidrs jsonb NOT NULL DEFAULT '[]'::jsonb;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS rate_limit_per_minute integer NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS api_key_rate_windows (
+  key_id text PRIMARY KEY,
+  window_start timestamptz NOT NULL,
+  request_count integer NOT NULL DEFAULT 0
+);
@@ -0,0 +1,19 @@
+-- API keys can sign requests with Ed25519 instead of HMAC-SHA256. Ed25519 keys
+-- store only the client's public key (base64) and leave secret_ciphertext
+-- NULL; rotation keeps the replaced public key in previous_public_key for the
+-- same grace period as previous_secret_ciphertext.
+-- Requires 0019_api_key_limits.sql applied.
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS algorithm text NOT NULL DEFAULT 'hmac-sha256';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS public_key text;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS previous_public_key text;
+
+-- 0001 backfills secret_ciphertext from key_hash on every run of migrate.sh,
+-- which would give Ed25519 keys a bogus HMAC secret; clear it again here.
+UPDATE api_keys
+SET secret_ciphertext = NULL,
+    secret_key_version = NULL,
+    previous_secret_ciphertext = NULL,
+    previous_secret_key_version = NULL
+WHERE algorithm = 'ed25519'
+  AND (secret_ciphertext IS NOT NULL OR previous_secret_ciphertext IS NOT NULL);
@@ -0,0 +1,7 @@
+-- tdp-worker's sweeper deletes idempotency keys by updated_at and closed API
+-- key rate windows by window_start; request_nonces and preview_sessions are
+-- already indexed on expires_at.
+-- Requires 0020_api_key_ed25519.sql applied.
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_updated ON idempotency_keys(updated_at);
+CREATE INDEX IF NOT EXISTS idx_api_key_rate_windows_start ON api_key_rate_windows(window_start);
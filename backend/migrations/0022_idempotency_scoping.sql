@@ -0,0 +1,13 @@
+-- Idempotency keys are scoped to the calling API key, remember the response
+-- status code and replayable headers (ETag, Location), and hold an
+-- in_progress lock only until locked_until so a crashed request can be
+-- retried. Existing in_progress rows are unlocked immediately.
+-- Requires 0021_sweeper_indexes.sql applied.
+
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS api_key_id text NOT NULL DEFAULT '';
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS status_code integer;
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS response_headers jsonb NOT NULL DEFAULT '{}'::jsonb;
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS locked_until timestamptz NOT NULL DEFAULT NOW();
+
+ALTER TABLE idempotency_keys DROP CONSTRAINT IF EXISTS idempotency_keys_pkey;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_keys_scope_key ON idempotency_keys(api_key_id, key);
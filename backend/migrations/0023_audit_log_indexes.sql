@@ -0,0 +1,9 @@
+-- GET /v1/audit-logs pages newest first by (created_at, id) and filters by
+-- actor, action prefix and resource; resource history reads one resource's
+-- trail.
+-- Requires 0022_idempotency_scoping.sql applied.
+
+CREATE INDEX IF NOT EXISTS idx_audit_logs_created_id ON audit_logs(created_at DESC, (id::text) DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_actor_created ON audit_logs(actor_key_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_resource_created ON audit_logs(resource_type, resource_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_action_pattern ON audit_logs(action text_pattern_ops);
@@ -0,0 +1,21 @@
+-- Audit entries are chained: each stores a sequence number, the hash of the
+-- entry before it and its own hash over both, so editing or deleting a row
+-- breaks the chain (`tdp-api audit verify`). audit_log_chain holds the head
+-- and serializes writers. Rows written before this migration have no seq and
+-- are not part of the chain.
+-- Requires 0023_audit_log_indexes.sql applied.
+
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS seq bigint;
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS prev_hash text;
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS entry_hash text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_logs_seq ON audit_logs(seq) WHERE seq IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS audit_log_chain (
+  id smallint PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+  seq bigint NOT NULL DEFAULT 0,
+  last_hash text NOT NULL DEFAULT '',
+  updated_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO audit_log_chain (id) VALUES (1) ON CONFLICT (id) DO NOTHING;
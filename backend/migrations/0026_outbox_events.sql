@@ -0,0 +1,21 @@
+-- Transactional outbox. A content write adds its outbox_events row (and an
+-- outbox_dispatch job) in the same transaction as the change and its audit
+-- entry; tdp-worker relays undispatched events to webhook deliveries and the
+-- search snapshot refresh, then stamps dispatched_at. The sweeper drops
+-- dispatched events after TDP_OUTBOX_RETENTION.
+-- Requires 0025_webhooks.sql applied.
+
+CREATE TABLE IF NOT EXISTS outbox_events (
+  id bigserial PRIMARY KEY,
+  event_id uuid NOT NULL DEFAULT gen_random_uuid(),
+  event_type text NOT NULL,
+  resource_type text NOT NULL,
+  resource_id text NOT NULL,
+  actor_key_id text,
+  payload jsonb NOT NULL DEFAULT '{}'::jsonb,
+  created_at timestamptz NOT NULL DEFAULT NOW(),
+  dispatched_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_outbox_events_event_id ON outbox_events(event_id);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_pending ON outbox_events(id) WHERE dispatched_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_events_dispatched_at ON outbox_events(dispatched_at) WHERE dispatched_at IS NOT NULL;
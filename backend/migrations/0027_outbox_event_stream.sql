@@ -0,0 +1,41 @@
+-- Serve outbox_events as the GET /v1/events stream. tx_id records the writing
+-- transaction so readers only pass an event once every transaction that could
+-- still commit an earlier one has finished. Job status changes and search
+-- snapshot rebuilds are recorded as events too; they have nothing to relay and
+-- are written already dispatched.
+-- Requires 0026_outbox_events.sql applied.
+
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS tx_id bigint NOT NULL DEFAULT pg_current_xact_id()::text::bigint;
+CREATE INDEX IF NOT EXISTS idx_outbox_events_stream ON outbox_events(tx_id, id);
+
+CREATE OR REPLACE FUNCTION record_job_status_event() RETURNS trigger AS $$
+BEGIN
+  -- Dispatch jobs exist to relay events; reporting them would only add noise.
+  IF NEW.type = 'outbox_dispatch' THEN
+    RETURN NULL;
+  END IF;
+  IF TG_OP = 'UPDATE' AND NEW.status IS NOT DISTINCT FROM OLD.status THEN
+    RETURN NULL;
+  END IF;
+  INSERT INTO outbox_events (event_type, resource_type, resource_id, payload, dispatched_at)
+  VALUES (
+    'job.' || NEW.status,
+    'job',
+    NEW.id::text,
+    jsonb_build_object(
+      'id', NEW.id::text,
+      'type', NEW.type,
+      'status', NEW.status,
+      'attempts', NEW.attempts,
+      'lastError', NEW.last_error
+    ),
+    NOW()
+  );
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS jobs_status_event ON jobs;
+CREATE TRIGGER jobs_status_event
+  AFTER INSERT OR UPDATE OF status ON jobs
+  FOR EACH ROW EXECUTE FUNCTION record_job_status_event();
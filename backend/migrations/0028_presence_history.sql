@@ -0,0 +1,19 @@
+-- Presence history: every heartbeat is appended here as well as overwriting
+-- the presence_status row. tdp-worker's sweeper removes rows older than
+-- TDP_PRESENCE_HISTORY_RETENTION.
+-- Requires 0006_presence_status.sql applied.
+
+CREATE TABLE IF NOT EXISTS presence_history (
+  id bigserial PRIMARY KEY,
+  city text NOT NULL,
+  region text,
+  country text,
+  country_code text,
+  timezone text,
+  source text,
+  heartbeat_at timestamptz NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_presence_history_heartbeat
+ON presence_history(heartbeat_at, id);
@@ -0,0 +1,13 @@
+-- Presence privacy settings, stored with the presence row. visibility hidden
+-- takes presence off the public endpoints entirely; granularity limits them to
+-- the country or to online status only; hidden_fields lists further fields
+-- (region, timezone, source) left out of the public payload. Heartbeats are
+-- only kept in presence_history at the granularity in effect, so history rows
+-- recorded at country level have no city.
+-- Requires 0028_presence_history.sql applied.
+
+ALTER TABLE presence_status ADD COLUMN IF NOT EXISTS visibility text NOT NULL DEFAULT 'visible';
+ALTER TABLE presence_status ADD COLUMN IF NOT EXISTS granularity text NOT NULL DEFAULT 'city';
+ALTER TABLE presence_status ADD COLUMN IF NOT EXISTS hidden_fields jsonb NOT NULL DEFAULT '[]'::jsonb;
+
+ALTER TABLE presence_history ALTER COLUMN city DROP NOT NULL;
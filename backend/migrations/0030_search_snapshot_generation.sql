@@ -0,0 +1,18 @@
+-- Search snapshot refreshes are tracked by a generation counter instead of
+-- comparing requested_at (database time) with processed_at (worker time).
+-- Each refresh request increments requested_generation; a rebuild stores the
+-- generation it read before building as processed_generation, so a request
+-- that lands mid-build stays pending. The timestamps are kept for display.
+-- Requires 0009_search_snapshot_refresh_state.sql applied.
+
+ALTER TABLE search_snapshot_refresh_state ADD COLUMN IF NOT EXISTS requested_generation bigint NOT NULL DEFAULT 0;
+ALTER TABLE search_snapshot_refresh_state ADD COLUMN IF NOT EXISTS processed_generation bigint NOT NULL DEFAULT 0;
+
+-- A refresh pending under the old timestamps stays pending. Only rows that
+-- predate the counters (both still 0) are touched, so re-runs are no-ops.
+UPDATE search_snapshot_refresh_state
+SET requested_generation = 1
+WHERE requested_generation = 0
+  AND processed_generation = 0
+  AND requested_at IS NOT NULL
+  AND (processed_at IS NULL OR requested_at > processed_at);
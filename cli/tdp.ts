@@ -514,7 +514,7 @@ async function handleJobs(args: string[]) {
     const status = typeof statusRaw === "string" ? statusRaw : "unknown";
     console.log(`[${new Date().toISOString()}] status=${status}`);
 
-    if (["succeeded", "failed", "canceled"].includes(status)) {
+    if (["succeeded", "failed", "dead", "canceled"].includes(status)) {
       console.log(JSON.stringify(data, null, 2));
       return;
     }
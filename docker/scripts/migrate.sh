@@ -27,7 +27,26 @@ for migration in \
   /migrations/0008_search_snapshots.sql \
   /migrations/0009_search_snapshot_refresh_state.sql \
   /migrations/0010_card_span_preferences.sql \
-  /migrations/0011_backfill_imported_content_timestamps.sql
+  /migrations/0011_backfill_imported_content_timestamps.sql \
+  /migrations/0012_ai_job_retries.sql \
+  /migrations/0013_ai_job_leases.sql \
+  /migrations/0014_jobs.sql \
+  /migrations/0015_scheduled_content.sql \
+  /migrations/0016_content_revisions.sql \
+  /migrations/0017_api_key_secret_encryption.sql \
+  /migrations/0018_api_key_rotation_grace.sql \
+  /migrations/0019_api_key_limits.sql \
+  /migrations/0020_api_key_ed25519.sql \
+  /migrations/0021_sweeper_indexes.sql \
+  /migrations/0022_idempotency_scoping.sql \
+  /migrations/0023_audit_log_indexes.sql \
+  /migrations/0024_audit_log_hash_chain.sql \
+  /migrations/0025_webhooks.sql \
+  /migrations/0026_outbox_events.sql \
+  /migrations/0027_outbox_event_stream.sql \
+  /migrations/0028_presence_history.sql \
+  /migrations/0029_presence_privacy.sql \
+  /migrations/0030_search_snapshot_generation.sql
 do
   echo "Applying ${migration}"
   psql "${DATABASE_URL}" -v ON_ERROR_STOP=1 -f "${migration}"
@@ -15,6 +15,7 @@ INSERT INTO api_keys (
   permissions,
   key_id,
   secret_ciphertext,
+  secret_key_version,
   scopes,
   created_at,
   updated_at
@@ -25,6 +26,7 @@ VALUES (
   '["media:write","preview:write","content:write"]'::jsonb,
   :'key_id',
   :'key_secret',
+  NULL,
   '["media:write","preview:write","content:write"]'::jsonb,
   NOW(),
   NOW()
@@ -34,9 +36,12 @@ DO UPDATE SET
   key_hash = EXCLUDED.key_hash,
   permissions = EXCLUDED.permissions,
   secret_ciphertext = EXCLUDED.secret_ciphertext,
+  secret_key_version = EXCLUDED.secret_key_version,
   scopes = EXCLUDED.scopes,
   revoked_at = NULL,
   updated_at = NOW();
 SQL
 
+# The secret is written in plaintext; `tdp-api secrets migrate` seals it when
+# TDP_SECRET_KEYS is configured.
 echo "Publisher API key synced."